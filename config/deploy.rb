@@ -32,18 +32,11 @@ task :upload_binary do
   queue echo_cmd %[mv "#{deploy_to}/tmp/vtcboard" "vtcboard"]
 end
 
-task :upload_resources do
-  puts "uploading resources"
-  system "scp -r src/github.com/robmerrell/vtcboard/resources #{user}@#{domain}:#{deploy_to}/tmp/resources"
-  queue echo_cmd %[mv "#{deploy_to}/tmp/resources" "resources"]
-end
-
 desc "Deploys the current version to the server."
 task :deploy => :environment do
   deploy do
     invoke :compile
     invoke :upload_binary
-    invoke :upload_resources
 
     to :launch do
       queue "sudo restart vtcboard"
@@ -0,0 +1,90 @@
+package broadcast
+
+import (
+	"sync"
+)
+
+// Event is a piece of new data published to everyone listening.
+type Event struct {
+	// Channel names the kind of data, eg: price, network or posts:/r/vertcoin
+	Channel string
+	Data    interface{}
+}
+
+// Hub fans events out to subscribers in the same process. Publishing never blocks:
+// a subscriber that has fallen so far behind that its buffer is full is dropped and
+// its channel closed.
+type Hub struct {
+	mutex       sync.Mutex
+	subscribers map[*Subscriber]bool
+}
+
+// Subscriber receives events from a hub until it unsubscribes or is dropped, at which
+// point Events is closed.
+type Subscriber struct {
+	Events chan Event
+}
+
+// NewHub creates a hub without any subscribers.
+func NewHub() *Hub {
+	return &Hub{subscribers: make(map[*Subscriber]bool)}
+}
+
+// Subscribe adds a subscriber that can have up to buffer events waiting to be read.
+func (h *Hub) Subscribe(buffer int) *Subscriber {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	s := &Subscriber{Events: make(chan Event, buffer)}
+	h.subscribers[s] = true
+	return s
+}
+
+// Unsubscribe removes a subscriber from the hub. It is safe to call after the
+// subscriber was dropped.
+func (h *Hub) Unsubscribe(s *Subscriber) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.remove(s)
+}
+
+// Publish sends an event to every subscriber.
+func (h *Hub) Publish(e Event) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for s := range h.subscribers {
+		select {
+		case s.Events <- e:
+		default:
+			h.remove(s)
+		}
+	}
+}
+
+// Close drops every subscriber.
+func (h *Hub) Close() {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for s := range h.subscribers {
+		h.remove(s)
+	}
+}
+
+// Count returns the number of subscribers.
+func (h *Hub) Count() int {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return len(h.subscribers)
+}
+
+// remove closes a subscriber's channel. The hub's mutex must be held.
+func (h *Hub) remove(s *Subscriber) {
+	if h.subscribers[s] {
+		delete(h.subscribers, s)
+		close(s.Events)
+	}
+}
@@ -0,0 +1,66 @@
+package broadcast
+
+import (
+	. "launchpad.net/gocheck"
+	"testing"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type hubSuite struct{}
+
+var _ = Suite(&hubSuite{})
+
+func (s *hubSuite) TestPublishing(c *C) {
+	hub := NewHub()
+	sub1 := hub.Subscribe(1)
+	sub2 := hub.Subscribe(1)
+
+	hub.Publish(Event{Channel: "price", Data: 1.5})
+
+	c.Check((<-sub1.Events).Data, Equals, 1.5)
+	c.Check((<-sub2.Events).Channel, Equals, "price")
+}
+
+func (s *hubSuite) TestSlowSubscribersAreDropped(c *C) {
+	hub := NewHub()
+	slow := hub.Subscribe(1)
+	fast := hub.Subscribe(2)
+
+	hub.Publish(Event{Channel: "price", Data: 1})
+	hub.Publish(Event{Channel: "price", Data: 2})
+
+	c.Check(hub.Count(), Equals, 1)
+
+	// the slow subscriber gets what fit in its buffer and is then closed
+	c.Check((<-slow.Events).Data, Equals, 1)
+	_, open := <-slow.Events
+	c.Check(open, Equals, false)
+
+	c.Check((<-fast.Events).Data, Equals, 1)
+	c.Check((<-fast.Events).Data, Equals, 2)
+}
+
+func (s *hubSuite) TestUnsubscribing(c *C) {
+	hub := NewHub()
+	sub := hub.Subscribe(1)
+
+	hub.Unsubscribe(sub)
+	hub.Unsubscribe(sub)
+	hub.Publish(Event{Channel: "price"})
+
+	_, open := <-sub.Events
+	c.Check(open, Equals, false)
+	c.Check(hub.Count(), Equals, 0)
+}
+
+func (s *hubSuite) TestClosing(c *C) {
+	hub := NewHub()
+	sub := hub.Subscribe(1)
+
+	hub.Close()
+
+	_, open := <-sub.Events
+	c.Check(open, Equals, false)
+}
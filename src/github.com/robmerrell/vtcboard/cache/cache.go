@@ -0,0 +1,148 @@
+package cache
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Cache is an in-memory store of rendered responses that expire after a TTL. Only
+// one caller recomputes a missing or expired key at a time, everyone else asking
+// for the same key waits for that result. Once it holds maxEntries the entry closest
+// to expiring is thrown out to make room.
+type Cache struct {
+	ttl        time.Duration
+	maxEntries int
+	mutex      sync.Mutex
+	entries    map[string]*entry
+	calls      map[string]*call
+	generation int
+}
+
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+// call is an in-flight computation of a key.
+type call struct {
+	wg    sync.WaitGroup
+	value string
+	err   error
+}
+
+// New creates an empty cache whose entries live for ttl and that holds at most
+// maxEntries of them.
+func New(ttl time.Duration, maxEntries int) *Cache {
+	return &Cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    make(map[string]*entry),
+		calls:      make(map[string]*call),
+	}
+}
+
+// Get returns the cached value for key. If there isn't one, or it has expired,
+// compute is called to generate it. Errors from compute are returned to every
+// waiting caller but are not cached.
+func (c *Cache) Get(key string, compute func() (string, error)) (string, error) {
+	c.mutex.Lock()
+
+	if e, ok := c.entries[key]; ok && time.Now().Before(e.expiresAt) {
+		c.mutex.Unlock()
+		return e.value, nil
+	}
+
+	// somebody is already generating this key, wait for them
+	if cl, ok := c.calls[key]; ok {
+		c.mutex.Unlock()
+		cl.wg.Wait()
+		return cl.value, cl.err
+	}
+
+	cl := &call{}
+	cl.wg.Add(1)
+	c.calls[key] = cl
+	generation := c.generation
+	c.mutex.Unlock()
+
+	c.compute(key, cl, generation, compute)
+	return cl.value, cl.err
+}
+
+// compute fills in a call and stores its value, making sure waiting callers are released
+// even if compute panics.
+func (c *Cache) compute(key string, cl *call, generation int, compute func() (string, error)) {
+	defer func() {
+		if r := recover(); r != nil {
+			cl.value, cl.err = "", fmt.Errorf("computing %s panicked: %v", key, r)
+		}
+
+		c.mutex.Lock()
+		delete(c.calls, key)
+
+		// don't store a value computed from data that was invalidated in the meantime
+		if cl.err == nil && generation == c.generation {
+			c.store(key, cl.value)
+		}
+		c.mutex.Unlock()
+		cl.wg.Done()
+	}()
+
+	cl.value, cl.err = compute()
+}
+
+// store adds an entry, making room for it if the cache is full. The mutex must be held.
+func (c *Cache) store(key, value string) {
+	delete(c.entries, key)
+	for len(c.entries) > 0 && len(c.entries) >= c.maxEntries {
+		var oldest string
+		for k, e := range c.entries {
+			if oldest == "" || e.expiresAt.Before(c.entries[oldest].expiresAt) {
+				oldest = k
+			}
+		}
+		delete(c.entries, oldest)
+	}
+
+	c.entries[key] = &entry{value: value, expiresAt: time.Now().Add(c.ttl)}
+}
+
+// SetTTL changes how long new entries live for.
+func (c *Cache) SetTTL(ttl time.Duration) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.ttl = ttl
+}
+
+// SetMaxEntries changes how many entries the cache holds. Entries over the new limit are
+// thrown out as new ones are stored.
+func (c *Cache) SetMaxEntries(maxEntries int) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.maxEntries = maxEntries
+}
+
+// Flush removes every entry from the cache.
+func (c *Cache) Flush() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	c.entries = make(map[string]*entry)
+	c.generation++
+}
+
+// Prune removes entries that have expired, for caches whose keys change over time.
+func (c *Cache) Prune() {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	now := time.Now()
+	for key, e := range c.entries {
+		if !now.Before(e.expiresAt) {
+			delete(c.entries, key)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cache
+
+import (
+	"errors"
+	. "launchpad.net/gocheck"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type cacheSuite struct{}
+
+var _ = Suite(&cacheSuite{})
+
+func (s *cacheSuite) TestCachingValues(c *C) {
+	cache := New(time.Minute, 100)
+	calls := 0
+	compute := func() (string, error) {
+		calls++
+		return "page", nil
+	}
+
+	cache.Get("/", compute)
+	value, _ := cache.Get("/", compute)
+
+	c.Check(value, Equals, "page")
+	c.Check(calls, Equals, 1)
+}
+
+func (s *cacheSuite) TestExpiringValues(c *C) {
+	cache := New(time.Millisecond, 100)
+	calls := 0
+	compute := func() (string, error) {
+		calls++
+		return "page", nil
+	}
+
+	cache.Get("/", compute)
+	time.Sleep(time.Millisecond * 5)
+	cache.Get("/", compute)
+
+	c.Check(calls, Equals, 2)
+}
+
+func (s *cacheSuite) TestChangingTTL(c *C) {
+	cache := New(time.Minute, 100)
+	cache.SetTTL(time.Millisecond)
+
+	calls := 0
+	compute := func() (string, error) {
+		calls++
+		return "page", nil
+	}
+
+	cache.Get("/", compute)
+	time.Sleep(time.Millisecond * 5)
+	cache.Get("/", compute)
+
+	c.Check(calls, Equals, 2)
+}
+
+func (s *cacheSuite) TestErrorsAreNotCached(c *C) {
+	cache := New(time.Minute, 100)
+
+	_, err := cache.Get("/", func() (string, error) { return "", errors.New("failed") })
+	c.Check(err, NotNil)
+
+	value, err := cache.Get("/", func() (string, error) { return "page", nil })
+	c.Check(err, IsNil)
+	c.Check(value, Equals, "page")
+}
+
+func (s *cacheSuite) TestPanicsAreErrors(c *C) {
+	cache := New(time.Minute, 100)
+	_, err := cache.Get("/", func() (string, error) { panic("template broke") })
+	c.Check(err, ErrorMatches, "computing / panicked: template broke")
+
+	// the key isn't stuck waiting on the call that panicked
+	value, err := cache.Get("/", func() (string, error) { return "page", nil })
+	c.Assert(err, IsNil)
+	c.Check(value, Equals, "page")
+}
+
+func (s *cacheSuite) TestLimitingEntries(c *C) {
+	cache := New(time.Minute, 2)
+	for _, key := range []string{"/a", "/b", "/c"} {
+		key := key
+		cache.Get(key, func() (string, error) { return key, nil })
+		time.Sleep(time.Millisecond)
+	}
+
+	c.Check(len(cache.entries), Equals, 2)
+	c.Check(cache.entries["/a"], IsNil)
+	c.Check(cache.entries["/c"], NotNil)
+}
+
+func (s *cacheSuite) TestFlushing(c *C) {
+	cache := New(time.Minute, 100)
+
+	cache.Get("/", func() (string, error) { return "old", nil })
+	cache.Flush()
+	value, _ := cache.Get("/", func() (string, error) { return "new", nil })
+
+	c.Check(value, Equals, "new")
+}
+
+func (s *cacheSuite) TestPruning(c *C) {
+	cache := New(time.Millisecond, 100)
+
+	cache.Get("/old", func() (string, error) { return "old", nil })
+	time.Sleep(time.Millisecond * 5)
+	cache.SetTTL(time.Minute)
+	cache.Get("/new", func() (string, error) { return "new", nil })
+	cache.Prune()
+
+	c.Check(len(cache.entries), Equals, 1)
+	c.Check(cache.entries["/new"], NotNil)
+}
+
+func (s *cacheSuite) TestOnlyOneCallerComputes(c *C) {
+	cache := New(time.Minute, 100)
+
+	var mutex sync.Mutex
+	calls := 0
+	release := make(chan bool)
+	compute := func() (string, error) {
+		mutex.Lock()
+		calls++
+		mutex.Unlock()
+
+		<-release
+		return "page", nil
+	}
+
+	var wg sync.WaitGroup
+	results := make(chan string, 10)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			value, _ := cache.Get("/", compute)
+			results <- value
+		}()
+	}
+
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+	wg.Wait()
+	close(results)
+
+	c.Check(calls, Equals, 1)
+	for value := range results {
+		c.Check(value, Equals, "page")
+	}
+}
@@ -0,0 +1,83 @@
+package chain
+
+import (
+	"errors"
+	"fmt"
+	"github.com/robmerrell/vtcboard/config"
+	"strings"
+	"time"
+)
+
+// ErrNotFound is returned by a backend when it doesn't know about a block.
+var ErrNotFound = errors.New("block not found")
+
+// Backend is a source of blockchain data, like a node or a block explorer.
+type Backend interface {
+	// BlockCount returns the height of the tip of the best chain.
+	BlockCount() (int64, error)
+
+	// BlockHash returns the hash of the block at height on the best chain.
+	BlockHash(height int64) (string, error)
+
+	// Block returns the block with the given hash.
+	Block(hash string) (*Block, error)
+}
+
+// NewBackend creates the backend named in the [chain] section of the config.
+func NewBackend(settings config.ChainConfig) (Backend, error) {
+	switch settings.Backend {
+	case "rpc":
+		return NewRPC(settings.RPCURL, settings.RPCUser, settings.RPCPassword), nil
+	case "esplora":
+		return NewEsplora(settings.ExplorerURL), nil
+	case "insight":
+		return NewInsight(settings.ExplorerURL), nil
+	}
+
+	return nil, fmt.Errorf("unknown chain backend %q", settings.Backend)
+}
+
+// Block is what vtcboard needs to know about a block.
+type Block struct {
+	Height     int64
+	Hash       string
+	PrevHash   string
+	Time       time.Time
+	Difficulty float64
+	TxCount    int
+	Size       int
+
+	// total paid out by the coinbase transaction, in coins
+	CoinbaseValue float64
+
+	// the coinbase input script, which miners put their tag in
+	CoinbaseScript []byte
+
+	// addresses the coinbase pays to
+	PayoutAddresses []string
+}
+
+// CoinbaseTag pulls the readable text out of a coinbase script. Pools usually put their
+// name or url there, between the block height and extra nonce.
+func CoinbaseTag(script []byte) string {
+	runs := []string{}
+	current := []byte{}
+
+	flush := func() {
+		if len(current) >= 4 {
+			runs = append(runs, strings.TrimSpace(string(current)))
+		}
+		current = current[:0]
+	}
+
+	for _, b := range script {
+		if b >= 0x20 && b < 0x7f {
+			current = append(current, b)
+		} else {
+			flush()
+		}
+	}
+	flush()
+
+	return strings.Join(runs, " ")
+}
@@ -0,0 +1,306 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/robmerrell/vtcboard/fees"
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+// ---------------
+// Coinbase tags
+// ---------------
+type coinbaseSuite struct{}
+
+var _ = Suite(&coinbaseSuite{})
+
+func (s *coinbaseSuite) TestCoinbaseTag(c *C) {
+	script := append([]byte{0x03, 0x1a, 0x2b, 0x04}, []byte("/P2Pool/")...)
+	script = append(script, 0x00, 0xfa, 0xbe)
+	script = append(script, []byte("mined by vtcpool.example")...)
+
+	c.Check(CoinbaseTag(script), Equals, "/P2Pool/ mined by vtcpool.example")
+	c.Check(CoinbaseTag([]byte{0x03, 'a', 'b', 0x01}), Equals, "")
+}
+
+// -----------
+// RPC backend
+// -----------
+type rpcSuite struct {
+	server *httptest.Server
+	rpc    *RPC
+}
+
+var _ = Suite(&rpcSuite{})
+
+// rpcResponses are what the fake node answers each method with.
+var rpcResponses = map[string]string{
+	"getblockcount": `{"result": 123456, "error": null, "id": 1}`,
+	"getblockhash":  `{"result": "00000000000abc", "error": null, "id": 1}`,
+	"getblock": `{"result": {
+		"hash": "00000000000abc", "height": 123456, "time": 1400000000, "difficulty": 12.5,
+		"size": 2048, "previousblockhash": "00000000000abb",
+		"tx": [
+			{
+				"txid": "coinbasetx",
+				"vin": [{"coinbase": "03406e012f503253482f"}],
+				"vout": [
+					{"value": 49.5, "scriptPubKey": {"addresses": ["VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3"]}},
+					{"value": 0.5, "scriptPubKey": {"addresses": ["VtC9gLnvPezv3idW7YZ4xUFNTNfs5aFgMn"]}}
+				]
+			},
+			{"txid": "othertx", "vin": [{"txid": "spenttx", "vout": 0}], "vout": [{"value": 1}]}
+		]
+	}, "error": null, "id": 1}`,
+	"getdifficulty":    `{"result": 12.5, "error": null, "id": 1}`,
+	"getnetworkhashps": `{"result": 2500000000, "error": null, "id": 1}`,
+	"getmempoolinfo":   `{"result": {"size": 2, "bytes": 475, "mempoolminfee": 0.00001}, "error": null, "id": 1}`,
+	"getrawmempool": `{"result": {
+		"tx1": {"size": 250, "fee": 0.0001, "time": 1400000000},
+		"tx2": {"size": 300, "vsize": 225, "fees": {"base": 0.00045}, "time": 1400000010}
+	}, "error": null, "id": 1}`,
+}
+
+func (s *rpcSuite) SetUpSuite(c *C) {
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		if user != "user" || pass != "pass" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		var request struct {
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.NewDecoder(r.Body).Decode(&request)
+
+		if request.Method == "getblock" && (len(request.Params) != 2 || request.Params[1].(float64) != 2) {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"result": null, "error": {"code": -8, "message": "getblock should decode transactions"}, "id": 1}`)
+			return
+		}
+
+		if request.Method == "getblockhash" && request.Params[0].(float64) > 123456 {
+			w.WriteHeader(http.StatusInternalServerError)
+			fmt.Fprint(w, `{"result": null, "error": {"code": -8, "message": "Block height out of range"}, "id": 1}`)
+			return
+		}
+
+		fmt.Fprint(w, rpcResponses[request.Method])
+	}))
+
+	s.rpc = NewRPC(s.server.URL, "user", "pass")
+}
+
+func (s *rpcSuite) TearDownSuite(c *C) {
+	s.server.Close()
+}
+
+func (s *rpcSuite) TestBlockCount(c *C) {
+	count, err := s.rpc.BlockCount()
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, int64(123456))
+}
+
+func (s *rpcSuite) TestBlockHash(c *C) {
+	hash, err := s.rpc.BlockHash(123456)
+	c.Assert(err, IsNil)
+	c.Check(hash, Equals, "00000000000abc")
+
+	_, err = s.rpc.BlockHash(123457)
+	c.Check(err, Equals, ErrNotFound)
+}
+
+func (s *rpcSuite) TestBlock(c *C) {
+	block, err := s.rpc.Block("00000000000abc")
+	c.Assert(err, IsNil)
+
+	c.Check(block.Height, Equals, int64(123456))
+	c.Check(block.PrevHash, Equals, "00000000000abb")
+	c.Check(block.Time, Equals, time.Unix(1400000000, 0).UTC())
+	c.Check(block.Difficulty, Equals, 12.5)
+	c.Check(block.TxCount, Equals, 2)
+	c.Check(block.Size, Equals, 2048)
+	c.Check(block.CoinbaseValue, Equals, float64(50))
+	c.Check(block.PayoutAddresses, DeepEquals, []string{"VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3", "VtC9gLnvPezv3idW7YZ4xUFNTNfs5aFgMn"})
+	c.Check(CoinbaseTag(block.CoinbaseScript), Equals, "/P2SH/")
+}
+
+func (s *rpcSuite) TestMempool(c *C) {
+	mempool, err := s.rpc.Mempool()
+	c.Assert(err, IsNil)
+
+	c.Check(mempool.Count, Equals, 2)
+	c.Check(mempool.Bytes, Equals, int64(475))
+	c.Check(mempool.MinFee, Equals, 0.00001)
+
+	sort.Slice(mempool.Txs, func(i, j int) bool { return mempool.Txs[i].Size > mempool.Txs[j].Size })
+	c.Check(mempool.Txs, DeepEquals, []fees.Tx{{Size: 250, Fee: 0.0001}, {Size: 225, Fee: 0.00045}})
+}
+
+func (s *rpcSuite) TestStats(c *C) {
+	stats, err := s.rpc.Stats()
+	c.Assert(err, IsNil)
+	c.Check(*stats, Equals, Stats{Height: 123456, Difficulty: 12.5, HashRate: 2500000000})
+}
+
+func (s *rpcSuite) TestBadCredentials(c *C) {
+	_, err := NewRPC(s.server.URL, "user", "wrong").BlockCount()
+	c.Check(err, NotNil)
+}
+
+// -----------------
+// Explorer backends
+// -----------------
+
+type statsSuite struct {
+	server *httptest.Server
+}
+
+var _ = Suite(&statsSuite{})
+
+// restResponses are what the fake explorers answer each path with.
+var restResponses = map[string]string{
+	"/esplora/blocks/tip/hash":             "00000000000abc",
+	"/esplora/blocks/tip/height":           "123456",
+	"/esplora/block-height/123456":         "00000000000abc",
+	"/esplora/block/00000000000abc":        `{"id": "00000000000abc", "height": 123456, "timestamp": 1400000000, "tx_count": 2, "size": 2048, "bits": 486604799, "previousblockhash": "00000000000abb"}`,
+	"/esplora/block/00000000000abc/txid/0": "coinbasetx",
+	"/esplora/tx/coinbasetx": `{"txid": "coinbasetx", "vin": [{"is_coinbase": true, "scriptsig": "03406e012f503253482f"}], "vout": [
+		{"value": 4950000000, "scriptpubkey_address": "VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3"},
+		{"value": 50000000, "scriptpubkey_address": "VtC9gLnvPezv3idW7YZ4xUFNTNfs5aFgMn"},
+		{"value": 0}
+	]}`,
+	"/insight/status":             `{"info": {"blocks": 123455, "difficulty": 12.5, "connections": 8}}`,
+	"/insight/block-index/123455": `{"blockHash": "00000000000abd"}`,
+	"/insight/block/00000000000abd": `{"hash": "00000000000abd", "height": 123455, "time": 1400000000, "difficulty": 12.5, "size": 2048,
+		"tx": ["coinbasetx", "othertx"], "previousblockhash": "00000000000abc"}`,
+	"/insight/tx/coinbasetx": `{"vin": [{"coinbase": "03406e012f503253482f"}], "vout": [
+		{"value": "49.50000000", "scriptPubKey": {"addresses": ["VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3"]}},
+		{"value": "0.50000000", "scriptPubKey": {"addresses": ["VtC9gLnvPezv3idW7YZ4xUFNTNfs5aFgMn"]}}
+	]}`,
+}
+
+func (s *statsSuite) SetUpSuite(c *C) {
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		response, ok := restResponses[r.URL.Path]
+		if !ok || (r.URL.Path == "/insight/status" && r.URL.Query().Get("q") != "getInfo") {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, response)
+	}))
+}
+
+func (s *statsSuite) TearDownSuite(c *C) {
+	s.server.Close()
+}
+
+func (s *statsSuite) TestEsplora(c *C) {
+	stats, err := NewEsplora(s.server.URL + "/esplora/").Stats()
+	c.Assert(err, IsNil)
+	c.Check(*stats, Equals, Stats{Height: 123456, Difficulty: 1})
+
+	_, err = NewEsplora(s.server.URL + "/missing").Stats()
+	c.Check(err, Equals, errRESTNotFound)
+}
+
+func (s *statsSuite) TestEsploraBlocks(c *C) {
+	esplora := NewEsplora(s.server.URL + "/esplora")
+
+	count, err := esplora.BlockCount()
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, int64(123456))
+
+	hash, err := esplora.BlockHash(123456)
+	c.Assert(err, IsNil)
+	c.Check(hash, Equals, "00000000000abc")
+
+	_, err = esplora.BlockHash(123457)
+	c.Check(err, Equals, ErrNotFound)
+
+	block, err := esplora.Block(hash)
+	c.Assert(err, IsNil)
+	c.Check(block.Height, Equals, int64(123456))
+	c.Check(block.PrevHash, Equals, "00000000000abb")
+	c.Check(block.Time, Equals, time.Unix(1400000000, 0).UTC())
+	c.Check(block.Difficulty, Equals, float64(1))
+	c.Check(block.TxCount, Equals, 2)
+	c.Check(block.CoinbaseValue, Equals, float64(50))
+	c.Check(block.PayoutAddresses, DeepEquals, []string{"VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3", "VtC9gLnvPezv3idW7YZ4xUFNTNfs5aFgMn"})
+	c.Check(CoinbaseTag(block.CoinbaseScript), Equals, "/P2SH/")
+}
+
+func (s *statsSuite) TestInsightBlocks(c *C) {
+	insight := NewInsight(s.server.URL + "/insight")
+
+	count, err := insight.BlockCount()
+	c.Assert(err, IsNil)
+	c.Check(count, Equals, int64(123455))
+
+	hash, err := insight.BlockHash(123455)
+	c.Assert(err, IsNil)
+	c.Check(hash, Equals, "00000000000abd")
+
+	_, err = insight.BlockHash(123456)
+	c.Check(err, Equals, ErrNotFound)
+
+	block, err := insight.Block(hash)
+	c.Assert(err, IsNil)
+	c.Check(block.Height, Equals, int64(123455))
+	c.Check(block.PrevHash, Equals, "00000000000abc")
+	c.Check(block.Difficulty, Equals, 12.5)
+	c.Check(block.TxCount, Equals, 2)
+	c.Check(block.CoinbaseValue, Equals, float64(50))
+	c.Check(block.PayoutAddresses, DeepEquals, []string{"VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3", "VtC9gLnvPezv3idW7YZ4xUFNTNfs5aFgMn"})
+	c.Check(CoinbaseTag(block.CoinbaseScript), Equals, "/P2SH/")
+}
+
+func (s *statsSuite) TestInsight(c *C) {
+	stats, err := NewInsight(s.server.URL + "/insight").Stats()
+	c.Assert(err, IsNil)
+	c.Check(*stats, Equals, Stats{Height: 123455, Difficulty: 12.5})
+}
+
+func (s *statsSuite) TestDifficultyFromBits(c *C) {
+	c.Check(DifficultyFromBits(0x1d00ffff), Equals, float64(1))
+	c.Check(DifficultyFromBits(0x1b0404cb), Equals, 16307.420938523983)
+}
+
+// fixedStats is a backend that always answers the same way.
+type fixedStats struct {
+	stats *Stats
+	err   error
+}
+
+func (f *fixedStats) Stats() (*Stats, error) {
+	return f.stats, f.err
+}
+
+func (s *statsSuite) TestFailover(c *C) {
+	down := &fixedStats{err: errors.New("connection refused")}
+	behind := &fixedStats{stats: &Stats{Height: 990}}
+	current := &fixedStats{stats: &Stats{Height: 999}}
+	tip := &fixedStats{stats: &Stats{Height: 1000}}
+
+	stats, errs := Failover([]StatsBackend{down, behind, current, tip}, 5)
+	c.Check(stats, Equals, current.stats)
+	c.Check(errs[0], ErrorMatches, "connection refused")
+	c.Check(errs[1], ErrorMatches, "at height 990, 10 blocks behind")
+	c.Check(errs[2], IsNil)
+	c.Check(errs[3], IsNil)
+
+	stats, errs = Failover([]StatsBackend{down}, 5)
+	c.Check(stats, IsNil)
+	c.Check(errs, HasLen, 1)
+}
@@ -0,0 +1,127 @@
+package chain
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Esplora reads the chain from an Esplora block explorer's REST api.
+type Esplora struct {
+	// the api's root, eg: https://explorer.example/api
+	URL string
+
+	// defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// NewEsplora creates a backend for the Esplora api at url.
+func NewEsplora(url string) *Esplora {
+	return &Esplora{URL: strings.TrimRight(url, "/")}
+}
+
+// esploraBlock is a block as Esplora describes it.
+type esploraBlock struct {
+	Id        string `json:"id"`
+	Height    int64  `json:"height"`
+	Timestamp int64  `json:"timestamp"`
+	TxCount   int    `json:"tx_count"`
+	Size      int    `json:"size"`
+	Bits      uint32 `json:"bits"`
+	PrevHash  string `json:"previousblockhash"`
+}
+
+// text fetches a path that Esplora answers with plain text.
+func (e *Esplora) text(path string) (string, error) {
+	body, err := restGet(e.Client, e.URL+path)
+	return strings.TrimSpace(string(body)), err
+}
+
+// BlockCount returns the height of the tip of the best chain.
+func (e *Esplora) BlockCount() (int64, error) {
+	height, err := e.text("/blocks/tip/height")
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.ParseInt(height, 10, 64)
+}
+
+// BlockHash returns the hash of the block at height on the best chain.
+func (e *Esplora) BlockHash(height int64) (string, error) {
+	hash, err := e.text("/block-height/" + strconv.FormatInt(height, 10))
+	if err == errRESTNotFound {
+		return "", ErrNotFound
+	}
+	return hash, err
+}
+
+// Block returns the block with the given hash, along with its coinbase transaction.
+func (e *Esplora) Block(hash string) (*Block, error) {
+	var raw esploraBlock
+	if err := restGetJSON(e.Client, e.URL+"/block/"+hash, &raw); err != nil {
+		if err == errRESTNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	block := &Block{
+		Height:     raw.Height,
+		Hash:       raw.Id,
+		PrevHash:   raw.PrevHash,
+		Time:       time.Unix(raw.Timestamp, 0).UTC(),
+		Difficulty: DifficultyFromBits(raw.Bits),
+		TxCount:    raw.TxCount,
+		Size:       raw.Size,
+	}
+
+	txid, err := e.text("/block/" + hash + "/txid/0")
+	if err != nil {
+		return nil, err
+	}
+
+	var coinbase struct {
+		Vin []struct {
+			ScriptSig string `json:"scriptsig"`
+		} `json:"vin"`
+		Vout []struct {
+			Value   int64  `json:"value"`
+			Address string `json:"scriptpubkey_address"`
+		} `json:"vout"`
+	}
+	if err := restGetJSON(e.Client, e.URL+"/tx/"+txid, &coinbase); err != nil {
+		return nil, err
+	}
+
+	if len(coinbase.Vin) > 0 {
+		block.CoinbaseScript, _ = hex.DecodeString(coinbase.Vin[0].ScriptSig)
+	}
+	for _, out := range coinbase.Vout {
+		// esplora reports values in satoshis
+		block.CoinbaseValue += float64(out.Value) / 100000000
+		if out.Address != "" {
+			block.PayoutAddresses = append(block.PayoutAddresses, out.Address)
+		}
+	}
+
+	return block, nil
+}
+
+// Stats returns the height and difficulty of the explorer's best block. Esplora doesn't
+// report the hashrate or the supply.
+func (e *Esplora) Stats() (*Stats, error) {
+	hash, err := e.text("/blocks/tip/hash")
+	if err != nil {
+		return nil, err
+	}
+
+	var block esploraBlock
+	if err := restGetJSON(e.Client, e.URL+"/block/"+hash, &block); err != nil {
+		return nil, err
+	}
+
+	return &Stats{Height: block.Height, Difficulty: DifficultyFromBits(block.Bits)}, nil
+}
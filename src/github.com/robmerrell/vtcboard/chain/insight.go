@@ -0,0 +1,127 @@
+package chain
+
+import (
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Insight reads the chain from an Insight block explorer's REST api.
+type Insight struct {
+	// the api's root, eg: https://insight.example/insight-api
+	URL string
+
+	// defaults to http.DefaultClient
+	Client *http.Client
+}
+
+// NewInsight creates a backend for the Insight api at url.
+func NewInsight(url string) *Insight {
+	return &Insight{URL: strings.TrimRight(url, "/")}
+}
+
+// insightInfo is the explorer's status.
+type insightInfo struct {
+	Info struct {
+		Blocks     int64   `json:"blocks"`
+		Difficulty float64 `json:"difficulty"`
+	} `json:"info"`
+}
+
+// BlockCount returns the height of the tip of the best chain.
+func (i *Insight) BlockCount() (int64, error) {
+	var status insightInfo
+	err := restGetJSON(i.Client, i.URL+"/status?q=getInfo", &status)
+	return status.Info.Blocks, err
+}
+
+// BlockHash returns the hash of the block at height on the best chain.
+func (i *Insight) BlockHash(height int64) (string, error) {
+	var index struct {
+		BlockHash string `json:"blockHash"`
+	}
+	if err := restGetJSON(i.Client, i.URL+"/block-index/"+strconv.FormatInt(height, 10), &index); err != nil {
+		if err == errRESTNotFound {
+			return "", ErrNotFound
+		}
+		return "", err
+	}
+
+	return index.BlockHash, nil
+}
+
+// Block returns the block with the given hash, along with its coinbase transaction.
+func (i *Insight) Block(hash string) (*Block, error) {
+	var raw struct {
+		Hash       string   `json:"hash"`
+		Height     int64    `json:"height"`
+		Time       int64    `json:"time"`
+		Difficulty float64  `json:"difficulty"`
+		Size       int      `json:"size"`
+		Tx         []string `json:"tx"`
+		PrevHash   string   `json:"previousblockhash"`
+	}
+	if err := restGetJSON(i.Client, i.URL+"/block/"+hash, &raw); err != nil {
+		if err == errRESTNotFound {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+
+	block := &Block{
+		Height:     raw.Height,
+		Hash:       raw.Hash,
+		PrevHash:   raw.PrevHash,
+		Time:       time.Unix(raw.Time, 0).UTC(),
+		Difficulty: raw.Difficulty,
+		TxCount:    len(raw.Tx),
+		Size:       raw.Size,
+	}
+
+	if len(raw.Tx) == 0 {
+		return block, nil
+	}
+
+	// insight writes values as strings of coins
+	var coinbase struct {
+		Vin []struct {
+			Coinbase string `json:"coinbase"`
+		} `json:"vin"`
+		Vout []struct {
+			Value        string `json:"value"`
+			ScriptPubKey struct {
+				Addresses []string `json:"addresses"`
+			} `json:"scriptPubKey"`
+		} `json:"vout"`
+	}
+	if err := restGetJSON(i.Client, i.URL+"/tx/"+raw.Tx[0], &coinbase); err != nil {
+		return nil, err
+	}
+
+	if len(coinbase.Vin) > 0 {
+		block.CoinbaseScript, _ = hex.DecodeString(coinbase.Vin[0].Coinbase)
+	}
+	for _, out := range coinbase.Vout {
+		value, err := strconv.ParseFloat(out.Value, 64)
+		if err != nil {
+			return nil, err
+		}
+		block.CoinbaseValue += value
+		block.PayoutAddresses = append(block.PayoutAddresses, out.ScriptPubKey.Addresses...)
+	}
+
+	return block, nil
+}
+
+// Stats returns the height and difficulty from the explorer's status. Insight doesn't
+// report the hashrate or the supply.
+func (i *Insight) Stats() (*Stats, error) {
+	var status insightInfo
+	if err := restGetJSON(i.Client, i.URL+"/status?q=getInfo", &status); err != nil {
+		return nil, err
+	}
+
+	return &Stats{Height: status.Info.Blocks, Difficulty: status.Info.Difficulty}, nil
+}
@@ -0,0 +1,242 @@
+package chain
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/fees"
+	"net/http"
+	"sync/atomic"
+	"time"
+)
+
+// RPC reads the chain from a node's JSON-RPC interface.
+type RPC struct {
+	URL      string
+	Username string
+	Password string
+
+	// defaults to http.DefaultClient
+	Client *http.Client
+
+	id int64
+}
+
+// NewRPC creates a backend for the node at url.
+func NewRPC(url, username, password string) *RPC {
+	return &RPC{URL: url, Username: username, Password: password}
+}
+
+// rpcError is an error returned by the node.
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string {
+	return fmt.Sprintf("rpc error %d: %s", e.Code, e.Message)
+}
+
+// the node's error codes for unknown blocks and transactions
+const (
+	rpcInvalidParameter    = -8
+	rpcInvalidAddressOrKey = -5
+)
+
+// Call invokes method on the node and decodes its result into result.
+func (r *RPC) Call(method string, result interface{}, params ...interface{}) error {
+	if params == nil {
+		params = []interface{}{}
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "1.0",
+		"id":      atomic.AddInt64(&r.id, 1),
+		"method":  method,
+		"params":  params,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", r.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.Username != "" || r.Password != "" {
+		req.SetBasicAuth(r.Username, r.Password)
+	}
+
+	client := r.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	// the node answers errors with a 500 and the error in the body
+	var response struct {
+		Result json.RawMessage `json:"result"`
+		Error  *rpcError       `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return fmt.Errorf("%s: %s (%s)", method, err, resp.Status)
+	}
+
+	if response.Error != nil {
+		if response.Error.Code == rpcInvalidParameter || response.Error.Code == rpcInvalidAddressOrKey {
+			return ErrNotFound
+		}
+		return response.Error
+	}
+
+	return json.Unmarshal(response.Result, result)
+}
+
+// BlockCount returns the height of the tip of the best chain.
+func (r *RPC) BlockCount() (int64, error) {
+	var count int64
+	err := r.Call("getblockcount", &count)
+	return count, err
+}
+
+// BlockHash returns the hash of the block at height on the best chain.
+func (r *RPC) BlockHash(height int64) (string, error) {
+	var hash string
+	err := r.Call("getblockhash", &hash, height)
+	return hash, err
+}
+
+// rpcBlock is the output of getblock with its transactions decoded.
+type rpcBlock struct {
+	Hash       string           `json:"hash"`
+	Height     int64            `json:"height"`
+	Time       int64            `json:"time"`
+	Difficulty float64          `json:"difficulty"`
+	Size       int              `json:"size"`
+	Tx         []rpcTransaction `json:"tx"`
+	PrevHash   string           `json:"previousblockhash"`
+}
+
+// rpcTransaction is a decoded transaction.
+type rpcTransaction struct {
+	Vin []struct {
+		Coinbase string `json:"coinbase"`
+	} `json:"vin"`
+	Vout []struct {
+		Value        float64 `json:"value"`
+		ScriptPubKey struct {
+			Addresses []string `json:"addresses"`
+		} `json:"scriptPubKey"`
+	} `json:"vout"`
+}
+
+// Block returns the block with the given hash, along with its coinbase transaction. The
+// transactions come decoded with the block, so the node doesn't need a transaction index.
+func (r *RPC) Block(hash string) (*Block, error) {
+	var raw rpcBlock
+	if err := r.Call("getblock", &raw, hash, 2); err != nil {
+		return nil, err
+	}
+
+	block := &Block{
+		Height:     raw.Height,
+		Hash:       raw.Hash,
+		PrevHash:   raw.PrevHash,
+		Time:       time.Unix(raw.Time, 0).UTC(),
+		Difficulty: raw.Difficulty,
+		TxCount:    len(raw.Tx),
+		Size:       raw.Size,
+	}
+
+	if len(raw.Tx) == 0 {
+		return block, nil
+	}
+
+	coinbase := raw.Tx[0]
+	if len(coinbase.Vin) > 0 {
+		block.CoinbaseScript, _ = hex.DecodeString(coinbase.Vin[0].Coinbase)
+	}
+	for _, out := range coinbase.Vout {
+		block.CoinbaseValue += out.Value
+		block.PayoutAddresses = append(block.PayoutAddresses, out.ScriptPubKey.Addresses...)
+	}
+
+	return block, nil
+}
+
+// Mempool is the transactions a node has waiting to be mined.
+type Mempool struct {
+	Count int
+	Bytes int64
+
+	// the lowest fee rate the node accepts, in coins per kilobyte
+	MinFee float64
+
+	Txs []fees.Tx
+}
+
+// rpcMempoolEntry is a transaction in the verbose output of getrawmempool. Newer nodes
+// report virtual size and move the fee into fees.
+type rpcMempoolEntry struct {
+	Size  int     `json:"size"`
+	VSize int     `json:"vsize"`
+	Fee   float64 `json:"fee"`
+	Fees  struct {
+		Base float64 `json:"base"`
+	} `json:"fees"`
+}
+
+// Mempool returns the node's mempool along with the size and fee of every transaction in it.
+func (r *RPC) Mempool() (*Mempool, error) {
+	var info struct {
+		Size          int     `json:"size"`
+		Bytes         int64   `json:"bytes"`
+		MempoolMinFee float64 `json:"mempoolminfee"`
+	}
+	if err := r.Call("getmempoolinfo", &info); err != nil {
+		return nil, err
+	}
+
+	var entries map[string]rpcMempoolEntry
+	if err := r.Call("getrawmempool", &entries, true); err != nil {
+		return nil, err
+	}
+
+	mempool := &Mempool{Count: info.Size, Bytes: info.Bytes, MinFee: info.MempoolMinFee, Txs: make([]fees.Tx, 0, len(entries))}
+	for _, entry := range entries {
+		tx := fees.Tx{Size: entry.Size, Fee: entry.Fee}
+		if entry.VSize > 0 {
+			tx.Size = entry.VSize
+		}
+		if entry.Fees.Base > 0 {
+			tx.Fee = entry.Fees.Base
+		}
+		mempool.Txs = append(mempool.Txs, tx)
+	}
+
+	return mempool, nil
+}
+
+// Stats returns the height, difficulty and hashrate the node reports. Working out the
+// supply means scanning the whole utxo set, so it isn't reported.
+func (r *RPC) Stats() (*Stats, error) {
+	stats := &Stats{}
+	if err := r.Call("getblockcount", &stats.Height); err != nil {
+		return nil, err
+	}
+	if err := r.Call("getdifficulty", &stats.Difficulty); err != nil {
+		return nil, err
+	}
+	if err := r.Call("getnetworkhashps", &stats.HashRate); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,121 @@
+package chain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+// Stats is what a backend reports about the network.
+type Stats struct {
+	Height     int64
+	Difficulty float64
+
+	// hashes per second, 0 if the backend doesn't report it
+	HashRate float64
+
+	// coins mined so far, 0 if the backend doesn't report it
+	Supply float64
+}
+
+// StatsBackend is a source of network stats, like a node or a block explorer.
+type StatsBackend interface {
+	Stats() (*Stats, error)
+}
+
+// Failover asks every backend for stats and returns those of the first one, in order,
+// that answered and isn't more than maxLag blocks behind the highest height reported.
+// The errors line up with the backends and say why each one that came before the chosen
+// one was skipped. No stats are returned if every backend failed.
+func Failover(backends []StatsBackend, maxLag int64) (*Stats, []error) {
+	reports := make([]*Stats, len(backends))
+	errs := make([]error, len(backends))
+	highest := int64(0)
+	for i, backend := range backends {
+		reports[i], errs[i] = backend.Stats()
+		if errs[i] == nil && reports[i].Height > highest {
+			highest = reports[i].Height
+		}
+	}
+
+	for i, stats := range reports {
+		if errs[i] != nil {
+			continue
+		}
+
+		if highest-stats.Height > maxLag {
+			errs[i] = fmt.Errorf("at height %d, %d blocks behind", stats.Height, highest-stats.Height)
+			continue
+		}
+
+		for j := i + 1; j < len(errs); j++ {
+			errs[j] = nil
+		}
+		return stats, errs
+	}
+
+	return nil, errs
+}
+
+// DifficultyFromBits works out the difficulty of a block from the compact target in its
+// header, the same way the reference client's getdifficulty does.
+func DifficultyFromBits(bits uint32) float64 {
+	shift := (bits >> 24) & 0xff
+	difficulty := float64(0x0000ffff) / float64(bits&0x00ffffff)
+
+	for ; shift < 29; shift++ {
+		difficulty *= 256
+	}
+	for ; shift > 29; shift-- {
+		difficulty /= 256
+	}
+
+	return difficulty
+}
+
+// errRESTNotFound is returned when an explorer answers with a 404.
+var errRESTNotFound = errors.New("not found")
+
+// restGet fetches url with client, or http.DefaultClient if it's nil, and returns the body
+// of a successful response.
+func restGet(client *http.Client, url string) ([]byte, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, errRESTNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s %s", url, resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	return body, nil
+}
+
+// restGetJSON fetches url and decodes the JSON it answers with into result.
+func restGetJSON(client *http.Client, url string, result interface{}) error {
+	body, err := restGet(client, url)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(body, result); err != nil {
+		return fmt.Errorf("%s: %s", url, err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+package charts
+
+import (
+	"math"
+	"time"
+)
+
+// Point is a single value in a series.
+type Point struct {
+	Time  time.Time
+	Value float64
+}
+
+// Options controls how a chart is drawn.
+type Options struct {
+	Width  int
+	Height int
+	Theme  Theme
+
+	// a sparkline is only the line, without a grid or labels
+	Sparkline bool
+
+	// formats the high and low values shown on the chart
+	Format func(float64) string
+}
+
+// padding around the plot, in pixels
+const (
+	sparklinePadding = 2
+	chartPadding     = 6
+)
+
+// layout maps points in a series onto pixel coordinates.
+type layout struct {
+	left, top, width, height float64
+
+	minTime, maxTime   float64
+	minValue, maxValue float64
+
+	// the lowest and highest values actually in the series
+	low, high float64
+}
+
+// newLayout works out the bounds of a series drawn with opts.
+func newLayout(points []Point, opts Options) *layout {
+	padding := float64(chartPadding)
+	if opts.Sparkline {
+		padding = sparklinePadding
+	}
+
+	l := &layout{
+		left:     padding,
+		top:      padding,
+		width:    math.Max(float64(opts.Width)-padding*2, 1),
+		height:   math.Max(float64(opts.Height)-padding*2, 1),
+		minTime:  math.Inf(1),
+		maxTime:  math.Inf(-1),
+		minValue: math.Inf(1),
+		maxValue: math.Inf(-1),
+	}
+
+	for _, p := range points {
+		t := float64(p.Time.Unix())
+		l.minTime = math.Min(l.minTime, t)
+		l.maxTime = math.Max(l.maxTime, t)
+		l.minValue = math.Min(l.minValue, p.Value)
+		l.maxValue = math.Max(l.maxValue, p.Value)
+	}
+
+	l.low, l.high = l.minValue, l.maxValue
+
+	// a flat series is drawn through the middle
+	if l.maxValue == l.minValue {
+		l.minValue--
+		l.maxValue++
+	}
+	if l.maxTime == l.minTime {
+		l.minTime--
+		l.maxTime++
+	}
+
+	return l
+}
+
+// position returns the pixel coordinates of a point.
+func (l *layout) position(p Point) (float64, float64) {
+	x := l.left + (float64(p.Time.Unix())-l.minTime)/(l.maxTime-l.minTime)*l.width
+	y := l.top + (l.maxValue-p.Value)/(l.maxValue-l.minValue)*l.height
+	return x, y
+}
+
+// bottom is the y coordinate of the bottom of the plot.
+func (l *layout) bottom() float64 {
+	return l.top + l.height
+}
+
+// Downsample reduces a series to at most n points by averaging runs of neighbouring
+// points, so a chart never has more points than it has pixels to draw them in.
+func Downsample(points []Point, n int) []Point {
+	if n <= 0 || len(points) <= n {
+		return points
+	}
+
+	sampled := make([]Point, 0, n)
+	for i := 0; i < n; i++ {
+		start := i * len(points) / n
+		end := (i + 1) * len(points) / n
+
+		var total float64
+		for _, p := range points[start:end] {
+			total += p.Value
+		}
+
+		middle := points[(start+end-1)/2]
+		sampled = append(sampled, Point{Time: middle.Time, Value: total / float64(end-start)})
+	}
+
+	return sampled
+}
+
+// cleanPoints drops values that can't be drawn.
+func cleanPoints(points []Point) []Point {
+	cleaned := make([]Point, 0, len(points))
+	for _, p := range points {
+		if !math.IsNaN(p.Value) && !math.IsInf(p.Value, 0) {
+			cleaned = append(cleaned, p)
+		}
+	}
+
+	return cleaned
+}
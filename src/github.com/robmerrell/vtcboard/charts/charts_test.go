@@ -0,0 +1,117 @@
+package charts
+
+import (
+	"bytes"
+	"image/png"
+	. "launchpad.net/gocheck"
+	"math"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type chartsSuite struct{}
+
+var _ = Suite(&chartsSuite{})
+
+func testPoints(values ...float64) []Point {
+	start := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	points := []Point{}
+	for i, value := range values {
+		points = append(points, Point{Time: start.Add(time.Duration(i) * time.Hour), Value: value})
+	}
+
+	return points
+}
+
+func testOptions() Options {
+	return Options{
+		Width:  200,
+		Height: 100,
+		Theme:  Themes["light"],
+		Format: func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) },
+	}
+}
+
+func (s *chartsSuite) TestLayout(c *C) {
+	l := newLayout(testPoints(10, 20), testOptions())
+
+	x, y := l.position(testPoints(10)[0])
+	c.Check(x, Equals, float64(chartPadding))
+	c.Check(y, Equals, float64(100-chartPadding))
+
+	x, y = l.position(testPoints(10, 20)[1])
+	c.Check(x, Equals, float64(200-chartPadding))
+	c.Check(y, Equals, float64(chartPadding))
+}
+
+func (s *chartsSuite) TestFlatSeriesIsCentered(c *C) {
+	l := newLayout(testPoints(5, 5, 5), testOptions())
+
+	_, y := l.position(testPoints(5)[0])
+	c.Check(y, Equals, float64(50))
+	c.Check(l.low, Equals, float64(5))
+	c.Check(l.high, Equals, float64(5))
+}
+
+func (s *chartsSuite) TestDownsample(c *C) {
+	sampled := Downsample(testPoints(1, 3, 5, 7, 9, 11), 3)
+
+	c.Assert(len(sampled), Equals, 3)
+	c.Check(sampled[0].Value, Equals, float64(2))
+	c.Check(sampled[1].Value, Equals, float64(6))
+	c.Check(sampled[2].Value, Equals, float64(10))
+
+	c.Check(len(Downsample(testPoints(1, 2), 10)), Equals, 2)
+}
+
+func (s *chartsSuite) TestSVG(c *C) {
+	svg := SVG(testPoints(1, 2, math.NaN(), 3), testOptions())
+
+	c.Check(strings.HasPrefix(svg, "<svg"), Equals, true)
+	c.Check(strings.Count(svg, "<polyline"), Equals, 1)
+	c.Check(strings.Count(svg, "<text"), Equals, 2)
+	c.Check(strings.Contains(svg, "NaN"), Equals, false)
+}
+
+func (s *chartsSuite) TestSVGSparkline(c *C) {
+	opts := testOptions()
+	opts.Sparkline = true
+	svg := SVG(testPoints(1, 2, 3), opts)
+
+	c.Check(strings.Contains(svg, "<text"), Equals, false)
+	c.Check(strings.Contains(svg, "<line"), Equals, false)
+}
+
+func (s *chartsSuite) TestSVGWithoutData(c *C) {
+	svg := SVG(nil, testOptions())
+	c.Check(strings.Contains(svg, "No data"), Equals, true)
+}
+
+func (s *chartsSuite) TestPNG(c *C) {
+	data, err := PNG(testPoints(1, 3, 2), testOptions())
+	c.Assert(err, IsNil)
+
+	img, err := png.Decode(bytes.NewReader(data))
+	c.Assert(err, IsNil)
+	c.Check(img.Bounds().Dx(), Equals, 200)
+	c.Check(img.Bounds().Dy(), Equals, 100)
+
+	// the line starts at the bottom left of the plot
+	r, g, b, _ := img.At(chartPadding, 100-chartPadding).RGBA()
+	line := Themes["light"].Line
+	c.Check([]uint32{r >> 8, g >> 8, b >> 8}, DeepEquals, []uint32{uint32(line.R), uint32(line.G), uint32(line.B)})
+}
+
+func (s *chartsSuite) TestText(c *C) {
+	c.Check(Text(testPoints(0, 7, 14), 10, false), Equals, "▁▄█")
+	c.Check(Text(testPoints(0, 7, 14), 10, true), Equals, "_:#")
+	c.Check(Text(testPoints(3, 3), 10, true), Equals, "==")
+	c.Check(Text(testPoints(1, 3, 5, 7), 2, true), Equals, "_#")
+	c.Check(Text(nil, 10, false), Equals, "")
+}
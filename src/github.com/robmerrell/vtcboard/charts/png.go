@@ -0,0 +1,143 @@
+package charts
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"math"
+)
+
+// PNG draws a series as a PNG image.
+func PNG(points []Point, opts Options) ([]byte, error) {
+	points = cleanPoints(points)
+	l := newLayout(points, opts)
+	theme := opts.Theme
+
+	img := image.NewRGBA(image.Rect(0, 0, opts.Width, opts.Height))
+	draw.Draw(img, img.Bounds(), &image.Uniform{theme.Background}, image.Point{}, draw.Src)
+
+	if len(points) > 0 {
+		if !opts.Sparkline {
+			for i := 0; i <= 3; i++ {
+				y := int(l.top + l.height*float64(i)/3)
+				for x := int(l.left); x < int(l.left+l.width); x++ {
+					blend(img, x, y, theme.Grid)
+				}
+			}
+		}
+
+		// shade the area under the line one column at a time
+		for i := 1; i < len(points); i++ {
+			x1, y1 := l.position(points[i-1])
+			x2, y2 := l.position(points[i])
+			last := i == len(points)-1
+			for x := math.Ceil(x1); x < x2 || (last && x <= x2); x++ {
+				y := y1
+				if x2 > x1 {
+					y += (y2 - y1) * (x - x1) / (x2 - x1)
+				}
+				for fy := math.Ceil(y); fy <= l.bottom(); fy++ {
+					blend(img, int(x), int(fy), theme.Fill)
+				}
+			}
+		}
+
+		for i := 1; i < len(points); i++ {
+			x1, y1 := l.position(points[i-1])
+			x2, y2 := l.position(points[i])
+			drawLine(img, x1, y1, x2, y2, theme.Line)
+		}
+		if len(points) == 1 {
+			x, y := l.position(points[0])
+			drawLine(img, x, y, x, y, theme.Line)
+		}
+
+		if !opts.Sparkline && opts.Format != nil {
+			drawText(img, int(l.left)+2, int(l.top)+2, opts.Format(l.high), theme.Text)
+			drawText(img, int(l.left)+2, int(l.bottom())-2-glyphHeight*glyphScale, opts.Format(l.low), theme.Text)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// drawLine draws a line about two pixels wide between two points.
+func drawLine(img *image.RGBA, x1, y1, x2, y2 float64, c color.RGBA) {
+	steps := math.Max(math.Max(math.Abs(x2-x1), math.Abs(y2-y1)), 1)
+	for i := 0.0; i <= steps; i++ {
+		x := int(math.Round(x1 + (x2-x1)*i/steps))
+		y := int(math.Round(y1 + (y2-y1)*i/steps))
+		for _, offset := range [][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+			img.SetRGBA(x+offset[0], y+offset[1], c)
+		}
+	}
+}
+
+// blend draws c over the pixel at x, y using its alpha.
+func blend(img *image.RGBA, x, y int, c color.RGBA) {
+	if !(image.Point{x, y}.In(img.Bounds())) {
+		return
+	}
+
+	under := img.RGBAAt(x, y)
+	alpha := float64(c.A) / 255
+	mix := func(top, bottom uint8) uint8 {
+		return uint8(float64(top)*alpha + float64(bottom)*(1-alpha))
+	}
+
+	img.SetRGBA(x, y, color.RGBA{mix(c.R, under.R), mix(c.G, under.G), mix(c.B, under.B), 0xff})
+}
+
+// glyphs is a tiny bitmap font covering what numeric labels need. Characters without a
+// glyph are drawn as a space.
+var glyphs = map[rune][glyphHeight]string{
+	'0': {"###", "#.#", "#.#", "#.#", "###"},
+	'1': {".#.", "##.", ".#.", ".#.", "###"},
+	'2': {"###", "..#", "###", "#..", "###"},
+	'3': {"###", "..#", "###", "..#", "###"},
+	'4': {"#.#", "#.#", "###", "..#", "..#"},
+	'5': {"###", "#..", "###", "..#", "###"},
+	'6': {"###", "#..", "###", "#.#", "###"},
+	'7': {"###", "..#", ".#.", ".#.", ".#."},
+	'8': {"###", "#.#", "###", "#.#", "###"},
+	'9': {"###", "#.#", "###", "..#", "###"},
+	'.': {"...", "...", "...", "...", ".#."},
+	',': {"...", "...", "...", ".#.", "#.."},
+	'-': {"...", "...", "###", "...", "..."},
+	'%': {"#.#", "..#", ".#.", "#..", "#.#"},
+	'$': {".##", "##.", ".#.", ".##", "##."},
+}
+
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+	glyphScale  = 2
+)
+
+// drawText draws text with its top left corner at x, y.
+func drawText(img *image.RGBA, x, y int, text string, c color.RGBA) {
+	for _, r := range text {
+		for row, line := range glyphs[r] {
+			for col, pixel := range line {
+				if pixel != '#' {
+					continue
+				}
+
+				for dy := 0; dy < glyphScale; dy++ {
+					for dx := 0; dx < glyphScale; dx++ {
+						blend(img, x+col*glyphScale+dx, y+row*glyphScale+dy, c)
+					}
+				}
+			}
+		}
+
+		x += (glyphWidth + 1) * glyphScale
+	}
+}
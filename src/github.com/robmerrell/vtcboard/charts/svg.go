@@ -0,0 +1,54 @@
+package charts
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+)
+
+// SVG draws a series as an SVG image.
+func SVG(points []Point, opts Options) string {
+	points = cleanPoints(points)
+	l := newLayout(points, opts)
+	theme := opts.Theme
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d">`, opts.Width, opts.Height, opts.Width, opts.Height)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, hex(theme.Background))
+
+	if len(points) == 0 {
+		if !opts.Sparkline {
+			fmt.Fprintf(&buf, `<text x="50%%" y="50%%" text-anchor="middle" font-family="sans-serif" font-size="11" fill="%s">No data</text>`, hex(theme.Text))
+		}
+		buf.WriteString("</svg>")
+		return buf.String()
+	}
+
+	if !opts.Sparkline {
+		for i := 0; i <= 3; i++ {
+			y := l.top + l.height*float64(i)/3
+			fmt.Fprintf(&buf, `<line x1="%.1f" y1="%.1f" x2="%.1f" y2="%.1f" stroke="%s" stroke-width="1"/>`, l.left, y, l.left+l.width, y, hex(theme.Grid))
+		}
+	}
+
+	line := ""
+	for _, p := range points {
+		x, y := l.position(p)
+		line += fmt.Sprintf("%.1f,%.1f ", x, y)
+	}
+
+	firstX, _ := l.position(points[0])
+	lastX, _ := l.position(points[len(points)-1])
+	fill := fmt.Sprintf("%.1f,%.1f %s%.1f,%.1f", firstX, l.bottom(), line, lastX, l.bottom())
+
+	fmt.Fprintf(&buf, `<polygon points="%s" fill="%s" fill-opacity="%s"/>`, fill, hex(theme.Fill), opacity(theme.Fill))
+	fmt.Fprintf(&buf, `<polyline points="%s" fill="none" stroke="%s" stroke-width="1.5" stroke-linejoin="round"/>`, line[:len(line)-1], hex(theme.Line))
+
+	if !opts.Sparkline && opts.Format != nil {
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" font-family="sans-serif" font-size="11" fill="%s">%s</text>`, l.left+2, l.top+11, hex(theme.Text), html.EscapeString(opts.Format(l.high)))
+		fmt.Fprintf(&buf, `<text x="%.1f" y="%.1f" font-family="sans-serif" font-size="11" fill="%s">%s</text>`, l.left+2, l.bottom()-3, hex(theme.Text), html.EscapeString(opts.Format(l.low)))
+	}
+
+	buf.WriteString("</svg>")
+	return buf.String()
+}
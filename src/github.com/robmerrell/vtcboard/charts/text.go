@@ -0,0 +1,43 @@
+package charts
+
+import (
+	"math"
+)
+
+// sparkline characters from lowest to highest
+var (
+	unicodeLevels = []rune("▁▂▃▄▅▆▇█")
+	asciiLevels   = []rune("_.-:=+*#")
+)
+
+// Text draws a series as a one line sparkline of at most width characters, using block
+// characters or plain ASCII for terminals that can't show them.
+func Text(points []Point, width int, ascii bool) string {
+	levels := unicodeLevels
+	if ascii {
+		levels = asciiLevels
+	}
+
+	points = Downsample(cleanPoints(points), width)
+	if len(points) == 0 {
+		return ""
+	}
+
+	low, high := math.Inf(1), math.Inf(-1)
+	for _, p := range points {
+		low = math.Min(low, p.Value)
+		high = math.Max(high, p.Value)
+	}
+
+	line := make([]rune, 0, len(points))
+	for _, p := range points {
+		// a flat series sits in the middle
+		level := len(levels) / 2
+		if high > low {
+			level = int((p.Value - low) / (high - low) * float64(len(levels)-1))
+		}
+		line = append(line, levels[level])
+	}
+
+	return string(line)
+}
@@ -0,0 +1,43 @@
+package charts
+
+import (
+	"fmt"
+	"image/color"
+)
+
+// Theme is the set of colors a chart is drawn with.
+type Theme struct {
+	Background color.RGBA
+	Line       color.RGBA
+	Fill       color.RGBA
+	Grid       color.RGBA
+	Text       color.RGBA
+}
+
+// Themes are the themes that can be picked by name.
+var Themes = map[string]Theme{
+	"light": {
+		Background: color.RGBA{0xff, 0xff, 0xff, 0xff},
+		Line:       color.RGBA{0x1b, 0x5e, 0x20, 0xff},
+		Fill:       color.RGBA{0x1b, 0x5e, 0x20, 0x30},
+		Grid:       color.RGBA{0xe0, 0xe0, 0xe0, 0xff},
+		Text:       color.RGBA{0x55, 0x55, 0x55, 0xff},
+	},
+	"dark": {
+		Background: color.RGBA{0x22, 0x22, 0x22, 0xff},
+		Line:       color.RGBA{0x66, 0xbb, 0x6a, 0xff},
+		Fill:       color.RGBA{0x66, 0xbb, 0x6a, 0x30},
+		Grid:       color.RGBA{0x3a, 0x3a, 0x3a, 0xff},
+		Text:       color.RGBA{0xcc, 0xcc, 0xcc, 0xff},
+	},
+}
+
+// hex returns a color as #rrggbb for use in SVG.
+func hex(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// opacity returns the alpha of a color between 0 and 1 for use in SVG.
+func opacity(c color.RGBA) string {
+	return fmt.Sprintf("%.2f", float64(c.A)/255)
+}
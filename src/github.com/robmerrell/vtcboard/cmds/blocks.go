@@ -0,0 +1,153 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/lib"
+	"github.com/robmerrell/vtcboard/models"
+	"labix.org/v2/mgo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// maxBlocksLimit caps how many blocks /api/blocks returns at once.
+const maxBlocksLimit = 100
+
+// blockInfo is a block as it's returned from the blocks api.
+type blockInfo struct {
+	Height          int64     `json:"height"`
+	Hash            string    `json:"hash"`
+	PrevHash        string    `json:"previousHash"`
+	Time            time.Time `json:"time"`
+	Difficulty      float64   `json:"difficulty"`
+	TxCount         int       `json:"txCount"`
+	Size            int       `json:"size"`
+	CoinbaseValue   float64   `json:"coinbaseValue"`
+	MinerTag        string    `json:"minerTag"`
+	PayoutAddresses []string  `json:"payoutAddresses"`
+}
+
+func newBlockInfo(block *models.Block) *blockInfo {
+	return &blockInfo{
+		Height:          block.Height,
+		Hash:            block.Hash,
+		PrevHash:        block.PrevHash,
+		Time:            block.Time,
+		Difficulty:      block.Difficulty,
+		TxCount:         block.TxCount,
+		Size:            block.Size,
+		CoinbaseValue:   block.CoinbaseValue,
+		MinerTag:        block.MinerTag,
+		PayoutAddresses: block.PayoutAddresses,
+	}
+}
+
+// blockRows formats blocks for the recent blocks table.
+func blockRows(blocks []*models.Block) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(blocks))
+	for _, block := range blocks {
+		miner := block.MinerTag
+		if miner == "" {
+			miner = "unknown"
+		}
+
+		rows = append(rows, map[string]interface{}{
+			"url":     fmt.Sprintf("/api/blocks/%d", block.Height),
+			"hash":    block.Hash,
+			"height":  lib.RenderInteger("", int(block.Height)),
+			"age":     humanizeAge(block.Time),
+			"txCount": block.TxCount,
+			"size":    fmt.Sprintf("%.1f kB", float64(block.Size)/1000),
+			"value":   strconv.FormatFloat(block.CoinbaseValue, 'f', -1, 64) + " VTC",
+			"miner":   miner,
+		})
+	}
+
+	return rows
+}
+
+// serveBlocks returns the most recent blocks as JSON from /api/blocks, newest first. The
+// limit query sets how many, up to maxBlocksLimit.
+func serveBlocks(pageCache *cache.Cache, res http.ResponseWriter, req *http.Request) {
+	limit := config.Get().Blocks.Recent
+	if raw := req.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed < 1 {
+			http.Error(res, "limit must be a positive number", http.StatusBadRequest)
+			return
+		}
+		limit = parsed
+	}
+	if limit > maxBlocksLimit {
+		limit = maxBlocksLimit
+	}
+
+	body, err := pageCache.Get(fmt.Sprintf("/api/blocks?limit=%d", limit), func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		blocks, err := models.GetRecentBlocks(conn, limit)
+		if err != nil {
+			return "", err
+		}
+
+		infos := make([]*blockInfo, 0, len(blocks))
+		for _, block := range blocks {
+			infos = append(infos, newBlockInfo(block))
+		}
+
+		body, err := json.Marshal(infos)
+		return string(body), err
+	})
+
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, body)
+}
+
+// serveBlock returns a single block as JSON from /api/blocks/:id, where the id is either
+// a height or a hash.
+func serveBlock(pageCache *cache.Cache, id string, res http.ResponseWriter, req *http.Request) {
+	body, err := pageCache.Get("/api/blocks/"+id, func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		var block *models.Block
+		var err error
+		if height, parseErr := strconv.ParseInt(id, 10, 64); parseErr == nil {
+			block, err = models.GetBlock(conn, height)
+		} else {
+			block, err = models.GetBlockByHash(conn, id)
+		}
+		if err != nil {
+			return "", err
+		}
+
+		body, err := json.Marshal(newBlockInfo(block))
+		return string(body), err
+	})
+
+	if err == mgo.ErrNotFound {
+		http.NotFound(res, req)
+		return
+	}
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, body)
+}
+
+// writeJSON writes a JSON api response that any site can read.
+func writeJSON(res http.ResponseWriter, body string) {
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Access-Control-Allow-Origin", "*")
+	res.Write([]byte(body))
+}
@@ -0,0 +1,237 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/charts"
+	"github.com/robmerrell/vtcboard/lib"
+	"github.com/robmerrell/vtcboard/models"
+	"math"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// chartBucket is how often chart images are regenerated. Averages are rolled up every
+// 10 minutes so a chart can't change any faster than that.
+const chartBucket = time.Minute * 10
+
+// chartWidths and chartHeights are the sizes charts are drawn at. Any other size asked for
+// is snapped to the nearest one so there are only so many images to cache.
+var (
+	chartWidths  = []int{40, 80, 120, 160, 200, 240, 300, 400, 500, 600, 800, 1000, 1200, 1600}
+	chartHeights = []int{16, 24, 32, 48, 64, 100, 150, 200, 250, 300, 400, 600, 800}
+)
+
+// chartRequest is a validated request for a chart image or its data.
+type chartRequest struct {
+	name   string
+	format string
+	metric string
+	rng    chartRange
+	theme  string
+	opts   charts.Options
+}
+
+// parseChartRequest reads the chart and format from the file name and everything else
+// from the query, using defaults for anything left out.
+func parseChartRequest(file string, query url.Values) (*chartRequest, error) {
+	r := &chartRequest{
+		name:   strings.TrimSuffix(file, path.Ext(file)),
+		format: strings.TrimPrefix(path.Ext(file), "."),
+	}
+
+	if r.format != "svg" && r.format != "png" && r.format != "json" {
+		return nil, fmt.Errorf("format must be svg, png or json")
+	}
+
+	get := func(key, def string) string {
+		if value := query.Get(key); value != "" {
+			return value
+		}
+		return def
+	}
+
+	switch r.name {
+	case "price":
+		r.metric = get("currency", "usd")
+		if r.metric != "usd" && r.metric != "btc" {
+			return nil, fmt.Errorf("currency must be usd or btc")
+		}
+	case "network":
+		r.metric = get("metric", "hashrate")
+		if r.metric != "hashrate" && r.metric != "difficulty" {
+			return nil, fmt.Errorf("metric must be hashrate or difficulty")
+		}
+	default:
+		return nil, fmt.Errorf("unknown chart %s", r.name)
+	}
+
+	var ok bool
+	if r.rng, ok = findChartRange(get("range", defaultChartRange)); !ok {
+		return nil, fmt.Errorf("range must be 1h, 24h, 7d, 30d, 1y or all")
+	}
+
+	r.theme = get("theme", "light")
+	if r.opts.Theme, ok = charts.Themes[r.theme]; !ok {
+		return nil, fmt.Errorf("theme must be light or dark")
+	}
+
+	style := get("style", "chart")
+	if style != "chart" && style != "sparkline" {
+		return nil, fmt.Errorf("style must be chart or sparkline")
+	}
+	r.opts.Sparkline = style == "sparkline"
+
+	size := func(key string, def int, sizes []int) (int, error) {
+		min, max := sizes[0], sizes[len(sizes)-1]
+		value, err := strconv.Atoi(get(key, strconv.Itoa(def)))
+		if err != nil || value < min || value > max {
+			return 0, fmt.Errorf("%s must be between %d and %d", key, min, max)
+		}
+		return snapSize(value, sizes), nil
+	}
+
+	var err error
+	if r.opts.Width, err = size("width", 400, chartWidths); err != nil {
+		return nil, err
+	}
+	if r.opts.Height, err = size("height", 150, chartHeights); err != nil {
+		return nil, err
+	}
+
+	switch r.metric {
+	case "usd":
+		r.opts.Format = func(v float64) string { return "$" + lib.RenderFloat("", v) }
+	case "btc":
+		r.opts.Format = func(v float64) string { return strconv.FormatFloat(v, 'f', 8, 64) }
+	default:
+		r.opts.Format = func(v float64) string { return lib.RenderFloat("#,###.", v) }
+	}
+
+	return r, nil
+}
+
+// snapSize returns the size closest to value.
+func snapSize(value int, sizes []int) int {
+	best := sizes[0]
+	for _, size := range sizes {
+		if math.Abs(float64(size-value)) < math.Abs(float64(best-value)) {
+			best = size
+		}
+	}
+	return best
+}
+
+// key identifies the image a request produces during a bucket.
+func (r *chartRequest) key(bucket time.Time) string {
+	return fmt.Sprintf("%s.%s?metric=%s&range=%s&theme=%s&sparkline=%t&size=%dx%d@%d",
+		r.name, r.format, r.metric, r.rng.name, r.theme, r.opts.Sparkline, r.opts.Width, r.opts.Height, bucket.Unix())
+}
+
+// points loads the series the chart shows, capped at limit points if it's set.
+func (r *chartRequest) points(conn *models.MgoConnection, limit int) ([]charts.Point, time.Duration, error) {
+	if r.name == "price" {
+		return priceHistory(conn, r.rng, r.metric, maxChartPoints(limit))
+	}
+
+	points, err := networkHistory(conn, r.rng, r.metric, maxChartPoints(limit))
+	return points, 0, err
+}
+
+// render draws the chart.
+func (r *chartRequest) render() (string, error) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	points, _, err := r.points(conn, r.opts.Width)
+	if err != nil {
+		return "", err
+	}
+
+	if r.format == "svg" {
+		return charts.SVG(points, r.opts), nil
+	}
+
+	image, err := charts.PNG(points, r.opts)
+	return string(image), err
+}
+
+// renderData returns the chart's points as JSON, with times in milliseconds for flot.
+func (r *chartRequest) renderData() (string, error) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	points, resolution, err := r.points(conn, 0)
+	if err != nil {
+		return "", err
+	}
+
+	data := make([][2]float64, 0, len(points))
+	for _, p := range points {
+		data = append(data, [2]float64{float64(p.Time.Unix()) * 1000, p.Value})
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"chart":      r.name,
+		"metric":     r.metric,
+		"range":      r.rng.name,
+		"resolution": int(resolution.Seconds()),
+		"points":     data,
+	})
+	return string(body), err
+}
+
+// serveChartData returns the points behind a chart as JSON, eg: /chart/price.json?range=7d.
+// It's cached with the pages since it changes whenever new data is written.
+func serveChartData(pageCache *cache.Cache, r *chartRequest, res http.ResponseWriter) {
+	body, err := pageCache.Get(fmt.Sprintf("/chart/%s.json?metric=%s&range=%s", r.name, r.metric, r.rng.name), r.renderData)
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	res.Header().Set("Content-Type", "application/json")
+	res.Header().Set("Access-Control-Allow-Origin", "*")
+	res.Write([]byte(body))
+}
+
+// serveChart renders price and network history as an image that can be embedded
+// anywhere, eg: /chart/price.png?range=7d&theme=dark, or as JSON. Images are cached for
+// the rest of the bucket they were generated in and clients are told to do the same.
+func serveChart(pageCache, chartCache *cache.Cache) martini.Handler {
+	return func(params martini.Params, res http.ResponseWriter, req *http.Request) {
+		r, err := parseChartRequest(params["file"], req.URL.Query())
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		if r.format == "json" {
+			serveChartData(pageCache, r, res)
+			return
+		}
+
+		bucket := time.Now().Truncate(chartBucket)
+		image, err := chartCache.Get(r.key(bucket), r.render)
+		if err != nil {
+			webError(err, res)
+			return
+		}
+
+		contentType := "image/png"
+		if r.format == "svg" {
+			contentType = "image/svg+xml"
+		}
+
+		maxAge := int(bucket.Add(chartBucket).Sub(time.Now()).Seconds())
+		res.Header().Set("Content-Type", contentType)
+		res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
+		res.Write([]byte(image))
+	}
+}
@@ -0,0 +1,157 @@
+package cmds
+
+import (
+	"github.com/robmerrell/vtcboard/charts"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"labix.org/v2/mgo"
+	"math"
+	"strconv"
+	"time"
+)
+
+// chartRange is a span of history a chart can show.
+type chartRange struct {
+	name  string
+	title string
+
+	// how far back the chart goes, 0 for everything
+	duration time.Duration
+
+	// flot time format for the x axis
+	timeFormat string
+}
+
+var chartRanges = []chartRange{
+	{"1h", "1 HOUR", time.Hour, "%I:%M%p"},
+	{"24h", "24 HOURS", time.Hour * 24, "%I%p"},
+	{"7d", "7 DAYS", time.Hour * 24 * 7, "%b %d"},
+	{"30d", "30 DAYS", time.Hour * 24 * 30, "%b %d"},
+	{"1y", "1 YEAR", time.Hour * 24 * 365, "%b %Y"},
+	{"all", "ALL TIME", 0, "%b %Y"},
+}
+
+const defaultChartRange = "24h"
+
+// findChartRange returns the range with the given name.
+func findChartRange(name string) (chartRange, bool) {
+	for _, r := range chartRanges {
+		if r.name == name {
+			return r, true
+		}
+	}
+
+	return chartRange{}, false
+}
+
+// chartResolutions are the rollups a chart can be drawn from, finest first.
+var chartResolutions = []time.Duration{
+	time.Minute * 10,
+	time.Hour,
+	time.Hour * 6,
+	time.Hour * 24,
+	time.Hour * 24 * 7,
+}
+
+// pickResolution returns the finest resolution that covers span in at most maxPoints
+// points, or the coarsest one if none of them do.
+func pickResolution(span time.Duration, maxPoints int) time.Duration {
+	for _, resolution := range chartResolutions {
+		if int(span/resolution) <= maxPoints {
+			return resolution
+		}
+	}
+
+	return chartResolutions[len(chartResolutions)-1]
+}
+
+// start returns the time the range begins at. For all of history that's the oldest average.
+func (r chartRange) start(conn *models.MgoConnection) (time.Time, error) {
+	if r.duration != 0 {
+		return time.Now().UTC().Add(-r.duration), nil
+	}
+
+	first, err := models.GetFirstAverage(conn)
+	if err == mgo.ErrNotFound {
+		return time.Now().UTC(), nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return first.TimeBlock, nil
+}
+
+// priceHistory returns the prices over a range in the given currency, rolled up so
+// there are no more than maxPoints of them, along with the resolution that was used.
+func priceHistory(conn *models.MgoConnection, r chartRange, currency string, maxPoints int) ([]charts.Point, time.Duration, error) {
+	start, err := r.start(conn)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resolution := pickResolution(time.Now().UTC().Sub(start), maxPoints)
+	averages, err := models.GetAveragesSince(conn, start.Truncate(resolution), resolution)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// the latest prices haven't been rolled up yet
+	if resolution == chartResolutions[0] {
+		if averages, err = addLatestPricesToAverages(conn, averages); err != nil {
+			return nil, 0, err
+		}
+	}
+
+	// older rollups of windows without prices stored NaN, which would spread to the
+	// rest of their bucket when downsampled
+	points := []charts.Point{}
+	for _, average := range averages {
+		value := average.Cryptsy.Usd
+		if currency == "btc" {
+			value = average.Cryptsy.Btc
+		}
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			points = append(points, charts.Point{Time: average.TimeBlock, Value: value})
+		}
+	}
+
+	return charts.Downsample(points, maxPoints), resolution, nil
+}
+
+// networkHistory returns a network metric over a range, averaged down to no more than
+// maxPoints points.
+func networkHistory(conn *models.MgoConnection, r chartRange, metric string, maxPoints int) ([]charts.Point, error) {
+	since := time.Time{}
+	if r.duration != 0 {
+		since = time.Now().UTC().Add(-r.duration)
+	}
+
+	snapshots, err := models.GetNetworkSnapshotsSince(conn, since)
+	if err != nil {
+		return nil, err
+	}
+
+	points := []charts.Point{}
+	for _, snapshot := range snapshots {
+		raw := snapshot.HashRate
+		if metric == "difficulty" {
+			raw = snapshot.Difficulty
+		}
+		if value, err := strconv.ParseFloat(raw, 64); err == nil {
+			points = append(points, charts.Point{Time: snapshot.GeneratedAt, Value: value})
+		}
+	}
+
+	return charts.Downsample(points, maxPoints), nil
+}
+
+// maxChartPoints returns the most points a chart can have, capped at limit if it's set.
+func maxChartPoints(limit int) int {
+	maxPoints := config.Get().Chart.MaxPoints
+	if limit > 0 && limit < maxPoints {
+		return limit
+	}
+
+	return maxPoints
+}
@@ -0,0 +1,343 @@
+package cmds
+
+import (
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/emission"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/profit"
+	. "launchpad.net/gocheck"
+	"math"
+	"net/http"
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+// ------------
+// Locked runs
+// ------------
+type lockSuite struct{}
+
+var _ = Suite(&lockSuite{})
+
+func (s *lockSuite) SetUpTest(c *C) {
+	config.LoadConfig("test")
+	settings := *config.Get()
+	settings.Lock.TTL = 1
+	config.Use(&settings)
+
+	models.ConnectToDB(config.Get().Database)
+	models.DropCollections()
+}
+
+func (s *lockSuite) TestLosingTheLeaseStopsTheAction(c *C) {
+	stopped := false
+	run := RunLocked("updater", func(lost <-chan bool) error {
+		// another host takes over partway through
+		conn := models.CloneConnection()
+		defer conn.Close()
+		models.ReleaseLock(conn, "updater", lockOwner())
+		models.AcquireLock(conn, "updater", "other-host", time.Minute)
+
+		select {
+		case <-lost:
+			stopped = true
+		case <-time.After(time.Second * 2):
+		}
+		return nil
+	})
+
+	c.Check(run(), ErrorMatches, "lost the lease on updater .*")
+	c.Check(stopped, Equals, true)
+
+	// the lease stays with the host that took it
+	conn := models.CloneConnection()
+	defer conn.Close()
+	lock, _ := models.GetLock(conn, "updater")
+	c.Check(lock.Owner, Equals, "other-host")
+}
+
+func (s *lockSuite) TestOnlyTheHolderRuns(c *C) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+	models.AcquireLock(conn, "updater", "other-host", time.Minute)
+
+	ran := false
+	err := RunLocked("updater", Unstoppable(func() error {
+		ran = true
+		return nil
+	}))()
+	c.Check(err, IsNil)
+	c.Check(ran, Equals, false)
+}
+
+// -------------
+// Chart request
+// -------------
+type chartRequestSuite struct{}
+
+var _ = Suite(&chartRequestSuite{})
+
+func (s *chartRequestSuite) TestParsing(c *C) {
+	tests := []struct {
+		file, query   string
+		name, metric  string
+		rng           string
+		width, height int
+		sparkline     bool
+	}{
+		{"price.png", "", "price", "usd", defaultChartRange, 400, 150, false},
+		{"price.svg", "currency=btc&range=7d&style=sparkline", "price", "btc", "7d", 400, 150, true},
+		{"network.json", "metric=difficulty&theme=dark", "network", "difficulty", defaultChartRange, 400, 150, false},
+		{"network.png", "width=1600&height=16", "network", "hashrate", defaultChartRange, 1600, 16, false},
+
+		// sizes in between are snapped to the nearest one charts are drawn at
+		{"price.png", "width=413&height=149", "price", "usd", defaultChartRange, 400, 150, false},
+		{"price.png", "width=41&height=799", "price", "usd", defaultChartRange, 40, 800, false},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		r, err := parseChartRequest(test.file, query)
+		c.Assert(err, IsNil, Commentf("%s?%s", test.file, test.query))
+
+		c.Check(r.name, Equals, test.name)
+		c.Check(r.metric, Equals, test.metric)
+		c.Check(r.rng.name, Equals, test.rng)
+		c.Check(r.opts.Width, Equals, test.width)
+		c.Check(r.opts.Height, Equals, test.height)
+		c.Check(r.opts.Sparkline, Equals, test.sparkline)
+	}
+}
+
+func (s *chartRequestSuite) TestInvalidRequests(c *C) {
+	tests := []struct {
+		file, query, err string
+	}{
+		{"price.gif", "", "format must be .*"},
+		{"supply.png", "", "unknown chart supply"},
+		{"price.png", "currency=eur", "currency must be .*"},
+		{"network.png", "metric=price", "metric must be .*"},
+		{"price.png", "range=2d", "range must be .*"},
+		{"price.png", "theme=blue", "theme must be .*"},
+		{"price.png", "style=bars", "style must be .*"},
+		{"price.png", "width=39", "width must be between 40 and 1600"},
+		{"price.png", "width=wide", "width must be between 40 and 1600"},
+		{"price.png", "height=801", "height must be between 16 and 800"},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		_, err := parseChartRequest(test.file, query)
+		c.Check(err, ErrorMatches, test.err, Commentf("%s?%s", test.file, test.query))
+	}
+}
+
+func (s *chartRequestSuite) TestSizesAreSnapped(c *C) {
+	c.Check(snapSize(1, chartWidths), Equals, 40)
+	c.Check(snapSize(95, chartWidths), Equals, 80)
+	c.Check(snapSize(101, chartWidths), Equals, 120)
+	c.Check(snapSize(5000, chartHeights), Equals, 800)
+}
+
+// ----------
+// Chart data
+// ----------
+type chartDataSuite struct{}
+
+var _ = Suite(&chartDataSuite{})
+
+func (s *chartDataSuite) SetUpTest(c *C) {
+	config.LoadConfig("test")
+	models.ConnectToDB(config.Get().Database)
+	models.DropCollections()
+}
+
+func (s *chartDataSuite) TestEmptyWindowsAreSkipped(c *C) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	// an empty window rolled up before averages of nothing were left out
+	start := time.Now().UTC().Truncate(time.Minute * 10).Add(time.Hour * -2)
+	for i, usd := range []float64{1, math.NaN(), 3} {
+		a := &models.Average{TimeBlock: start.Add(time.Minute * 10 * time.Duration(i)), Cryptsy: &models.ExchangeAverage{Usd: usd}}
+		a.Insert(conn)
+	}
+
+	rng, _ := findChartRange("24h")
+	points, _, err := priceHistory(conn, rng, "usd", 100)
+	c.Assert(err, IsNil)
+	c.Check(len(points), Equals, 2)
+
+	query, _ := url.ParseQuery("")
+	r, err := parseChartRequest("price.json", query)
+	c.Assert(err, IsNil)
+	body, err := r.renderData()
+	c.Check(err, IsNil)
+	c.Check(body, Matches, `.*"points":\[\[.*`)
+}
+
+// --------------
+// Widget options
+// --------------
+type widgetOptionsSuite struct{}
+
+var _ = Suite(&widgetOptionsSuite{})
+
+func (s *widgetOptionsSuite) TestParsing(c *C) {
+	tests := []struct {
+		query string
+		want  widgetOptions
+	}{
+		{"", widgetOptions{currency: "usd", theme: "light", width: 200}},
+		{"currency=btc&theme=dark&sparkline=1&width=120", widgetOptions{currency: "btc", theme: "dark", sparkline: true, width: 120}},
+		{"sparkline=true&width=600", widgetOptions{currency: "usd", theme: "light", sparkline: true, width: 600}},
+		{"sparkline=yes", widgetOptions{currency: "usd", theme: "light", width: 200}},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		o, err := parseWidgetOptions(query)
+		c.Assert(err, IsNil, Commentf(test.query))
+		c.Check(*o, Equals, test.want, Commentf(test.query))
+	}
+}
+
+func (s *widgetOptionsSuite) TestInvalidOptions(c *C) {
+	tests := []struct {
+		query, err string
+	}{
+		{"currency=eur", "currency must be .*"},
+		{"theme=blue", "theme must be .*"},
+		{"width=119", "width must be between 120 and 600"},
+		{"width=601", "width must be between 120 and 600"},
+		{"width=wide", "width must be between 120 and 600"},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		_, err := parseWidgetOptions(query)
+		c.Check(err, ErrorMatches, test.err, Commentf(test.query))
+	}
+}
+
+// ------------
+// Text options
+// ------------
+type textOptionsSuite struct{}
+
+var _ = Suite(&textOptionsSuite{})
+
+func (s *textOptionsSuite) TestParsing(c *C) {
+	tests := []struct {
+		userAgent, query string
+		want             textOptions
+	}{
+		{"curl/7.35.0", "", textOptions{color: true}},
+		{"Wget/1.15", "", textOptions{}},
+		{"curl/7.35.0", "color=0", textOptions{}},
+		{"curl/7.35.0", "color=false&ascii=1", textOptions{ascii: true}},
+		{"Wget/1.15", "color=1&ascii=true", textOptions{color: true, ascii: true}},
+		{"Wget/1.15", "color=maybe", textOptions{}},
+	}
+
+	for _, test := range tests {
+		req, err := http.NewRequest("GET", "/?"+test.query, nil)
+		c.Assert(err, IsNil)
+		req.Header.Set("User-Agent", test.userAgent)
+
+		c.Check(parseTextOptions(req), Equals, test.want, Commentf("%s %s", test.userAgent, test.query))
+	}
+}
+
+func (s *textOptionsSuite) TestPlainText(c *C) {
+	tests := []struct {
+		text, want string
+	}{
+		{"Vertcoin hits a new high", "Vertcoin hits a new high"},
+		{"Über ünïcode ✓", "Über ünïcode ✓"},
+		{"\x1b[2J\x1b[31mcleared\x1b[0m", "[2J[31mcleared[0m"},
+		{"bell\a tab\t newline\n delete\x7f", "bell tab newline delete"},
+		{"csi\u009b31m", "csi31m"},
+	}
+
+	for _, test := range tests {
+		c.Check(plainText(test.text), Equals, test.want)
+	}
+}
+
+// ------
+// Supply
+// ------
+type supplySuite struct{}
+
+var _ = Suite(&supplySuite{})
+
+func (s *supplySuite) TestUnreportedSupplyIsntCompared(c *C) {
+	info, ok := networkSupply(&models.Network{BlockCount: "100000"}, 0)
+	c.Assert(ok, Equals, true)
+	c.Check(info.Supply, Equals, emission.Vertcoin.SupplyAt(100000))
+	c.Check(info.Reported, Equals, float64(0))
+	c.Check(info.Discrepancy, Equals, float64(0))
+
+	info, _ = networkSupply(&models.Network{BlockCount: "100000", Mined: "1"}, 0)
+	c.Check(info.Reported, Equals, float64(1))
+	c.Check(info.Discrepancy < -0.99, Equals, true)
+}
+
+// ---------------
+// Profit requests
+// ---------------
+type profitRequestSuite struct{}
+
+var _ = Suite(&profitRequestSuite{})
+
+func (s *profitRequestSuite) TestParsing(c *C) {
+	tests := []struct {
+		query    string
+		rig      profit.Rig
+		rng      string
+		hashrate float64
+		unit     string
+	}{
+		{"hashrate=10", profit.Rig{Hashrate: 10e6, Cost: 0.1, Fee: 0.01}, defaultProfitRange, 10, "mh"},
+		{"hashrate=2.5&unit=gh&power=900&cost=0.2&fee=0&range=7d", profit.Rig{Hashrate: 2.5e9, Power: 900, Cost: 0.2}, "7d", 2.5, "gh"},
+		{"hashrate=500&unit=kh&fee=2", profit.Rig{Hashrate: 500e3, Cost: 0.1, Fee: 0.02}, defaultProfitRange, 500, "kh"},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		r, err := parseProfitRequest(query)
+		c.Assert(err, IsNil, Commentf(test.query))
+
+		c.Check(r.rig, Equals, test.rig, Commentf(test.query))
+		c.Check(r.rng.name, Equals, test.rng)
+		c.Check(r.hashrate, Equals, test.hashrate)
+		c.Check(r.unit, Equals, test.unit)
+	}
+}
+
+func (s *profitRequestSuite) TestInvalidRequests(c *C) {
+	tests := []struct {
+		query, err string
+	}{
+		{"", "hashrate must be more than 0"},
+		{"hashrate=0", "hashrate must be more than 0"},
+		{"hashrate=-1", "hashrate must be a number .*"},
+		{"hashrate=NaN", "hashrate must be a number .*"},
+		{"hashrate=10&unit=th", "unit must be .*"},
+		{"hashrate=10&power=lots", "power must be a number .*"},
+		{"hashrate=10&cost=101", "cost must be a number .*"},
+		{"hashrate=10&fee=NaN", "fee must be a number .*"},
+		{"hashrate=10&range=2d", "range must be .*"},
+	}
+
+	for _, test := range tests {
+		query, _ := url.ParseQuery(test.query)
+		_, err := parseProfitRequest(query)
+		c.Check(err, ErrorMatches, test.err, Commentf(test.query))
+	}
+}
@@ -0,0 +1,36 @@
+package cmds
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/robmerrell/vtcboard/config"
+)
+
+var ConfigDoc = `
+Usage: vtcboard [--config path] config check
+
+Validates the config and prints the effective settings with secrets redacted. The
+config file is picked by VTCBOARD_ENV (dev, test or prod) unless --config is given.
+Every setting but env can be overridden by an environment variable named after its
+section and key, eg: VTCBOARD_SERVER_LISTEN=":8080" or VTCBOARD_DATABASE_HOST="db1".
+`
+
+// configSubcommand is the argument given after "config" on the command line.
+var configSubcommand string
+
+// ConfigFlagPostParse picks up the subcommand for the config command.
+func ConfigFlagPostParse(fs *flag.FlagSet) {
+	configSubcommand = fs.Arg(0)
+}
+
+// ConfigAction is the function invoked by the config command. Loading the config
+// already validated it, so all that's left is to print it.
+func ConfigAction() error {
+	if configSubcommand != "check" {
+		return errors.New("usage: vtcboard config check")
+	}
+
+	fmt.Print(config.Get().Redacted())
+	return nil
+}
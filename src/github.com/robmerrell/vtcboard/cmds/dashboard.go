@@ -0,0 +1,186 @@
+package cmds
+
+import (
+	"fmt"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/pools"
+	"labix.org/v2/mgo"
+	"log"
+	"sync"
+	"time"
+)
+
+// dashboard holds the data for each panel on the home page. Every panel is loaded
+// on its own so that one failing data source doesn't take down the whole page.
+type dashboard struct {
+	Price    *models.Price
+	PriceErr error
+
+	Network    *models.Network
+	NetworkErr error
+
+	// average time between recent blocks, 0 if it isn't known
+	BlockTime time.Duration
+
+	// retarget analysis of the latest blocks
+	Difficulty    *difficultyReport
+	DifficultyErr error
+
+	// newest first
+	Blocks    []*models.Block
+	BlocksErr error
+
+	// stats from the pool apis, highest hashrate first
+	PoolStats    []*models.Pool
+	PoolStatsErr error
+
+	// the latest stratum probe of each endpoint
+	Probes    []*probeSummary
+	ProbesErr error
+
+	// share of blocks found by each pool during each of the poolWindows
+	PoolShares []*pools.Distribution
+	PoolsErr   error
+
+	// the latest crawl of the p2p network
+	Nodes    *models.NodeSnapshot
+	NodesErr error
+
+	// the latest snapshot of the node's mempool
+	Mempool    *models.MempoolSnapshot
+	MempoolErr error
+
+	Posts    map[string][]*models.Post
+	PostsErr map[string]error
+}
+
+// loadDashboard queries the data for every panel in parallel.
+func loadDashboard() *dashboard {
+	d := &dashboard{
+		Posts:    make(map[string][]*models.Post),
+		PostsErr: make(map[string]error),
+	}
+
+	var wg sync.WaitGroup
+	var postsMutex sync.Mutex
+
+	// each panel gets its own connection so a slow query doesn't hold up the others
+	load := func(loader func(conn *models.MgoConnection)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			conn := models.CloneConnection()
+			defer conn.Close()
+			loader(conn)
+		}()
+	}
+
+	load(func(conn *models.MgoConnection) {
+		d.Price, d.PriceErr = models.GetLatestPrice(conn)
+	})
+
+	load(func(conn *models.MgoConnection) {
+		d.Network, d.NetworkErr = models.GetLatestNetworkSnapshot(conn)
+		if d.NetworkErr != nil {
+			return
+		}
+
+		// the estimated halving date falls back to the target block time without this
+		var err error
+		if d.BlockTime, err = recentBlockTime(conn); err != nil {
+			log.Println(err)
+		}
+	})
+
+	load(func(conn *models.MgoConnection) {
+		d.Blocks, d.BlocksErr = models.GetRecentBlocks(conn, config.Get().Blocks.Recent)
+	})
+
+	load(func(conn *models.MgoConnection) {
+		d.Difficulty, d.DifficultyErr = loadDifficulty(conn)
+	})
+
+	load(func(conn *models.MgoConnection) {
+		d.PoolStats, d.PoolStatsErr = models.GetPools(conn)
+	})
+
+	load(func(conn *models.MgoConnection) {
+		d.Probes, d.ProbesErr = loadProbes(conn)
+	})
+
+	load(func(conn *models.MgoConnection) {
+		for _, window := range poolWindows {
+			shares, err := poolDistribution(conn, getSite().pools, window)
+			if err != nil {
+				d.PoolShares, d.PoolsErr = nil, err
+				return
+			}
+			d.PoolShares = append(d.PoolShares, shares)
+		}
+	})
+
+	load(func(conn *models.MgoConnection) {
+		d.Nodes, d.NodesErr = models.GetLatestNodeSnapshot(conn)
+	})
+
+	load(func(conn *models.MgoConnection) {
+		d.Mempool, d.MempoolErr = models.GetLatestMempoolSnapshot(conn)
+	})
+
+	for _, source := range config.Get().Posts.Sources {
+		source := source
+		load(func(conn *models.MgoConnection) {
+			posts, err := models.GetLatestPosts(conn, source, 8)
+
+			postsMutex.Lock()
+			defer postsMutex.Unlock()
+			d.Posts[source], d.PostsErr[source] = posts, err
+		})
+	}
+
+	wg.Wait()
+
+	// a missing document just means the updater hasn't run yet, anything else is worth logging
+	for _, err := range []error{d.PriceErr, d.NetworkErr, d.DifficultyErr, d.BlocksErr, d.PoolsErr, d.PoolStatsErr, d.ProbesErr, d.NodesErr, d.MempoolErr} {
+		if err != nil && err != mgo.ErrNotFound {
+			log.Println(err)
+		}
+	}
+	for source, err := range d.PostsErr {
+		if err != nil {
+			log.Printf("%s: %s", source, err)
+		}
+	}
+
+	return d
+}
+
+// panelMessage returns the text shown in place of a panel that couldn't be loaded.
+func panelMessage(err error, name string) string {
+	if err == mgo.ErrNotFound {
+		return fmt.Sprintf("No %s data yet", name)
+	}
+
+	return fmt.Sprintf("%s data is unavailable right now", name)
+}
+
+// isStale reports if data generated at the given time is older than the configured threshold.
+func isStale(generatedAt time.Time) bool {
+	threshold := time.Duration(config.Get().Server.StaleAfter) * time.Minute
+	return time.Since(generatedAt) > threshold
+}
+
+// humanizeAge returns a short description of how long ago a time was.
+func humanizeAge(t time.Time) string {
+	age := time.Since(t)
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm ago", int(age.Minutes()))
+	case age < time.Hour*48:
+		return fmt.Sprintf("%dh ago", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd ago", int(age.Hours()/24))
+	}
+}
@@ -0,0 +1,83 @@
+package cmds
+
+import (
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Dependency is something a command needs set up before it runs.
+type Dependency int
+
+const (
+	// NeedsConfig loads the config.
+	NeedsConfig Dependency = iota
+
+	// NeedsDB connects to the database, failing if it can't be reached.
+	NeedsDB
+
+	// WaitsForDB connects to the database, retrying with backoff until it can be reached.
+	WaitsForDB
+
+	// NeedsHTTPClient configures the HTTP client used to call external apis.
+	NeedsHTTPClient
+)
+
+// ConfigEnv and ConfigPath pick the config file that is loaded for commands that need
+// it. They are set by main before any command runs.
+var ConfigEnv, ConfigPath string
+
+// maxConnectBackoff caps the wait between attempts to connect to the database.
+var maxConnectBackoff = time.Minute
+
+// Requires returns a function that sets up a command's dependencies and then invokes
+// action. Commands that don't need anything, like help, work without a config or a
+// database. Every dependency needs the config, so it is always loaded first.
+func Requires(action func() error, deps ...Dependency) func() error {
+	return func() error {
+		if err := config.LoadFile(ConfigEnv, ConfigPath); err != nil {
+			return err
+		}
+
+		for _, dep := range deps {
+			var err error
+			switch dep {
+			case NeedsDB:
+				err = models.ConnectToDB(config.Get().Database)
+			case WaitsForDB:
+				err = connectWithBackoff()
+			case NeedsHTTPClient:
+				http.DefaultClient.Timeout = time.Duration(config.Get().HTTP.Timeout) * time.Second
+			}
+
+			if err != nil {
+				return err
+			}
+		}
+
+		return action()
+	}
+}
+
+// connectWithBackoff keeps trying to connect to the database while it can't be reached,
+// doubling the wait between attempts up to maxConnectBackoff. Any other error, like a bad
+// setting or login, won't go away by retrying so it's returned.
+func connectWithBackoff() error {
+	wait := time.Second
+	for {
+		err := models.ConnectToDB(config.Get().Database)
+		if _, ok := err.(*models.UnreachableError); !ok {
+			return err
+		}
+
+		log.Printf("%s, retrying in %s", err, wait)
+		time.Sleep(wait)
+
+		wait *= 2
+		if wait > maxConnectBackoff {
+			wait = maxConnectBackoff
+		}
+	}
+}
@@ -0,0 +1,200 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/lib"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/retarget"
+	"labix.org/v2/mgo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// difficultyReport is the retarget analysis of the stored blocks along with how the
+// difficulty moved over the last day.
+type difficultyReport struct {
+	*retarget.Analysis
+
+	// fraction the difficulty moved by according to the last day's network snapshots, 0
+	// if there aren't enough of them
+	DayChange float64
+}
+
+// loadDifficulty analyzes the latest stored blocks with the configured retarget algorithm.
+func loadDifficulty(conn *models.MgoConnection) (*difficultyReport, error) {
+	settings := config.Get().Difficulty
+	algorithm, err := retarget.Find(settings.Algorithm)
+	if err != nil {
+		return nil, err
+	}
+
+	count := algorithm.Window()
+	for _, n := range []int{settings.Window + 1, settings.Run + 1} {
+		if n > count {
+			count = n
+		}
+	}
+
+	stored, err := models.GetRecentBlockTimes(conn, count)
+	if err != nil {
+		return nil, err
+	}
+	if len(stored) == 0 {
+		return nil, mgo.ErrNotFound
+	}
+
+	// the algorithms want the oldest block first
+	blocks := make([]retarget.Block, len(stored))
+	for i, block := range stored {
+		blocks[len(stored)-1-i] = retarget.Block{Height: block.Height, Time: block.Time, Difficulty: block.Difficulty}
+	}
+
+	thresholds := retarget.Thresholds{
+		Run:  settings.Run,
+		Fast: float64(settings.Fast) / 100,
+		Slow: float64(settings.Slow) / 100,
+	}
+	analysis, err := retarget.Analyze(settings.Algorithm, blocks, settings.Window, thresholds)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &difficultyReport{Analysis: analysis}
+	report.DayChange, err = difficultyDayChange(conn)
+	return report, err
+}
+
+// difficultyDayChange works out how much the difficulty moved between the first and last
+// network snapshots of the last day.
+func difficultyDayChange(conn *models.MgoConnection) (float64, error) {
+	snapshots, err := models.GetNetworkSnapshotsSince(conn, time.Now().UTC().Add(time.Hour*-24))
+	if err != nil || len(snapshots) < 2 {
+		return 0, err
+	}
+
+	first, err1 := strconv.ParseFloat(snapshots[0].Difficulty, 64)
+	last, err2 := strconv.ParseFloat(snapshots[len(snapshots)-1].Difficulty, 64)
+	if err1 != nil || err2 != nil || first == 0 {
+		return 0, nil
+	}
+
+	return last/first - 1, nil
+}
+
+// difficultyWarning describes a run of unusually fast or slow blocks, or returns an empty
+// string if there isn't one.
+func difficultyWarning(report *difficultyReport) string {
+	run := config.Get().Difficulty.Run
+	switch report.Anomaly {
+	case retarget.Fast:
+		return fmt.Sprintf("The last %d blocks took %s on average against a %s target, hashrate may have spiked",
+			run, formatBlockTime(report.RunMean), formatBlockTime(report.Spacing))
+	case retarget.Slow:
+		return fmt.Sprintf("The last %d blocks took %s on average against a %s target, hashrate may have left",
+			run, formatBlockTime(report.RunMean), formatBlockTime(report.Spacing))
+	}
+
+	return ""
+}
+
+// formatBlockTime rounds a block interval to the second, eg: 2m31s.
+func formatBlockTime(d time.Duration) string {
+	return d.Round(time.Second).String()
+}
+
+// formatChange formats a fractional change as a signed percent.
+func formatChange(change float64) string {
+	return fmt.Sprintf("%+.2f%%", change*100)
+}
+
+// difficultyValues fills in the difficulty panel of the mining section.
+func difficultyValues(report *difficultyReport) map[string]interface{} {
+	return map[string]interface{}{
+		"difficultyOk":        true,
+		"nextDifficulty":      lib.RenderFloat("#,###.####", report.Next),
+		"nextDifficultyDelta": formatChange(report.Change),
+		"difficultyDayChange": formatChange(report.DayChange),
+		"blockTimeBlocks":     report.Intervals.Count,
+		"blockTimeMean":       formatBlockTime(report.Intervals.Mean),
+		"blockTimeMedian":     formatBlockTime(report.Intervals.Median),
+		"blockTimeStdDev":     formatBlockTime(report.Intervals.StdDev),
+		"difficultyWarning":   difficultyWarning(report),
+	}
+}
+
+// serveDifficulty returns the retarget analysis as JSON from /api/difficulty. Durations
+// are in seconds.
+func serveDifficulty(pageCache *cache.Cache, res http.ResponseWriter) {
+	body, err := pageCache.Get("/api/difficulty", func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		report, err := loadDifficulty(conn)
+		if err != nil {
+			return "", err
+		}
+
+		body, err := json.Marshal(map[string]interface{}{
+			"algorithm":      report.Algorithm,
+			"height":         report.Height,
+			"difficulty":     report.Current,
+			"nextDifficulty": report.Next,
+			"change":         report.Change,
+			"dayChange":      report.DayChange,
+			"spacing":        report.Spacing.Seconds(),
+			"intervals": map[string]interface{}{
+				"count":  report.Intervals.Count,
+				"mean":   report.Intervals.Mean.Seconds(),
+				"median": report.Intervals.Median.Seconds(),
+				"stdDev": report.Intervals.StdDev.Seconds(),
+				"min":    report.Intervals.Min.Seconds(),
+				"max":    report.Intervals.Max.Seconds(),
+			},
+			"runMean": report.RunMean.Seconds(),
+			"anomaly": report.Anomaly,
+			"warning": difficultyWarning(report),
+		})
+		return string(body), err
+	})
+
+	if err == mgo.ErrNotFound {
+		http.Error(res, "No blocks yet", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, body)
+}
+
+// serveDifficultyHealth answers /health/difficulty with a 500 while blocks are coming
+// unusually fast or slow, so it can be alerted on like /health.
+func serveDifficultyHealth(pageCache *cache.Cache, res http.ResponseWriter) {
+	warning, err := pageCache.Get("/health/difficulty", func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		report, err := loadDifficulty(conn)
+		if err != nil {
+			return "", err
+		}
+		return difficultyWarning(report), nil
+	})
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	if warning != "" {
+		http.Error(res, warning, http.StatusInternalServerError)
+		return
+	}
+
+	res.Write([]byte("ok"))
+}
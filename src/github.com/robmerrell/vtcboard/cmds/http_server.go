@@ -0,0 +1,130 @@
+package cmds
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"github.com/robmerrell/vtcboard/config"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// listenAndServe serves handler with the settings from the [server] config section
+// until the process is asked to stop with SIGTERM or an interrupt, at which point
+// in-flight requests are given time to finish. onShutdown is called when shutdown
+// starts so long lived connections can be ended.
+func listenAndServe(handler http.Handler, onShutdown func()) error {
+	settings := config.Get().Server
+	server := &http.Server{
+		Handler:        handler,
+		ReadTimeout:    time.Duration(settings.ReadTimeout) * time.Second,
+		WriteTimeout:   time.Duration(settings.WriteTimeout) * time.Second,
+		IdleTimeout:    time.Duration(settings.IdleTimeout) * time.Second,
+		MaxHeaderBytes: settings.MaxHeaderBytes,
+	}
+	server.RegisterOnShutdown(onShutdown)
+
+	listener, err := net.Listen("tcp", settings.Listen)
+	if err != nil {
+		return err
+	}
+
+	tlsConfig, err := serverTLSConfig()
+	if err != nil {
+		listener.Close()
+		return err
+	}
+	if tlsConfig != nil {
+		listener = tls.NewListener(listener, tlsConfig)
+	}
+
+	// drain in-flight requests when we're told to stop
+	shutdownErr := make(chan error, 1)
+	go func() {
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+		<-signals
+
+		log.Printf("shutting down")
+		timeout := time.Duration(settings.ShutdownTimeout) * time.Second
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		shutdownErr <- server.Shutdown(ctx)
+	}()
+
+	log.Printf("listening on %s", listener.Addr())
+	if err := server.Serve(listener); err != http.ErrServerClosed {
+		return err
+	}
+
+	return <-shutdownErr
+}
+
+// serverTLSConfig returns the TLS config for the server, or nil if it should serve plain HTTP.
+// A certificate and key on disk take precedence over a generated self signed certificate.
+func serverTLSConfig() (*tls.Config, error) {
+	settings := config.Get().Server
+	certFile := settings.TLSCert
+	keyFile := settings.TLSKey
+
+	var cert tls.Certificate
+	var err error
+	switch {
+	case certFile != "":
+		cert, err = tls.LoadX509KeyPair(certFile, keyFile)
+	case settings.SelfSigned:
+		log.Printf("using a self signed certificate, don't do this in production")
+		cert, err = selfSignedCertificate()
+	default:
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}}, nil
+}
+
+// selfSignedCertificate generates a throwaway certificate for localhost for use in development.
+func selfSignedCertificate() (tls.Certificate, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	template := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{Organization: []string{"VTCBoard development"}},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour * 24 * 365),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1"), net.ParseIP("::1")},
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, nil
+}
@@ -0,0 +1,255 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/broadcast"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"labix.org/v2/mgo/bson"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// exchanges are the exchanges prices are published for as price:<exchange>.
+var exchanges = []string{"cryptsy"}
+
+// livePublisher publishes data written by the updaters to a hub. It remembers the
+// newest item it has seen of each kind so only data that is actually new is sent,
+// and the latest event on each channel so new subscribers can start with a snapshot.
+type livePublisher struct {
+	hub   *broadcast.Hub
+	mutex sync.Mutex
+
+	primed      bool
+	lastPrice   bson.ObjectId
+	lastNetwork time.Time
+	lastBlock   time.Time
+	lastPosts   map[string]time.Time
+	latest      map[string]broadcast.Event
+}
+
+func newLivePublisher(hub *broadcast.Hub) *livePublisher {
+	return &livePublisher{
+		hub:       hub,
+		lastPosts: make(map[string]time.Time),
+		latest:    make(map[string]broadcast.Event),
+	}
+}
+
+// snapshot returns the latest event published on a channel.
+func (p *livePublisher) snapshot(channel string) (broadcast.Event, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	e, ok := p.latest[channel]
+	return e, ok
+}
+
+// publish loads the latest data and publishes anything newer than what was seen last
+// time. The first call only records what is already there, since clients got that
+// data with the page.
+func (p *livePublisher) publish() {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	events := []broadcast.Event{}
+
+	price, err := models.GetLatestPrice(conn)
+	network, networkErr := models.GetLatestNetworkSnapshot(conn)
+	if networkErr != nil {
+		network = nil
+	}
+
+	if err == nil && price.Id != p.lastPrice {
+		p.lastPrice = price.Id
+		events = append(events, broadcast.Event{Channel: "price", Data: pricePayload(price, network)})
+		events = append(events, broadcast.Event{Channel: "price:cryptsy", Data: exchangePayload(price.Cryptsy, price)})
+	}
+
+	if networkErr == nil && network.GeneratedAt.After(p.lastNetwork) {
+		p.lastNetwork = network.GeneratedAt
+		events = append(events, broadcast.Event{Channel: "network", Data: networkPayload(network)})
+	}
+
+	// start from the newest block rather than every block that's stored
+	if !p.primed {
+		if latest, err := models.GetLatestBlock(conn); err == nil {
+			p.lastBlock = latest.IngestedAt
+			events = append(events, broadcast.Event{Channel: "blocks", Data: blockPayload(latest)})
+		}
+	}
+
+	blocks, err := models.GetBlocksIngestedAfter(conn, p.lastBlock)
+	if err != nil {
+		log.Println(err)
+	}
+	for _, block := range blocks {
+		if block.IngestedAt.After(p.lastBlock) {
+			p.lastBlock = block.IngestedAt
+		}
+		events = append(events, broadcast.Event{Channel: "blocks", Data: blockPayload(block)})
+	}
+
+	for _, source := range config.Get().Posts.Sources {
+		posts, err := models.GetLatestPosts(conn, source, 8)
+		if err != nil {
+			log.Printf("%s: %s", source, err)
+			continue
+		}
+
+		// oldest first so clients that prepend end up in the right order
+		for i := len(posts) - 1; i >= 0; i-- {
+			post := posts[i]
+			if !post.PublishedAt.After(p.lastPosts[source]) {
+				continue
+			}
+
+			p.lastPosts[source] = post.PublishedAt
+			events = append(events, broadcast.Event{Channel: "posts:" + source, Data: postPayload(post)})
+		}
+	}
+
+	for _, e := range events {
+		p.latest[e.Channel] = e
+	}
+
+	if !p.primed {
+		p.primed = true
+		return
+	}
+
+	for _, e := range events {
+		p.hub.Publish(e)
+	}
+}
+
+// pricePayload is what clients receive for a new price. The formatted values match the
+// ones on the page, the raw ones are for the chart.
+func pricePayload(price *models.Price, network *models.Network) map[string]interface{} {
+	payload := map[string]interface{}{
+		"usdValue": price.Cryptsy.Usd,
+		"btcValue": price.Cryptsy.Btc,
+		"time":     price.GeneratedAt.Unix() * 1000,
+	}
+
+	vars := generateTplVars(price, network)
+	for _, key := range []string{"usd", "btc", "change", "changeStyle", "marketCap"} {
+		if value, ok := vars[key]; ok {
+			payload[key] = value
+		}
+	}
+
+	return payload
+}
+
+// exchangePayload is what clients receive for a new price on a single exchange.
+func exchangePayload(exchange *models.ExchangePrice, price *models.Price) map[string]interface{} {
+	return map[string]interface{}{
+		"usd":    exchange.Usd,
+		"btc":    exchange.Btc,
+		"change": exchange.PercentChange,
+		"time":   price.GeneratedAt.Unix() * 1000,
+	}
+}
+
+// blockPayload is what clients receive for a newly ingested block.
+func blockPayload(block *models.Block) map[string]interface{} {
+	return map[string]interface{}{
+		"height":   block.Height,
+		"hash":     block.Hash,
+		"time":     block.Time.Unix() * 1000,
+		"txCount":  block.TxCount,
+		"size":     block.Size,
+		"value":    block.CoinbaseValue,
+		"minerTag": block.MinerTag,
+	}
+}
+
+// networkPayload is what clients receive for a new network snapshot.
+func networkPayload(network *models.Network) map[string]interface{} {
+	payload := map[string]interface{}{"blockCount": network.BlockCount}
+	for key, value := range generateTplVars(nil, network) {
+		payload[key] = value
+	}
+
+	return payload
+}
+
+// postPayload is what clients receive for a new post.
+func postPayload(post *models.Post) map[string]interface{} {
+	return map[string]interface{}{
+		"source": post.Source,
+		"title":  post.Title,
+		"url":    post.Url,
+	}
+}
+
+// serveEvents streams the events the dashboard uses from the hub to the client as
+// server-sent events. The event name is the channel up to the first colon, so every
+// posts:<source> channel arrives as a posts event. Clients that can't keep up are
+// dropped by the hub, and the browser reconnects on its own.
+func serveEvents(hub *broadcast.Hub) http.HandlerFunc {
+	return func(res http.ResponseWriter, req *http.Request) {
+		settings := config.Get().Live
+		controller := http.NewResponseController(res)
+
+		res.Header().Set("Content-Type", "text/event-stream")
+		res.Header().Set("Cache-Control", "no-cache")
+		res.Header().Set("X-Accel-Buffering", "no")
+
+		subscriber := hub.Subscribe(settings.Buffer)
+		defer hub.Unsubscribe(subscriber)
+
+		// each write gets its own deadline instead of the server's write timeout
+		write := func(message string) bool {
+			controller.SetWriteDeadline(time.Now().Add(time.Duration(settings.WriteTimeout) * time.Second))
+			if _, err := fmt.Fprint(res, message); err != nil {
+				return false
+			}
+			return controller.Flush() == nil
+		}
+
+		if !write(fmt.Sprintf("retry: %d\n\n", settings.Heartbeat*1000)) {
+			return
+		}
+
+		heartbeat := time.NewTicker(time.Duration(settings.Heartbeat) * time.Second)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case <-req.Context().Done():
+				return
+			case <-heartbeat.C:
+				if !write(": heartbeat\n\n") {
+					return
+				}
+			case e, ok := <-subscriber.Events:
+				if !ok {
+					return
+				}
+				if e.Channel != "price" && e.Channel != "network" && !strings.HasPrefix(e.Channel, "posts:") {
+					continue
+				}
+
+				data, err := json.Marshal(e.Data)
+				if err != nil {
+					log.Println(err)
+					continue
+				}
+
+				name := strings.SplitN(e.Channel, ":", 2)[0]
+				if !write(fmt.Sprintf("event: %s\ndata: %s\n\n", name, data)) {
+					return
+				}
+			}
+		}
+	}
+}
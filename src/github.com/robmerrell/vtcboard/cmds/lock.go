@@ -0,0 +1,102 @@
+package cmds
+
+import (
+	"fmt"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"log"
+	"os"
+	"time"
+)
+
+// lockOwner identifies this process when holding a lease.
+func lockOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+
+	return fmt.Sprintf("%s:%d", hostname, os.Getpid())
+}
+
+// A LockedAction runs while RunLocked holds its lease. Lost is closed if the lease is lost
+// before the action returns, an action that runs for a while should stop when it is.
+type LockedAction func(lost <-chan bool) error
+
+// Unstoppable adapts an action that's quick enough that it isn't worth stopping.
+func Unstoppable(action func() error) LockedAction {
+	return func(lost <-chan bool) error {
+		return action()
+	}
+}
+
+// RunLocked returns a function that only invokes action if the named lease can be
+// acquired, so that vtcboard can run on multiple hosts without each of them writing
+// the same data. The lease is renewed while action runs. After a successful run the
+// lease is left to expire instead of being released, so a host whose schedule fires
+// slightly later in the same interval still skips the run. Losing the lease partway
+// through is an error, since another host may be running the action too.
+func RunLocked(name string, action LockedAction) func() error {
+	return func() error {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		ttl := time.Duration(config.Get().Lock.TTL) * time.Second
+		owner := lockOwner()
+
+		acquired, err := models.AcquireLock(conn, name, owner, ttl)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			if lock, err := models.GetLock(conn, name); err == nil {
+				log.Printf("skipping %s, lock is held by %s until %s", name, lock.Owner, lock.ExpiresAt)
+			}
+			return nil
+		}
+
+		// keep the lease alive while the action runs
+		done := make(chan bool)
+		lost := make(chan bool)
+		renewing := make(chan bool)
+		go func() {
+			defer close(renewing)
+
+			ticker := time.NewTicker(ttl / 3)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-done:
+					return
+				case <-ticker.C:
+					if renewed, err := models.RenewLock(conn, name, owner, ttl); err != nil || !renewed {
+						log.Printf("lost the lease on %s", name)
+						close(lost)
+						return
+					}
+				}
+			}
+		}()
+
+		err = action(lost)
+		close(done)
+		<-renewing
+
+		select {
+		case <-lost:
+			if err == nil {
+				err = fmt.Errorf("lost the lease on %s before it finished", name)
+			}
+			return err
+		default:
+		}
+
+		// let another host retry this interval
+		if err != nil {
+			models.ReleaseLock(conn, name, owner)
+		}
+
+		return err
+	}
+}
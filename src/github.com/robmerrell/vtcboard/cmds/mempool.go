@@ -0,0 +1,178 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/charts"
+	"github.com/robmerrell/vtcboard/lib"
+	"github.com/robmerrell/vtcboard/models"
+	"labix.org/v2/mgo"
+	"net/http"
+	"time"
+)
+
+// defaultMempoolRange is how far back the mempool chart goes.
+const defaultMempoolRange = "24h"
+
+// formatFeeRate formats a fee rate in satoshis per byte.
+func formatFeeRate(rate float64) string {
+	return fmt.Sprintf("%.1f sat/B", rate)
+}
+
+// feeBucketName describes the rates in a bucket, eg: 2-5 sat/B.
+func feeBucketName(bucket models.FeeBucket) string {
+	if bucket.Max == 0 {
+		return fmt.Sprintf("%g+ sat/B", bucket.Min)
+	}
+
+	return fmt.Sprintf("%g-%g sat/B", bucket.Min, bucket.Max)
+}
+
+// feeBucketRows formats the fee rate histogram for the fees section, with bars sized by
+// the bytes of transactions in each bucket.
+func feeBucketRows(snapshot *models.MempoolSnapshot) []map[string]interface{} {
+	total := int64(0)
+	for _, bucket := range snapshot.Buckets {
+		total += bucket.Bytes
+	}
+
+	rows := make([]map[string]interface{}, 0, len(snapshot.Buckets))
+	for _, bucket := range snapshot.Buckets {
+		share := 0.0
+		if total > 0 {
+			share = float64(bucket.Bytes) / float64(total) * 100
+		}
+
+		rows = append(rows, map[string]interface{}{
+			"name":  feeBucketName(bucket),
+			"count": lib.RenderInteger("", bucket.Count),
+			"size":  fmt.Sprintf("%.1f kB", float64(bucket.Bytes)/1000),
+			"width": fmt.Sprintf("%.1f", share),
+		})
+	}
+
+	return rows
+}
+
+// mempoolSeries is a line on the mempool chart, times in milliseconds for flot.
+type mempoolSeries struct {
+	Label string       `json:"label"`
+	Data  [][2]float64 `json:"data"`
+	YAxis int          `json:"yaxis"`
+}
+
+// mempoolHistory returns the mempool's size in kB and the next block fee over a range.
+func mempoolHistory(conn *models.MgoConnection, r chartRange, maxPoints int) ([]mempoolSeries, error) {
+	since := time.Time{}
+	if r.duration != 0 {
+		since = time.Now().UTC().Add(-r.duration)
+	}
+
+	snapshots, err := models.GetMempoolSnapshotsSince(conn, since)
+	if err != nil {
+		return nil, err
+	}
+
+	sizes := make([]charts.Point, 0, len(snapshots))
+	rates := make([]charts.Point, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		sizes = append(sizes, charts.Point{Time: snapshot.TakenAt, Value: float64(snapshot.Bytes) / 1000})
+		rates = append(rates, charts.Point{Time: snapshot.TakenAt, Value: snapshot.Estimate(1)})
+	}
+
+	series := []mempoolSeries{{Label: "mempool (kB)", YAxis: 1}, {Label: "next block fee (sat/B)", YAxis: 2}}
+	for i, line := range [][]charts.Point{sizes, rates} {
+		series[i].Data = [][2]float64{}
+		for _, p := range charts.Downsample(line, maxPoints) {
+			series[i].Data = append(series[i].Data, [2]float64{float64(p.Time.Unix()) * 1000, p.Value})
+		}
+	}
+
+	return series, nil
+}
+
+// mempoolValues fills in the fees section of the dashboard.
+func mempoolValues(snapshot *models.MempoolSnapshot) map[string]interface{} {
+	return map[string]interface{}{
+		"feeNextBlock":    formatFeeRate(snapshot.Estimate(1)),
+		"feeThreeBlocks":  formatFeeRate(snapshot.Estimate(3)),
+		"feeSixBlocks":    formatFeeRate(snapshot.Estimate(6)),
+		"mempoolCount":    lib.RenderInteger("", snapshot.Count),
+		"mempoolSize":     fmt.Sprintf("%.1f kB", float64(snapshot.Bytes)/1000),
+		"mempoolAge":      humanizeAge(snapshot.TakenAt),
+		"feeBuckets":      feeBucketRows(snapshot),
+		"mempoolChartUrl": "/api/mempool?range=" + defaultMempoolRange,
+	}
+}
+
+// serveMempool returns the latest mempool snapshot and the mempool's size and next block
+// fee over a range as JSON from /api/mempool, eg: /api/mempool?range=24h.
+func serveMempool(pageCache *cache.Cache, res http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("range")
+	if name == "" {
+		name = defaultMempoolRange
+	}
+
+	rng, ok := findChartRange(name)
+	if !ok {
+		http.Error(res, "range must be 1h, 24h, 7d, 30d, 1y or all", http.StatusBadRequest)
+		return
+	}
+
+	body, err := pageCache.Get("/api/mempool?range="+rng.name, func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		latest, err := models.GetLatestMempoolSnapshot(conn)
+		if err != nil {
+			return "", err
+		}
+
+		history, err := mempoolHistory(conn, rng, maxChartPoints(0))
+		if err != nil {
+			return "", err
+		}
+
+		buckets := make([]map[string]interface{}, 0, len(latest.Buckets))
+		for _, bucket := range latest.Buckets {
+			buckets = append(buckets, map[string]interface{}{
+				"min":   bucket.Min,
+				"max":   bucket.Max,
+				"count": bucket.Count,
+				"bytes": bucket.Bytes,
+			})
+		}
+
+		estimates := make([]map[string]interface{}, 0, len(latest.Estimates))
+		for _, estimate := range latest.Estimates {
+			estimates = append(estimates, map[string]interface{}{
+				"blocks":  estimate.Blocks,
+				"feeRate": estimate.FeeRate,
+			})
+		}
+
+		body, err := json.Marshal(map[string]interface{}{
+			"range":      rng.name,
+			"takenAt":    latest.TakenAt,
+			"count":      latest.Count,
+			"bytes":      latest.Bytes,
+			"minFeeRate": latest.MinFeeRate,
+			"buckets":    buckets,
+			"estimates":  estimates,
+			"history":    history,
+		})
+		return string(body), err
+	})
+
+	if err == mgo.ErrNotFound {
+		http.Error(res, "No mempool snapshots yet", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, body)
+}
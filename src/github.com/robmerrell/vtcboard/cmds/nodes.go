@@ -0,0 +1,195 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/charts"
+	"github.com/robmerrell/vtcboard/lib"
+	"github.com/robmerrell/vtcboard/models"
+	"labix.org/v2/mgo"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// topUserAgents is how many user agents get their own line on the adoption chart, the
+// rest are added up as other.
+const topUserAgents = 5
+
+// defaultNodesRange is how far back the adoption chart goes.
+const defaultNodesRange = "30d"
+
+// nodeVersionRows formats the versions found by a crawl for the nodes section, with bars
+// like the pool chart.
+func nodeVersionRows(snapshot *models.NodeSnapshot) []map[string]interface{} {
+	rows := make([]map[string]interface{}, 0, len(snapshot.Versions))
+	for _, version := range snapshot.Versions {
+		share := 0.0
+		if snapshot.Reachable > 0 {
+			share = float64(version.Count) / float64(snapshot.Reachable) * 100
+		}
+
+		rows = append(rows, map[string]interface{}{
+			"name":     version.UserAgent,
+			"protocol": version.Protocol,
+			"count":    version.Count,
+			"percent":  fmt.Sprintf("%.1f%%", share),
+			"width":    fmt.Sprintf("%.1f", share),
+		})
+	}
+
+	return rows
+}
+
+// userAgentCounts adds up the nodes running each user agent in a crawl, whatever protocol
+// version they speak.
+func userAgentCounts(snapshot *models.NodeSnapshot) map[string]int {
+	counts := make(map[string]int)
+	for _, version := range snapshot.Versions {
+		counts[version.UserAgent] += version.Count
+	}
+
+	return counts
+}
+
+// adoptionSeries is the part of reachable nodes running a user agent over time, times in
+// milliseconds for flot.
+type adoptionSeries struct {
+	Label string       `json:"label"`
+	Data  [][2]float64 `json:"data"`
+}
+
+// nodeAdoption works out the part of the reachable nodes that ran each of the latest
+// crawl's most common user agents over a range.
+func nodeAdoption(conn *models.MgoConnection, latest *models.NodeSnapshot, r chartRange, maxPoints int) ([]adoptionSeries, error) {
+	since := time.Time{}
+	if r.duration != 0 {
+		since = time.Now().UTC().Add(-r.duration)
+	}
+
+	snapshots, err := models.GetNodeSnapshotsSince(conn, since)
+	if err != nil {
+		return nil, err
+	}
+
+	latestCounts := userAgentCounts(latest)
+	agents := make([]string, 0, len(latestCounts))
+	for agent := range latestCounts {
+		agents = append(agents, agent)
+	}
+	sort.Slice(agents, func(i, j int) bool {
+		if latestCounts[agents[i]] != latestCounts[agents[j]] {
+			return latestCounts[agents[i]] > latestCounts[agents[j]]
+		}
+		return agents[i] < agents[j]
+	})
+	if len(agents) > topUserAgents {
+		agents = agents[:topUserAgents]
+	}
+
+	points := make([][]charts.Point, len(agents)+1)
+	for _, snapshot := range snapshots {
+		if snapshot.Reachable == 0 {
+			continue
+		}
+
+		counts := userAgentCounts(snapshot)
+		other := snapshot.Reachable
+		for i, agent := range agents {
+			points[i] = append(points[i], charts.Point{Time: snapshot.CrawledAt, Value: float64(counts[agent]) / float64(snapshot.Reachable) * 100})
+			other -= counts[agent]
+		}
+		points[len(agents)] = append(points[len(agents)], charts.Point{Time: snapshot.CrawledAt, Value: float64(other) / float64(snapshot.Reachable) * 100})
+	}
+
+	series := make([]adoptionSeries, 0, len(points))
+	for i, line := range points {
+		label := "other"
+		if i < len(agents) {
+			label = agents[i]
+		}
+
+		s := adoptionSeries{Label: label, Data: [][2]float64{}}
+		for _, p := range charts.Downsample(line, maxPoints) {
+			s.Data = append(s.Data, [2]float64{float64(p.Time.Unix()) * 1000, p.Value})
+		}
+		series = append(series, s)
+	}
+
+	return series, nil
+}
+
+// nodeValues fills in the nodes section of the dashboard.
+func nodeValues(snapshot *models.NodeSnapshot) map[string]interface{} {
+	return map[string]interface{}{
+		"reachableNodes":   lib.RenderInteger("", snapshot.Reachable),
+		"nodeMedianHeight": lib.RenderInteger("", int(snapshot.MedianHeight)),
+		"nodeMaxHeight":    lib.RenderInteger("", int(snapshot.MaxHeight)),
+		"nodesAge":         humanizeAge(snapshot.CrawledAt),
+		"nodeVersions":     nodeVersionRows(snapshot),
+		"nodesChartUrl":    "/api/nodes?range=" + defaultNodesRange,
+	}
+}
+
+// serveNodes returns the latest crawl of the p2p network and the adoption of its most
+// common user agents over a range as JSON from /api/nodes, eg: /api/nodes?range=30d.
+func serveNodes(pageCache *cache.Cache, res http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("range")
+	if name == "" {
+		name = defaultNodesRange
+	}
+
+	rng, ok := findChartRange(name)
+	if !ok {
+		http.Error(res, "range must be 1h, 24h, 7d, 30d, 1y or all", http.StatusBadRequest)
+		return
+	}
+
+	body, err := pageCache.Get("/api/nodes?range="+rng.name, func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		latest, err := models.GetLatestNodeSnapshot(conn)
+		if err != nil {
+			return "", err
+		}
+
+		adoption, err := nodeAdoption(conn, latest, rng, maxChartPoints(0))
+		if err != nil {
+			return "", err
+		}
+
+		versions := make([]map[string]interface{}, 0, len(latest.Versions))
+		for _, version := range latest.Versions {
+			versions = append(versions, map[string]interface{}{
+				"userAgent": version.UserAgent,
+				"protocol":  version.Protocol,
+				"count":     version.Count,
+			})
+		}
+
+		body, err := json.Marshal(map[string]interface{}{
+			"range":        rng.name,
+			"crawledAt":    latest.CrawledAt,
+			"reachable":    latest.Reachable,
+			"unreachable":  latest.Unreachable,
+			"medianHeight": latest.MedianHeight,
+			"maxHeight":    latest.MaxHeight,
+			"versions":     versions,
+			"adoption":     adoption,
+		})
+		return string(body), err
+	})
+
+	if err == mgo.ErrNotFound {
+		http.Error(res, "No crawls yet", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, body)
+}
@@ -0,0 +1,301 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/lib"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/pools"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// poolWindow is a span of time that pool shares are worked out over.
+type poolWindow struct {
+	name     string
+	title    string
+	duration time.Duration
+}
+
+// poolWindows are the spans shown on the dashboard, the first is used for the dominance
+// warning.
+var poolWindows = []poolWindow{
+	{"24h", "LAST 24 HOURS", time.Hour * 24},
+	{"7d", "LAST 7 DAYS", time.Hour * 24 * 7},
+}
+
+// findPoolWindow looks up a pool window by name.
+func findPoolWindow(name string) (poolWindow, bool) {
+	for _, w := range poolWindows {
+		if w.name == name {
+			return w, true
+		}
+	}
+
+	return poolWindow{}, false
+}
+
+// poolDistribution works out the share of the blocks found during a window by each pool.
+func poolDistribution(conn *models.MgoConnection, table *pools.Table, window poolWindow) (*pools.Distribution, error) {
+	blocks, err := models.GetMinersSince(conn, time.Now().UTC().Add(-window.duration))
+	if err != nil {
+		return nil, err
+	}
+
+	mined := make([]pools.Mined, 0, len(blocks))
+	for _, block := range blocks {
+		mined = append(mined, pools.Mined{Height: block.Height, Tag: block.MinerTag, Addresses: block.PayoutAddresses})
+	}
+
+	return table.Distribution(mined), nil
+}
+
+// dominanceWarning returns the warning shown when one pool has found too many blocks, or
+// an empty string if none has.
+func dominanceWarning(d *pools.Distribution) string {
+	threshold := config.Get().Pools.Dominance
+	share, ok := d.Dominant(float64(threshold) / 100)
+	if !ok {
+		return ""
+	}
+
+	return fmt.Sprintf("%s found %.0f%% of the last day's blocks, more than the %d%% any one pool should have",
+		share.Name, share.Share*100, threshold)
+}
+
+// poolRows formats a distribution for the pool chart, with unknown miners last.
+func poolRows(d *pools.Distribution) []map[string]interface{} {
+	shares := d.Pools
+	if d.Unknown.Blocks > 0 {
+		shares = append(shares[:len(shares):len(shares)], d.Unknown)
+	}
+
+	rows := make([]map[string]interface{}, 0, len(shares))
+	for _, share := range shares {
+		rows = append(rows, map[string]interface{}{
+			"name":    share.Name,
+			"link":    share.Link,
+			"blocks":  share.Blocks,
+			"percent": fmt.Sprintf("%.1f%%", share.Share*100),
+			"width":   fmt.Sprintf("%.1f", share.Share*100),
+			"unknown": share.Name == pools.UnknownName,
+		})
+	}
+
+	return rows
+}
+
+// probeSummary is the latest probe of a stratum endpoint along with the part of the last
+// day's probes that found it up.
+type probeSummary struct {
+	*models.Probe
+	Uptime float64
+}
+
+// loadProbes gets the latest probe of every endpoint that's still in the config.
+func loadProbes(conn *models.MgoConnection) ([]*probeSummary, error) {
+	configured := make(map[string]bool)
+	for _, entry := range config.Get().Pools.Stratum {
+		if fields := strings.Fields(entry); len(fields) >= 2 {
+			configured[fields[len(fields)-1]] = true
+		}
+	}
+
+	latest, err := models.GetLatestProbes(conn)
+	if err != nil {
+		return nil, err
+	}
+
+	summaries := []*probeSummary{}
+	for _, probe := range latest {
+		if !configured[probe.Endpoint] {
+			continue
+		}
+
+		history, err := models.GetProbesSince(conn, probe.Endpoint, time.Now().UTC().Add(time.Hour*-24))
+		if err != nil {
+			return nil, err
+		}
+
+		up := 0
+		for _, p := range history {
+			if p.Up {
+				up++
+			}
+		}
+
+		summary := &probeSummary{Probe: probe}
+		if len(history) > 0 {
+			summary.Uptime = float64(up) / float64(len(history))
+		}
+		summaries = append(summaries, summary)
+	}
+
+	return summaries, nil
+}
+
+// describeProbes sums up a pool's stratum endpoints for the pool listing.
+func describeProbes(probes []*probeSummary) string {
+	if len(probes) == 0 {
+		return "n/a"
+	}
+
+	descriptions := make([]string, 0, len(probes))
+	for _, probe := range probes {
+		status := "down"
+		if probe.Up {
+			status = fmt.Sprintf("up %.0f ms", probe.Latency)
+		}
+		descriptions = append(descriptions, fmt.Sprintf("%s (%.1f%% 24h)", status, probe.Uptime*100))
+	}
+
+	return strings.Join(descriptions, ", ")
+}
+
+// poolStatRows formats the stats from the pool apis and stratum probes for the mining
+// section. Each pool's hashrate is shown in MH/s like the network's, along with its part
+// of the network. Pools that are only probed get a row without stats.
+func poolStatRows(stats []*models.Pool, probes []*probeSummary, network *models.Network) []map[string]interface{} {
+	networkHashrate := 0.0
+	if network != nil {
+		networkHashrate, _ = strconv.ParseFloat(network.HashRate, 64)
+	}
+
+	probesByPool := make(map[string][]*probeSummary)
+	for _, probe := range probes {
+		probesByPool[probe.Pool] = append(probesByPool[probe.Pool], probe)
+	}
+
+	count := func(n int) string {
+		if n == 0 {
+			return "n/a"
+		}
+		return lib.RenderInteger("", n)
+	}
+
+	rows := make([]map[string]interface{}, 0, len(stats))
+	for _, pool := range stats {
+		mhs := pool.Hashrate / 1000000
+		row := map[string]interface{}{
+			"name":     pool.Name,
+			"link":     pool.Link,
+			"hashrate": fmt.Sprintf("%.2f", mhs),
+			"share":    "n/a",
+			"miners":   count(pool.Miners),
+			"workers":  count(pool.Workers),
+			"stratum":  describeProbes(probesByPool[pool.Name]),
+			"stale":    isStale(pool.UpdatedAt),
+		}
+		delete(probesByPool, pool.Name)
+
+		if networkHashrate > 0 {
+			row["share"] = fmt.Sprintf("%.1f%%", mhs/networkHashrate*100)
+		}
+
+		switch {
+		case pool.LastBlock == 0:
+			row["lastBlock"] = "n/a"
+		case pool.LastBlockTime.IsZero():
+			row["lastBlock"] = lib.RenderInteger("", int(pool.LastBlock))
+		default:
+			row["lastBlock"] = fmt.Sprintf("%s (%s)", lib.RenderInteger("", int(pool.LastBlock)), humanizeAge(pool.LastBlockTime))
+		}
+
+		rows = append(rows, row)
+	}
+
+	// pools without an api
+	for _, probe := range probes {
+		if _, ok := probesByPool[probe.Pool]; !ok {
+			continue
+		}
+
+		rows = append(rows, map[string]interface{}{
+			"name":      probe.Pool,
+			"hashrate":  "n/a",
+			"share":     "n/a",
+			"miners":    "n/a",
+			"workers":   "n/a",
+			"lastBlock": "n/a",
+			"stratum":   describeProbes(probesByPool[probe.Pool]),
+		})
+		delete(probesByPool, probe.Pool)
+	}
+
+	return rows
+}
+
+// servePoolHealth reports the stratum endpoints that are down from /health/pools, with a
+// 500 status so they can be alerted on like /health.
+func servePoolHealth(pageCache *cache.Cache, res http.ResponseWriter) {
+	down, err := pageCache.Get("/health/pools", func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		probes, err := loadProbes(conn)
+		if err != nil {
+			return "", err
+		}
+
+		down := []string{}
+		for _, probe := range probes {
+			if !probe.Up {
+				down = append(down, fmt.Sprintf("%s (%s) is down: %s", probe.Pool, probe.Endpoint, probe.Error))
+			}
+		}
+		return strings.Join(down, "\n"), nil
+	})
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	if down != "" {
+		http.Error(res, down, http.StatusInternalServerError)
+		return
+	}
+
+	res.Write([]byte("ok"))
+}
+
+// servePools returns the pool distribution as JSON from /api/pools, including the
+// unknown miners so they can be added to the pool table. The range query picks 24h or 7d.
+func servePools(pageCache *cache.Cache, res http.ResponseWriter, req *http.Request) {
+	name := req.URL.Query().Get("range")
+	if name == "" {
+		name = poolWindows[0].name
+	}
+
+	window, ok := findPoolWindow(name)
+	if !ok {
+		http.Error(res, "range must be 24h or 7d", http.StatusBadRequest)
+		return
+	}
+
+	body, err := pageCache.Get("/api/pools?range="+window.name, func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		d, err := poolDistribution(conn, getSite().pools, window)
+		if err != nil {
+			return "", err
+		}
+
+		body, err := json.Marshal(map[string]interface{}{
+			"range":        window.name,
+			"distribution": d,
+		})
+		return string(body), err
+	})
+
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, body)
+}
@@ -19,6 +19,9 @@ func PricingRollupAction() error {
 	beginning := baseTime.Add(time.Minute * -10)
 	end := baseTime.Add(time.Minute*-1 + time.Second*59)
 
-	_, err := models.GenerateAverage(conn, beginning, end)
-	return err
+	if _, err := models.GenerateAverage(conn, beginning, end); err != nil {
+		return err
+	}
+
+	return markUpdated()
 }
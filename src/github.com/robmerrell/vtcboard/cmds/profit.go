@@ -0,0 +1,337 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/charts"
+	"github.com/robmerrell/vtcboard/emission"
+	"github.com/robmerrell/vtcboard/lib"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/profit"
+	"labix.org/v2/mgo"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+// hashrateUnits are the units a hashrate can be given in, in hashes per second.
+var hashrateUnits = map[string]float64{"h": 1, "kh": 1e3, "mh": 1e6, "gh": 1e9}
+
+// defaultProfitRange is how much history the calculator shows.
+const defaultProfitRange = "30d"
+
+// profitRequest is a validated request to the profitability calculator.
+type profitRequest struct {
+	rig profit.Rig
+	rng chartRange
+
+	// the hashrate and fee as they were entered
+	hashrate float64
+	unit     string
+	fee      float64
+}
+
+// parseProfitRequest reads a rig from the query: its hashrate in unit (h, kh, mh or gh),
+// power in watts, electricity cost per kWh in USD and the pool's fee in percent.
+func parseProfitRequest(query url.Values) (*profitRequest, error) {
+	r := &profitRequest{unit: "mh", fee: 1}
+	r.rig.Cost = 0.1
+
+	number := func(key string, value *float64, min, max float64) error {
+		raw := query.Get(key)
+		if raw == "" {
+			return nil
+		}
+
+		parsed, err := strconv.ParseFloat(raw, 64)
+		// written so NaN is out of range too
+		if err != nil || !(parsed >= min && parsed <= max) {
+			return fmt.Errorf("%s must be a number from %g to %g", key, min, max)
+		}
+		*value = parsed
+		return nil
+	}
+
+	if err := number("hashrate", &r.hashrate, 0, 1e15); err != nil {
+		return nil, err
+	}
+	if r.hashrate == 0 {
+		return nil, fmt.Errorf("hashrate must be more than 0")
+	}
+
+	if unit := query.Get("unit"); unit != "" {
+		if _, ok := hashrateUnits[unit]; !ok {
+			return nil, fmt.Errorf("unit must be h, kh, mh or gh")
+		}
+		r.unit = unit
+	}
+
+	if err := number("power", &r.rig.Power, 0, 1e6); err != nil {
+		return nil, err
+	}
+	if err := number("cost", &r.rig.Cost, 0, 100); err != nil {
+		return nil, err
+	}
+	if err := number("fee", &r.fee, 0, 100); err != nil {
+		return nil, err
+	}
+
+	name := query.Get("range")
+	if name == "" {
+		name = defaultProfitRange
+	}
+	var ok bool
+	if r.rng, ok = findChartRange(name); !ok {
+		return nil, fmt.Errorf("range must be 1h, 24h, 7d, 30d, 1y or all")
+	}
+
+	r.rig.Hashrate = r.hashrate * hashrateUnits[r.unit]
+	r.rig.Fee = r.fee / 100
+	return r, nil
+}
+
+// query builds the /api/profit query for a request.
+func (r *profitRequest) query() string {
+	return fmt.Sprintf("hashrate=%g&unit=%s&power=%g&cost=%g&fee=%g&range=%s", r.hashrate, r.unit, r.rig.Power, r.rig.Cost, r.fee, r.rng.name)
+}
+
+// networkConditions returns the difficulty and block reward at a network snapshot, and
+// false if the snapshot can't be read.
+func networkConditions(network *models.Network, price float64) (profit.Conditions, bool) {
+	difficulty, err1 := strconv.ParseFloat(network.Difficulty, 64)
+	height, err2 := strconv.ParseInt(network.BlockCount, 10, 64)
+	if err1 != nil || err2 != nil {
+		return profit.Conditions{}, false
+	}
+
+	return profit.Conditions{Difficulty: difficulty, Reward: emission.Vertcoin.Reward(height + 1), Price: price}, true
+}
+
+// profitNetwork is the network and market over a range. It's the same for every rig, so
+// it's cached by range and scaled to each rig's hashrate and power.
+type profitNetwork struct {
+	Conditions profit.Conditions
+	UpdatedAt  time.Time
+
+	// what a hash per second earned per day at each network snapshot
+	Revenue []charts.Point
+}
+
+// loadProfitNetwork returns the latest conditions and the revenue history over a range,
+// from the cache if it's there.
+func loadProfitNetwork(pageCache *cache.Cache, rng chartRange) (*profitNetwork, error) {
+	body, err := pageCache.Get("profit network "+rng.name, func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		price, err := models.GetLatestPrice(conn)
+		if err != nil {
+			return "", err
+		}
+
+		network, err := models.GetLatestNetworkSnapshot(conn)
+		if err != nil {
+			return "", err
+		}
+
+		conditions, ok := networkConditions(network, price.Cryptsy.Usd)
+		if !ok {
+			return "", mgo.ErrNotFound
+		}
+
+		revenue, err := revenueHistory(conn, rng, maxChartPoints(0))
+		if err != nil {
+			return "", err
+		}
+
+		body, err := json.Marshal(&profitNetwork{Conditions: conditions, UpdatedAt: network.GeneratedAt, Revenue: revenue})
+		return string(body), err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	n := &profitNetwork{}
+	return n, json.Unmarshal([]byte(body), n)
+}
+
+// revenueHistory works out what a hash per second would have earned per day at each
+// network snapshot in a range, using the price at the time.
+func revenueHistory(conn *models.MgoConnection, rng chartRange, maxPoints int) ([]charts.Point, error) {
+	prices, _, err := priceHistory(conn, rng, "usd", maxPoints)
+	if err != nil {
+		return nil, err
+	}
+
+	since := time.Time{}
+	if rng.duration != 0 {
+		since = time.Now().UTC().Add(-rng.duration)
+	}
+	snapshots, err := models.GetNetworkSnapshotsSince(conn, since)
+	if err != nil {
+		return nil, err
+	}
+
+	points := []charts.Point{}
+	next := 0
+	for _, snapshot := range snapshots {
+		// the last price from before the snapshot
+		for next < len(prices) && !prices[next].Time.After(snapshot.GeneratedAt) {
+			next++
+		}
+		if next == 0 {
+			continue
+		}
+
+		if conditions, ok := networkConditions(snapshot, prices[next-1].Value); ok {
+			points = append(points, charts.Point{Time: snapshot.GeneratedAt, Value: profit.Revenue(conditions)})
+		}
+	}
+
+	// profit is linear in revenue, so averaging revenue averages every rig's profit
+	return charts.Downsample(points, maxPoints), nil
+}
+
+// profitResult is what the calculator works out for a rig.
+type profitResult struct {
+	Conditions profit.Conditions `json:"conditions"`
+	Estimate   profit.Estimate   `json:"estimate"`
+	BreakEven  float64           `json:"breakEvenPrice"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+
+	// profit per day at each network snapshot, times in milliseconds for flot
+	History [][2]float64 `json:"history"`
+}
+
+// calculateProfit estimates a rig's earnings now from the latest network snapshot and
+// price, and in the past from the stored snapshots and price averages.
+func calculateProfit(pageCache *cache.Cache, r *profitRequest) (*profitResult, error) {
+	network, err := loadProfitNetwork(pageCache, r.rng)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &profitResult{
+		Conditions: network.Conditions,
+		Estimate:   profit.Daily(r.rig, network.Conditions),
+		BreakEven:  profit.BreakEvenPrice(r.rig, network.Conditions),
+		UpdatedAt:  network.UpdatedAt,
+		History:    make([][2]float64, 0, len(network.Revenue)),
+	}
+	for _, p := range network.Revenue {
+		result.History = append(result.History, [2]float64{float64(p.Time.Unix()) * 1000, profit.Profit(r.rig, p.Value)})
+	}
+
+	return result, nil
+}
+
+// serveProfit returns the calculator's estimate for a rig as JSON from /api/profit, eg:
+// /api/profit?hashrate=10&unit=mh&power=300&cost=0.12&fee=1&range=30d.
+func serveProfit(pageCache *cache.Cache, res http.ResponseWriter, req *http.Request) {
+	r, err := parseProfitRequest(req.URL.Query())
+	if err != nil {
+		http.Error(res, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	result, err := calculateProfit(pageCache, r)
+	if err == mgo.ErrNotFound {
+		http.Error(res, "No network or price data yet", http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	body, err := json.Marshal(result)
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, string(body))
+}
+
+// selectOptions builds the options of a form select, marking the one that was picked or
+// the default if none was.
+func selectOptions(values, labels []string, picked, fallback string) []map[string]interface{} {
+	if picked == "" {
+		picked = fallback
+	}
+
+	options := make([]map[string]interface{}, 0, len(values))
+	for i, value := range values {
+		options = append(options, map[string]interface{}{"value": value, "label": labels[i], "selected": value == picked})
+	}
+
+	return options
+}
+
+// renderCalculator renders the calculator page. Without a hashrate only the form is shown.
+func renderCalculator(pageCache *cache.Cache, query url.Values) string {
+	rangeNames, rangeTitles := []string{}, []string{}
+	for _, r := range chartRanges {
+		rangeNames = append(rangeNames, r.name)
+		rangeTitles = append(rangeTitles, r.title)
+	}
+
+	valueMap := map[string]interface{}{
+		"hashrate": query.Get("hashrate"),
+		"power":    query.Get("power"),
+		"cost":     "0.10",
+		"fee":      "1",
+		"units":    selectOptions([]string{"h", "kh", "mh", "gh"}, []string{"H/s", "kH/s", "MH/s", "GH/s"}, query.Get("unit"), "mh"),
+		"ranges":   selectOptions(rangeNames, rangeTitles, query.Get("range"), defaultProfitRange),
+	}
+	for _, key := range []string{"cost", "fee"} {
+		if value := query.Get(key); value != "" {
+			valueMap[key] = value
+		}
+	}
+
+	if query.Get("hashrate") == "" {
+		return getSite().calculatorView.Render(valueMap)
+	}
+
+	r, err := parseProfitRequest(query)
+	if err != nil {
+		valueMap["message"] = err.Error()
+		return getSite().calculatorView.Render(valueMap)
+	}
+
+	result, err := calculateProfit(pageCache, r)
+	if err != nil {
+		valueMap["message"] = panelMessage(err, "Network or price")
+		return getSite().calculatorView.Render(valueMap)
+	}
+
+	money := func(v float64) string {
+		if v < 0 {
+			return "-$" + lib.RenderFloat("#,###.##", -v)
+		}
+		return "$" + lib.RenderFloat("#,###.##", v)
+	}
+
+	valueMap["resultOk"] = true
+	valueMap["coins"] = strconv.FormatFloat(result.Estimate.Coins, 'f', 4, 64)
+	valueMap["revenue"] = money(result.Estimate.Revenue)
+	valueMap["powerCost"] = money(result.Estimate.PowerCost)
+	valueMap["profit"] = money(result.Estimate.Profit)
+	valueMap["profitStyle"] = "profit-positive"
+	if result.Estimate.Profit < 0 {
+		valueMap["profitStyle"] = "profit-negative"
+	}
+	valueMap["breakEven"] = "$" + strconv.FormatFloat(result.BreakEven, 'f', 6, 64)
+	valueMap["difficulty"] = lib.RenderFloat("#,###.####", result.Conditions.Difficulty)
+	valueMap["reward"] = strconv.FormatFloat(result.Conditions.Reward, 'f', -1, 64)
+	valueMap["price"] = "$" + strconv.FormatFloat(result.Conditions.Price, 'f', 6, 64)
+	valueMap["updatedAge"] = humanizeAge(result.UpdatedAt)
+	valueMap["historyUrl"] = "/api/profit?" + r.query()
+	valueMap["rangeTitle"] = r.rng.title
+	valueMap["timeFormat"] = r.rng.timeFormat
+
+	return getSite().calculatorView.Render(valueMap)
+}
@@ -1,6 +1,7 @@
 package cmds
 
 import (
+	"github.com/robmerrell/vtcboard/models"
 	"github.com/robmerrell/vtcboard/updaters"
 )
 
@@ -9,17 +10,72 @@ Get updated USD and BTC buy prices from multiple exchange apis.
 `
 
 var UpdateNetworkDoc = `
-Get updated information about the Vertcoin network.
+Get updated information about the Vertcoin network from the first backend listed in
+network.backends that answers and isn't more than network.max_lag blocks behind the
+highest one. The Abe explorer, the node in [chain], and Insight and Esplora explorers
+are supported. The hashrate of explorers that don't report it is worked out from the
+difficulty. The supply is left out when the backend doesn't report it.
+`
+
+var UpdateBlocksDoc = `
+Ingest new blocks from the backend in the [chain] section of the config. The first run
+backfills the last blocks.backfill blocks. Blocks orphaned by a reorg are removed and
+replaced, a reorg deeper than blocks.max_reorg_depth stops ingestion with an error.
+`
+
+var UpdatePoolsDoc = `
+Get the hashrate, miners and last block found of every pool listed in pools.apis.
+NOMP portals, MPOS and P2Pool nodes are supported. A pool that can't be reached
+keeps its last stats.
+`
+
+var ProbeStratumDoc = `
+Connect to every endpoint in pools.stratum like a miner would, subscribing and
+authorizing pools.probe_worker, and record whether a job arrived within
+pools.probe_timeout along with how long it took. Pools going down are logged and
+reported by /health/pools.
+`
+
+var CrawlNodesDoc = `
+Crawl the p2p network from nodes.seeds, handshaking with every node found and asking
+it for its peers. Peers on private addresses are skipped unless nodes.allow_private is
+set. The number of reachable nodes, their best block heights and the versions they
+run are stored for the nodes section of the dashboard and /api/nodes.
+`
+
+var UpdateMempoolDoc = `
+Snapshot the mempool of the node at chain.rpc_url: how many transactions are waiting,
+their size, a histogram of their fee rates and the rate needed to be mined within 1, 3
+and 6 blocks. Snapshots older than mempool.history days are removed.
 `
 
 var UpdateRedditDoc = `
-Get new posts from /r/vertcoin
+Get new posts from the subreddits listed in the [posts] section of the config.
 `
 
 // UpdateAction returns a function that invokes an updaters Update method
-// to be used by comandante.
-func UpdateAction(updater updaters.Updater) func() error {
-	return func() error {
-		return updater.Update()
+// to be used by comandante. Updaters that can stop partway are stopped when the
+// lease is lost.
+func UpdateAction(updater updaters.Updater) LockedAction {
+	return func(lost <-chan bool) error {
+		var err error
+		if stoppable, ok := updater.(updaters.Stoppable); ok {
+			err = stoppable.UpdateUntil(lost)
+		} else {
+			err = updater.Update()
+		}
+		if err != nil {
+			return err
+		}
+
+		return markUpdated()
 	}
 }
+
+// markUpdated lets any running web servers know that there is new data.
+func markUpdated() error {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	return models.BumpDataVersion(conn)
+}
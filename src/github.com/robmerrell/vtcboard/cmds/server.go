@@ -5,17 +5,38 @@ import (
 	"fmt"
 	"github.com/codegangsta/martini"
 	"github.com/hoisie/mustache"
+	"github.com/robmerrell/vtcboard/broadcast"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/emission"
 	"github.com/robmerrell/vtcboard/lib"
 	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/pools"
+	"github.com/robmerrell/vtcboard/resources"
+	"io/fs"
 	"log"
-	"math"
 	"net/http"
+	"os"
+	"os/signal"
+	"path"
 	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
 var ServerDoc = `
-Starts the WDCBoard webserver.
+Starts the VTCBoard webserver using the [server] section of the config. SIGTERM
+stops it once in-flight requests finish and SIGHUP reloads the config.
+
+Live prices, network snapshots, blocks and posts are pushed as server-sent events
+from /events and over a websocket at /ws. Charts are served from /chart, an
+embeddable price ticker from /widget and a plain text summary from /txt.
+
+The JSON api is under /api: supply, blocks, pools, difficulty, nodes, mempool and
+profit, with /calculator as the profit calculator's page. /health/pools and
+/health/difficulty answer with a 500 when something needs looking at.
 `
 
 func webError(err error, res http.ResponseWriter) {
@@ -23,110 +44,362 @@ func webError(err error, res http.ResponseWriter) {
 	http.Error(res, "There was an error, try again later", 500)
 }
 
-func ServeAction() error {
-	m := martini.Classic()
-	m.Use(martini.Static("resources/public"))
+// site holds the public files, templates and pool table the server uses. It is replaced when a config
+// reload changes the resources directory.
+type site struct {
+	public         fs.FS
+	mainView       *mustache.Template
+	widgetView     *mustache.Template
+	widgetPageView *mustache.Template
+	calculatorView *mustache.Template
+	pools          *pools.Table
+}
+
+var currentSite *site
+var siteMutex sync.RWMutex
+
+// loadSite reads the public files, templates and pool table from the embedded resources,
+// overridden by any in resourcesDir.
+func loadSite(resourcesDir string) (*site, error) {
+	files := resources.FS(resourcesDir)
+	public, err := fs.Sub(files, "public")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &site{public: public}
+	views := map[string]**mustache.Template{
+		"views/main.html.mustache":        &s.mainView,
+		"views/widget.html.mustache":      &s.widgetView,
+		"views/widget_page.html.mustache": &s.widgetPageView,
+		"views/calculator.html.mustache":  &s.calculatorView,
+	}
+	for name, view := range views {
+		if *view, err = parseTemplate(files, name); err != nil {
+			return nil, err
+		}
+	}
+
+	table, err := files.Open("pools.json")
+	if err != nil {
+		return nil, err
+	}
+	defer table.Close()
+
+	if s.pools, err = pools.LoadTable(table); err != nil {
+		return nil, fmt.Errorf("pools.json: %s", err)
+	}
+
+	return s, nil
+}
+
+// getSite returns the site currently being served.
+func getSite() *site {
+	siteMutex.RLock()
+	defer siteMutex.RUnlock()
+
+	return currentSite
+}
+
+// setSite replaces the site being served.
+func setSite(s *site) {
+	siteMutex.Lock()
+	defer siteMutex.Unlock()
+
+	currentSite = s
+}
+
+// serveStatic serves files from the site's public directory, letting the request through to
+// the next handler if there isn't a matching file.
+func serveStatic(res http.ResponseWriter, req *http.Request) {
+	if req.Method != "GET" && req.Method != "HEAD" {
+		return
+	}
+
+	public := getSite().public
+	name := strings.TrimPrefix(path.Clean(req.URL.Path), "/")
+	if info, err := fs.Stat(public, name); name == "" || err != nil || info.IsDir() {
+		return
+	}
+
+	http.FileServer(http.FS(public)).ServeHTTP(res, req)
+}
+
+// parseTemplate parses the mustache template at name.
+func parseTemplate(files fs.FS, name string) (*mustache.Template, error) {
+	contents, err := fs.ReadFile(files, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return mustache.ParseString(string(contents))
+}
 
-	mainView, err := mustache.ParseFile("resources/views/main.html.mustache")
+// cachedResponse returns a response from the cache. The key should be built from the
+// parameters the response depends on, not the raw query, so junk parameters can't fill the
+// cache. compute is called to generate the response when it isn't cached.
+func cachedResponse(c *cache.Cache, res http.ResponseWriter, key string, compute func() (string, error)) string {
+	body, err := c.Get(key, compute)
 	if err != nil {
-		panic(err)
+		webError(err, res)
+		return ""
 	}
 
-	homeWriter := func(useBtc bool, res http.ResponseWriter) string {
+	return body
+}
+
+// watchDataVersion polls the data version written by the updaters and calls changed
+// whenever it moves.
+func watchDataVersion(changed func()) {
+	var lastVersion int64
+
+	for {
 		conn := models.CloneConnection()
-		defer conn.Close()
+		version, err := models.GetDataVersion(conn)
+		conn.Close()
 
-		// get the latest pricing data
-		price, err := models.GetLatestPrice(conn)
 		if err != nil {
-			webError(err, res)
-			return ""
+			log.Println(err)
+		} else if version != lastVersion {
+			lastVersion = version
+			changed()
 		}
 
-		// get data for the graph
-		averages, err := models.GetAverages(conn, 24)
+		time.Sleep(time.Duration(config.Get().Cache.Poll) * time.Second)
+	}
+}
+
+// watchConfig reloads the config whenever the process receives SIGHUP. A config that
+// doesn't validate, or whose templates don't parse, is thrown away and the current one
+// is kept. Settings that can't be changed while running are logged.
+func watchConfig(reloaded func()) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+
+	for range signals {
+		cfg, err := config.Reload()
 		if err != nil {
-			webError(err, res)
-			return ""
+			log.Printf("keeping the current config: %s", err)
+			continue
 		}
-		allAverages, err := addLatestPricesToAverages(conn, averages)
+
+		newSite, err := loadSite(cfg.Server.ResourcesDir)
 		if err != nil {
-			webError(err, res)
-			return ""
+			log.Printf("keeping the current config: %s", err)
+			continue
 		}
 
-		var graphAverages, graphValueType string
-		if useBtc {
-			graphValueType = "BTC"
-			graphAverages = parseAverages(allAverages, true)
-		} else {
-			graphValueType = "USD"
-			graphAverages = parseAverages(allAverages, false)
-		}
+		changed, needRestart := config.Changed(config.Get(), cfg)
+		config.Use(cfg)
+		setSite(newSite)
 
-		// get the forum posts
-		forum, err := models.GetLatestPosts(conn, "forum", 8)
-		if err != nil {
-			webError(err, res)
-			return ""
+		log.Printf("reloaded config from %s, changed: %s", cfg.Source(), strings.Join(changed, ", "))
+		for _, key := range needRestart {
+			log.Printf("%s changed, restart the server to apply it", key)
 		}
 
-		// /r/vertcoin posts
-		redditVertcoin, err := models.GetLatestPosts(conn, "/r/vertcoin", 8)
-		if err != nil {
-			webError(err, res)
-			return ""
+		reloaded()
+	}
+}
+
+func ServeAction() error {
+	initialSite, err := loadSite(config.Get().Server.ResourcesDir)
+	if err != nil {
+		return err
+	}
+	setSite(initialSite)
+
+	models.SetReadPreference(config.Get().Database.ReadPreference)
+
+	m := martini.Classic()
+	m.Use(serveStatic)
+
+	// rendered pages are cached until they expire or an updater writes new data, which is
+	// also when it's sent to live clients
+	pageCache := cache.New(time.Duration(config.Get().Cache.TTL)*time.Second, config.Get().Cache.MaxEntries)
+	hub := broadcast.NewHub()
+	publisher := newLivePublisher(hub)
+	chartCache := cache.New(chartBucket, config.Get().Cache.MaxEntries)
+	go watchDataVersion(func() {
+		pageCache.Flush()
+		chartCache.Prune()
+		publisher.publish()
+	})
+
+	// pages may look different after a reload, so throw out everything that was cached
+	go watchConfig(func() {
+		pageCache.SetTTL(time.Duration(config.Get().Cache.TTL) * time.Second)
+		pageCache.SetMaxEntries(config.Get().Cache.MaxEntries)
+		chartCache.SetMaxEntries(config.Get().Cache.MaxEntries)
+		pageCache.Flush()
+	})
+
+	homeWriter := func(useBtc bool, rng chartRange) string {
+		d := loadDashboard()
+
+		// stat boxes
+		valueMap := map[string]interface{}{
+			"priceOk":      d.Price != nil,
+			"networkOk":    d.Network != nil,
+			"hasMarketCap": d.Price != nil && d.Network != nil,
 		}
 
-		// /r/vertmarket posts
-		redditVertmarket, err := models.GetLatestPosts(conn, "/r/vertmarket", 8)
-		if err != nil {
-			webError(err, res)
-			return ""
+		if d.Price != nil {
+			valueMap["priceStale"] = isStale(d.Price.GeneratedAt)
+			valueMap["priceAge"] = humanizeAge(d.Price.GeneratedAt)
+		} else {
+			valueMap["priceMessage"] = panelMessage(d.PriceErr, "Price")
 		}
 
-		// /r/vertmining posts
-		redditVertcoinMining, err := models.GetLatestPosts(conn, "/r/vertcoinmining", 8)
-		if err != nil {
-			webError(err, res)
-			return ""
+		if d.Network != nil {
+			valueMap["networkStale"] = isStale(d.Network.GeneratedAt)
+			valueMap["networkAge"] = humanizeAge(d.Network.GeneratedAt)
+
+			if info, ok := networkSupply(d.Network, d.BlockTime); ok {
+				valueMap["blockReward"] = strconv.FormatFloat(info.Reward, 'f', -1, 64)
+				if info.HalvingEstimate != nil {
+					valueMap["halvingOk"] = true
+					valueMap["nextHalving"] = lib.RenderInteger("", int(info.NextHalving))
+					valueMap["halvingBlocks"] = lib.RenderInteger("", int(info.HalvingBlocks))
+					valueMap["halvingDate"] = info.HalvingEstimate.Format("Jan 2, 2006")
+				}
+			}
+		} else {
+			valueMap["networkMessage"] = panelMessage(d.NetworkErr, "Mining")
 		}
 
-		// get the mining information
-		network, err := models.GetLatestNetworkSnapshot(conn)
-		if err != nil {
-			webError(err, res)
-			return ""
+		// difficulty retarget, missing until update_blocks has run
+		if d.Difficulty != nil {
+			for key, value := range difficultyValues(d.Difficulty) {
+				valueMap[key] = value
+			}
 		}
 
-		// generate the HTML
-		valueMap := map[string]interface{}{
-			"redditVertcoin":       redditVertcoin,
-			"redditVertmarket":     redditVertmarket,
-			"redditVertcoinMining": redditVertcoinMining,
-			"forum":                forum,
-			"averages":             graphAverages,
-			"graphValueType":       graphValueType,
-			"showBtcLink":          !useBtc,
-			"showUsdLink":          useBtc,
+		// recent blocks
+		if d.BlocksErr != nil {
+			valueMap["blocksMessage"] = panelMessage(d.BlocksErr, "Block")
+		} else if len(d.Blocks) == 0 {
+			valueMap["blocksMessage"] = "No blocks yet"
 		}
+		valueMap["recentBlocks"] = blockRows(d.Blocks)
 
-		return mainView.Render(generateTplVars(price, network), valueMap)
-	}
+		// pool apis
+		if d.PoolStatsErr != nil || d.ProbesErr != nil {
+			valueMap["poolStatsMessage"] = "Pool data is unavailable right now"
+		}
+		poolStats := poolStatRows(d.PoolStats, d.Probes, d.Network)
+		valueMap["poolStats"] = poolStats
+		valueMap["hasPoolStats"] = len(poolStats) > 0
+
+		// pool distribution
+		switch {
+		case d.PoolsErr != nil:
+			valueMap["poolsMessage"] = panelMessage(d.PoolsErr, "Pool")
+		case len(d.PoolShares) == 0 || d.PoolShares[len(d.PoolShares)-1].Blocks == 0:
+			valueMap["poolsMessage"] = "No blocks yet"
+		default:
+			valueMap["poolWarning"] = dominanceWarning(d.PoolShares[0])
+
+			poolPanels := make([]map[string]interface{}, 0, len(poolWindows))
+			for i, window := range poolWindows {
+				poolPanels = append(poolPanels, map[string]interface{}{
+					"title":  window.title,
+					"blocks": d.PoolShares[i].Blocks,
+					"pools":  poolRows(d.PoolShares[i]),
+					"url":    "/api/pools?range=" + window.name,
+				})
+			}
+			valueMap["poolPanels"] = poolPanels
+		}
 
-	m.Get("/", func(res http.ResponseWriter) string {
-		return homeWriter(false, res)
-	})
+		// p2p network
+		if d.Nodes != nil {
+			for key, value := range nodeValues(d.Nodes) {
+				valueMap[key] = value
+			}
+		} else {
+			valueMap["nodesMessage"] = panelMessage(d.NodesErr, "Node")
+		}
 
-	m.Get("/:graphValue", func(params martini.Params, res http.ResponseWriter) string {
-		var useBtc bool
-		if params["graphValue"] == "usd" {
-			useBtc = false
+		// mempool and fees
+		if d.Mempool != nil {
+			for key, value := range mempoolValues(d.Mempool) {
+				valueMap[key] = value
+			}
 		} else {
-			useBtc = true
+			valueMap["mempoolMessage"] = panelMessage(d.MempoolErr, "Mempool")
 		}
 
-		return homeWriter(useBtc, res)
+		// the graph loads its data from /chart/price.json, every range and currency has its own url
+		graphValueType := "USD"
+		currencyPath := "/"
+		if useBtc {
+			graphValueType = "BTC"
+			currencyPath = "/btc"
+		}
+		valueMap["graphValueType"] = graphValueType
+		valueMap["currency"] = strings.ToLower(graphValueType)
+		valueMap["showBtcLink"] = !useBtc
+		valueMap["showUsdLink"] = useBtc
+		valueMap["chartRange"] = rng.name
+		valueMap["chartTitle"] = rng.title
+		valueMap["timeFormat"] = rng.timeFormat
+		valueMap["usdLink"] = "/?range=" + rng.name
+		valueMap["btcLink"] = "/btc?range=" + rng.name
+
+		rangeLinks := make([]map[string]interface{}, 0, len(chartRanges))
+		for _, r := range chartRanges {
+			rangeLinks = append(rangeLinks, map[string]interface{}{
+				"name":   r.name,
+				"url":    currencyPath + "?range=" + r.name,
+				"active": r.name == rng.name,
+			})
+		}
+		valueMap["rangeLinks"] = rangeLinks
+
+		// posts from each source
+		sources := config.Get().Posts.Sources
+		postPanels := make([]map[string]interface{}, 0, len(sources))
+		for _, source := range sources {
+			panel := map[string]interface{}{"name": source, "posts": d.Posts[source]}
+			if err := d.PostsErr[source]; err != nil {
+				panel["message"] = panelMessage(err, source)
+			} else if len(d.Posts[source]) == 0 {
+				panel["message"] = "No posts yet"
+			}
+
+			postPanels = append(postPanels, panel)
+		}
+		valueMap["postPanels"] = postPanels
+
+		return getSite().mainView.Render(generateTplVars(d.Price, d.Network), valueMap)
+	}
+
+	m.Get("/chart/:file", serveChart(pageCache, chartCache))
+	m.Get("/widget/:file", serveWidget(pageCache))
+	m.Get("/api/supply", func(res http.ResponseWriter) {
+		serveSupply(pageCache, res)
+	})
+	m.Get("/api/profit", func(res http.ResponseWriter, req *http.Request) {
+		serveProfit(pageCache, res, req)
+	})
+	m.Get("/api/difficulty", func(res http.ResponseWriter) {
+		serveDifficulty(pageCache, res)
+	})
+	m.Get("/api/nodes", func(res http.ResponseWriter, req *http.Request) {
+		serveNodes(pageCache, res, req)
+	})
+	m.Get("/api/mempool", func(res http.ResponseWriter, req *http.Request) {
+		serveMempool(pageCache, res, req)
+	})
+	m.Get("/api/pools", func(res http.ResponseWriter, req *http.Request) {
+		servePools(pageCache, res, req)
+	})
+	m.Get("/api/blocks", func(res http.ResponseWriter, req *http.Request) {
+		serveBlocks(pageCache, res, req)
+	})
+	m.Get("/api/blocks/:id", func(params martini.Params, res http.ResponseWriter, req *http.Request) {
+		serveBlock(pageCache, params["id"], res, req)
 	})
 
 	// returns basic information about the state of the service. If any hardcoded checks fail
@@ -165,79 +438,129 @@ func ServeAction() error {
 		return "ok"
 	})
 
-	log.Printf("listening on port 4000")
-	http.ListenAndServe(":4000", m)
+	// returns the stratum endpoints that are down with a 500 status, or ok
+	m.Get("/health/pools", func(res http.ResponseWriter) {
+		servePoolHealth(pageCache, res)
+	})
 
-	return nil
-}
+	// returns the warning about unusually fast or slow blocks with a 500 status, or ok
+	m.Get("/health/difficulty", func(res http.ResponseWriter) {
+		serveDifficultyHealth(pageCache, res)
+	})
 
-// generateTplVars generates a map to pass into the template
-func generateTplVars(price *models.Price, network *models.Network) map[string]string {
-	// apply the necessary style for the percent change box
-	changeStyle := "percent-change-stat-up"
-	if price.Cryptsy.PercentChange != "" && string(price.Cryptsy.PercentChange[0]) == "-" {
-		changeStyle = "percent-change-stat-down"
-	}
+	// the chart range comes from the query so links to a range can be shared. An unknown
+	// range falls back to the default.
+	chartRangeFor := func(req *http.Request) chartRange {
+		if rng, ok := findChartRange(req.URL.Query().Get("range")); ok {
+			return rng
+		}
 
-	percentChange := "100"
-	if price.Cryptsy.PercentChange != "" {
-		percentChange = price.Cryptsy.PercentChange
+		rng, _ := findChartRange(defaultChartRange)
+		return rng
 	}
 
-	// marketcap
-	minedNum, _ := strconv.Atoi(network.Mined)
-	marketCap := float64(minedNum) * price.Cryptsy.Usd
-
-	// coins left to be mined
-	remainingCoins := 84000000 - minedNum
-
-	vars := map[string]string{
-		"usd":         lib.RenderFloat("", price.Cryptsy.Usd),
-		"btc":         strconv.FormatFloat(price.Cryptsy.Btc, 'f', 8, 64),
-		"marketCap":   lib.RenderInteger("", int(marketCap)),
-		"change":      percentChange,
-		"changeStyle": changeStyle,
-
-		"hashRate":   lib.RenderFloatFromString("", network.HashRate),
-		"difficulty": lib.RenderFloatFromString("", network.Difficulty),
-		"mined":      lib.RenderIntegerFromString("", network.Mined),
-		"remaining":  lib.RenderInteger("", remainingCoins),
-	}
+	// terminals get a text summary from /txt, or from / if they ask for text/plain
+	m.Get("/txt", func(res http.ResponseWriter, req *http.Request) {
+		serveText(pageCache, res, req)
+	})
 
-	return vars
+	m.Get("/", func(res http.ResponseWriter, req *http.Request) string {
+		res.Header().Set("Vary", "Accept")
+		if wantsText(req) {
+			serveText(pageCache, res, req)
+			return ""
+		}
+
+		rng := chartRangeFor(req)
+		return cachedResponse(pageCache, res, "/?range="+rng.name, func() (string, error) {
+			return homeWriter(false, rng), nil
+		})
+	})
+
+	// the network history behind the calculator is cached by range, each rig is worked
+	// out from it per request
+	m.Get("/calculator", func(req *http.Request) string {
+		return renderCalculator(pageCache, req.URL.Query())
+	})
+
+	// /usd and /btc pick the currency the graph is drawn in. This catches every single
+	// segment path, so it has to come after any other route like that.
+	m.Get("/:graphValue", func(params martini.Params, res http.ResponseWriter, req *http.Request) string {
+		var useBtc bool
+		switch params["graphValue"] {
+		case "usd":
+			useBtc = false
+		case "btc":
+			useBtc = true
+		default:
+			http.NotFound(res, req)
+			return ""
+		}
+
+		rng := chartRangeFor(req)
+		return cachedResponse(pageCache, res, "/"+params["graphValue"]+"?range="+rng.name, func() (string, error) {
+			return homeWriter(useBtc, rng), nil
+		})
+	})
+
+	// the live streams are served outside of martini so they can control their own connections
+	mux := http.NewServeMux()
+	mux.Handle("/events", serveEvents(hub))
+	mux.Handle("/ws", serveWebsocket(hub, publisher))
+	mux.Handle("/", m)
+
+	return listenAndServe(mux, hub.Close)
 }
 
-// parseAverages takes a slice of averages and returns a string representation for flot to graph
-func parseAverages(averages []*models.Average, useBtcField bool) string {
-	var format string
-	if useBtcField {
-		format = "[%g, %.8f]"
-	} else {
-		format = "[%g, %.2f]"
-	}
+// generateTplVars generates a map to pass into the template. Either the price or the
+// network can be nil, in which case only the values that don't depend on it are set.
+func generateTplVars(price *models.Price, network *models.Network) map[string]string {
+	vars := map[string]string{}
 
-	parsed := ""
-	for i, average := range averages {
-		if math.IsNaN(average.Cryptsy.Usd) || math.IsNaN(average.Cryptsy.Btc) {
-			continue
+	if price != nil {
+		// apply the necessary style for the percent change box
+		changeStyle := "percent-change-stat-up"
+		if price.Cryptsy.PercentChange != "" && string(price.Cryptsy.PercentChange[0]) == "-" {
+			changeStyle = "percent-change-stat-down"
 		}
 
-		timeIndex := float64(average.TimeBlock.Unix()) * 1000.0
-		var value float64
-		if useBtcField {
-			value = average.Cryptsy.Btc
-		} else {
-			value = average.Cryptsy.Usd
+		percentChange := "100"
+		if price.Cryptsy.PercentChange != "" {
+			percentChange = price.Cryptsy.PercentChange
 		}
 
-		parsed += fmt.Sprintf(format, timeIndex, value)
+		vars["usd"] = lib.RenderFloat("", price.Cryptsy.Usd)
+		vars["btc"] = strconv.FormatFloat(price.Cryptsy.Btc, 'f', 8, 64)
+		vars["change"] = percentChange
+		vars["changeStyle"] = changeStyle
+	}
+
+	// supply comes from the emission schedule at the snapshot's block height, falling back
+	// to the backend's count of mined coins if the height isn't known
+	var supply float64
+	if network != nil {
+		supply, _ = strconv.ParseFloat(network.Mined, 64)
+		remaining := float64(emission.Vertcoin.MaxSupply) - supply
+		if info, ok := networkSupply(network, 0); ok {
+			supply, remaining = info.Supply, info.Remaining
+		}
 
-		if i < len(averages)-1 {
-			parsed += ","
+		vars["hashRate"] = lib.RenderFloatFromString("", network.HashRate)
+		vars["difficulty"] = lib.RenderFloatFromString("", network.Difficulty)
+		vars["mined"] = lib.RenderIntegerFromString("", network.Mined)
+		if network.Mined == "" {
+			vars["mined"] = lib.RenderInteger("", int(supply))
 		}
+		vars["remaining"] = lib.RenderInteger("", int(remaining))
 	}
 
-	return parsed
+	// marketcap
+	if price != nil && network != nil {
+		marketCap := supply * price.Cryptsy.Usd
+		vars["marketCap"] = lib.RenderInteger("", int(marketCap))
+	}
+
+	return vars
 }
 
 // addLatestPriceToAverages appends the latest 10 minutes of price data onto the list of averages
@@ -0,0 +1,123 @@
+package cmds
+
+import (
+	"encoding/json"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/emission"
+	"github.com/robmerrell/vtcboard/models"
+	"labix.org/v2/mgo"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// supplyInfo is the coin supply at a network snapshot according to the emission schedule.
+type supplyInfo struct {
+	Height      int64   `json:"height"`
+	Supply      float64 `json:"supply"`
+	Reported    float64 `json:"reportedSupply,omitempty"`
+	Discrepancy float64 `json:"supplyDiscrepancy"`
+	Remaining   float64 `json:"remaining"`
+	MaxSupply   int64   `json:"maxSupply"`
+	Reward      float64 `json:"blockReward"`
+
+	// seconds between recent blocks, or the target when it isn't known
+	BlockTime float64 `json:"blockTime"`
+
+	NextHalving     int64      `json:"nextHalving,omitempty"`
+	HalvingBlocks   int64      `json:"halvingBlocks,omitempty"`
+	HalvingEstimate *time.Time `json:"halvingEstimate,omitempty"`
+}
+
+// networkSupply works out the supply at a network snapshot. blockTime is the recent
+// time between blocks and is used to estimate when the next halving happens, 0 uses
+// the target block time. It returns false if the snapshot doesn't have a block height.
+func networkSupply(network *models.Network, blockTime time.Duration) (*supplyInfo, bool) {
+	height, err := strconv.ParseInt(network.BlockCount, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+
+	schedule := emission.Vertcoin
+	if blockTime <= 0 {
+		blockTime = schedule.BlockTime
+	}
+
+	info := &supplyInfo{
+		Height:    height,
+		Supply:    schedule.SupplyAt(height),
+		Remaining: schedule.Remaining(height),
+		MaxSupply: schedule.MaxSupply,
+		Reward:    schedule.Reward(height + 1),
+		BlockTime: blockTime.Seconds(),
+	}
+
+	// backends that don't count the mined coins leave them out of the snapshot
+	if reported, err := strconv.ParseFloat(network.Mined, 64); err == nil {
+		info.Reported = reported
+		info.Discrepancy = schedule.Discrepancy(height, reported)
+	}
+
+	if countdown, ok := schedule.HalvingCountdown(height, blockTime, network.GeneratedAt); ok {
+		info.NextHalving = countdown.Height
+		info.HalvingBlocks = countdown.Blocks
+		info.HalvingEstimate = &countdown.Estimated
+	}
+
+	return info, true
+}
+
+// recentBlockTime returns the average time between blocks over the last day of network
+// snapshots, or 0 if there aren't enough of them to tell.
+func recentBlockTime(conn *models.MgoConnection) (time.Duration, error) {
+	snapshots, err := models.GetNetworkSnapshotsSince(conn, time.Now().UTC().Add(time.Hour*-24))
+	if err != nil || len(snapshots) < 2 {
+		return 0, err
+	}
+
+	first, last := snapshots[0], snapshots[len(snapshots)-1]
+	firstHeight, err1 := strconv.ParseInt(first.BlockCount, 10, 64)
+	lastHeight, err2 := strconv.ParseInt(last.BlockCount, 10, 64)
+	if err1 != nil || err2 != nil {
+		return 0, nil
+	}
+
+	return emission.AverageBlockTime(firstHeight, first.GeneratedAt, lastHeight, last.GeneratedAt), nil
+}
+
+// serveSupply returns the supply and halving countdown as JSON from /api/supply.
+func serveSupply(pageCache *cache.Cache, res http.ResponseWriter) {
+	body, err := pageCache.Get("/api/supply", func() (string, error) {
+		conn := models.CloneConnection()
+		defer conn.Close()
+
+		network, err := models.GetLatestNetworkSnapshot(conn)
+		if err != nil {
+			return "", err
+		}
+
+		blockTime, err := recentBlockTime(conn)
+		if err != nil {
+			return "", err
+		}
+
+		info, ok := networkSupply(network, blockTime)
+		if !ok {
+			return "", mgo.ErrNotFound
+		}
+
+		body, err := json.Marshal(info)
+		return string(body), err
+	})
+
+	if err == mgo.ErrNotFound {
+		http.Error(res, panelMessage(err, "Network"), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	writeJSON(res, body)
+}
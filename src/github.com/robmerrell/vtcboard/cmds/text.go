@@ -0,0 +1,176 @@
+package cmds
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/charts"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// headlines shown per source in the text summary
+const textHeadlines = 3
+
+// sparkline width in the text summary
+const textSparklineWidth = 48
+
+// ANSI escape codes used when the client is a terminal.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiDim   = "\x1b[2m"
+	ansiGreen = "\x1b[32m"
+	ansiRed   = "\x1b[31m"
+)
+
+// textOptions control how the text summary is written.
+type textOptions struct {
+	color bool
+	ascii bool
+}
+
+// parseTextOptions picks colors for curl unless the query says otherwise with color=0 or
+// color=1. ascii=1 swaps the sparkline's block characters for plain ASCII.
+func parseTextOptions(req *http.Request) textOptions {
+	o := textOptions{color: strings.HasPrefix(req.UserAgent(), "curl/")}
+
+	switch req.URL.Query().Get("color") {
+	case "0", "false":
+		o.color = false
+	case "1", "true":
+		o.color = true
+	}
+
+	o.ascii = req.URL.Query().Get("ascii") == "1" || req.URL.Query().Get("ascii") == "true"
+	return o
+}
+
+// wantsText reports if a request asks for plain text rather than a page.
+func wantsText(req *http.Request) bool {
+	accept := req.Header.Get("Accept")
+	return strings.Contains(accept, "text/plain") && !strings.Contains(accept, "text/html")
+}
+
+// renderText writes a summary of the dashboard for reading in a terminal.
+func renderText(o textOptions) (string, error) {
+	d := loadDashboard()
+
+	style := func(code, text string) string {
+		if !o.color {
+			return text
+		}
+		return code + text + ansiReset
+	}
+
+	var buf bytes.Buffer
+	line := func(label, value string) {
+		fmt.Fprintf(&buf, "%-12s%s\n", label, value)
+	}
+
+	fmt.Fprintf(&buf, "%s\n\n", style(ansiBold, "VTCBoard - Vertcoin dashboard"))
+
+	vars := generateTplVars(d.Price, d.Network)
+
+	if d.Price != nil {
+		change := vars["change"] + "%"
+		if vars["changeStyle"] == "percent-change-stat-down" {
+			change = style(ansiRed, change)
+		} else {
+			change = style(ansiGreen, change)
+		}
+
+		line("Price", fmt.Sprintf("$%s  %s BTC  %s", vars["usd"], vars["btc"], change))
+		if marketCap, ok := vars["marketCap"]; ok {
+			line("Market cap", "$"+marketCap)
+		}
+		if isStale(d.Price.GeneratedAt) {
+			line("", style(ansiDim, "prices last updated "+humanizeAge(d.Price.GeneratedAt)))
+		}
+	} else {
+		line("Price", panelMessage(d.PriceErr, "Price"))
+	}
+
+	if d.Network != nil {
+		line("Hashrate", vars["hashRate"])
+		line("Difficulty", vars["difficulty"])
+		line("Mined", vars["mined"])
+		line("Remaining", vars["remaining"])
+	} else {
+		line("Network", panelMessage(d.NetworkErr, "Mining"))
+	}
+
+	// the last day of prices
+	conn := models.CloneConnection()
+	day, _ := findChartRange("24h")
+	points, _, err := priceHistory(conn, day, "usd", textSparklineWidth)
+	conn.Close()
+	if err != nil {
+		log.Println(err)
+		fmt.Fprintf(&buf, "\n%-12s%s\n", "24h", panelMessage(err, "Price history"))
+	} else if sparkline := charts.Text(points, textSparklineWidth, o.ascii); sparkline != "" {
+		low, high := points[0].Value, points[0].Value
+		for _, p := range points {
+			if p.Value < low {
+				low = p.Value
+			}
+			if p.Value > high {
+				high = p.Value
+			}
+		}
+
+		fmt.Fprintf(&buf, "\n%-12s%s\n", "24h", style(ansiGreen, sparkline))
+		line("", style(ansiDim, fmt.Sprintf("low $%.4f  high $%.4f", low, high)))
+	}
+
+	for _, source := range config.Get().Posts.Sources {
+		fmt.Fprintf(&buf, "\n%s\n", style(ansiBold, source))
+
+		if err := d.PostsErr[source]; err != nil {
+			fmt.Fprintf(&buf, "  %s\n", panelMessage(err, source))
+			continue
+		}
+
+		posts := d.Posts[source]
+		if len(posts) > textHeadlines {
+			posts = posts[:textHeadlines]
+		}
+		for _, post := range posts {
+			fmt.Fprintf(&buf, "  - %s\n    %s\n", plainText(post.Title), style(ansiDim, plainText(post.Url)))
+		}
+	}
+
+	return buf.String(), nil
+}
+
+// plainText drops control characters from text that came from elsewhere, like a post's
+// title, so it can't move the cursor or change colors in the terminal it's printed in.
+func plainText(text string) string {
+	return strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f || (r >= 0x80 && r < 0xa0) {
+			return -1
+		}
+		return r
+	}, text)
+}
+
+// serveText writes the text summary, cached with the pages since it shows the same data.
+func serveText(pageCache *cache.Cache, res http.ResponseWriter, req *http.Request) {
+	o := parseTextOptions(req)
+	key := fmt.Sprintf("/txt?color=%t&ascii=%t", o.color, o.ascii)
+
+	body, err := pageCache.Get(key, func() (string, error) {
+		return renderText(o)
+	})
+	if err != nil {
+		webError(err, res)
+		return
+	}
+
+	res.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	res.Header().Set("Vary", "Accept, User-Agent")
+	res.Write([]byte(body))
+}
@@ -0,0 +1,190 @@
+package cmds
+
+import (
+	"code.google.com/p/go.net/websocket"
+	"encoding/json"
+	"fmt"
+	"github.com/robmerrell/vtcboard/broadcast"
+	"github.com/robmerrell/vtcboard/config"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// wsRequest is a message sent by a websocket client, eg:
+//
+//	{"action": "subscribe", "channel": "price:cryptsy"}
+//	{"action": "unsubscribe", "channel": "posts:/r/vertcoin"}
+//	{"action": "ping"}
+type wsRequest struct {
+	Action  string `json:"action"`
+	Channel string `json:"channel"`
+}
+
+// wsMessage is a message sent to a websocket client. Type is one of event, subscribed,
+// unsubscribed, ping, pong or error.
+type wsMessage struct {
+	Type    string      `json:"type"`
+	Channel string      `json:"channel,omitempty"`
+	Data    interface{} `json:"data,omitempty"`
+	Message string      `json:"message,omitempty"`
+}
+
+// validChannel reports if clients can subscribe to a channel.
+func validChannel(channel string) bool {
+	switch channel {
+	case "price", "network", "blocks":
+		return true
+	}
+
+	if exchange := strings.TrimPrefix(channel, "price:"); exchange != channel {
+		for _, name := range exchanges {
+			if name == exchange {
+				return true
+			}
+		}
+	}
+
+	if source := strings.TrimPrefix(channel, "posts:"); source != channel {
+		for _, name := range config.Get().Posts.Sources {
+			if name == source {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// rateLimiter is a token bucket allowing rate messages a second in bursts of up to burst.
+type rateLimiter struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate, burst int) *rateLimiter {
+	return &rateLimiter{rate: float64(rate), burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow reports if another message can be handled right now.
+func (r *rateLimiter) allow() bool {
+	now := time.Now()
+	r.tokens += now.Sub(r.last).Seconds() * r.rate
+	if r.tokens > r.burst {
+		r.tokens = r.burst
+	}
+	r.last = now
+
+	if r.tokens < 1 {
+		return false
+	}
+
+	r.tokens--
+	return true
+}
+
+// serveWebsocket lets programs subscribe to channels of live data. Subscribing sends
+// the latest event on the channel straight away so clients don't have to wait for the
+// next update. Origin isn't checked since most clients aren't browsers.
+func serveWebsocket(hub *broadcast.Hub, publisher *livePublisher) http.Handler {
+	return websocket.Server{
+		Handshake: func(cfg *websocket.Config, req *http.Request) (err error) {
+			cfg.Origin, err = websocket.Origin(cfg, req)
+			return err
+		},
+		Handler: func(ws *websocket.Conn) {
+			settings := config.Get().Live
+
+			subscriber := hub.Subscribe(settings.Buffer)
+			defer hub.Unsubscribe(subscriber)
+
+			// requests are read on their own goroutine so that every write happens below
+			requests := make(chan wsRequest)
+			closed := make(chan bool)
+			done := make(chan bool)
+			defer close(done)
+
+			go func() {
+				defer close(closed)
+				for {
+					var request wsRequest
+					if err := websocket.JSON.Receive(ws, &request); err != nil {
+						// a message that isn't JSON gets an error reply, anything else ends the connection
+						if _, ok := err.(*json.SyntaxError); !ok {
+							return
+						}
+					}
+
+					select {
+					case requests <- request:
+					case <-done:
+						return
+					}
+				}
+			}()
+
+			send := func(message wsMessage) bool {
+				ws.SetWriteDeadline(time.Now().Add(time.Duration(settings.WriteTimeout) * time.Second))
+				return websocket.JSON.Send(ws, message) == nil
+			}
+
+			heartbeat := time.NewTicker(time.Duration(settings.Heartbeat) * time.Second)
+			defer heartbeat.Stop()
+
+			limiter := newRateLimiter(settings.ClientRate, settings.ClientBurst)
+			channels := map[string]bool{}
+
+			for {
+				var ok bool
+				select {
+				case <-closed:
+					return
+
+				case <-heartbeat.C:
+					ok = send(wsMessage{Type: "ping"})
+
+				case e, open := <-subscriber.Events:
+					if !open {
+						return
+					}
+					ok = !channels[e.Channel] || send(wsMessage{Type: "event", Channel: e.Channel, Data: e.Data})
+
+				case request := <-requests:
+					if !limiter.allow() {
+						ok = send(wsMessage{Type: "error", Message: "rate limit exceeded, slow down"})
+						break
+					}
+
+					switch request.Action {
+					case "subscribe":
+						if !validChannel(request.Channel) {
+							ok = send(wsMessage{Type: "error", Channel: request.Channel, Message: "unknown channel"})
+							break
+						}
+
+						channels[request.Channel] = true
+						ok = send(wsMessage{Type: "subscribed", Channel: request.Channel})
+						if e, found := publisher.snapshot(request.Channel); ok && found {
+							ok = send(wsMessage{Type: "event", Channel: e.Channel, Data: e.Data})
+						}
+					case "unsubscribe":
+						delete(channels, request.Channel)
+						ok = send(wsMessage{Type: "unsubscribed", Channel: request.Channel})
+					case "ping":
+						ok = send(wsMessage{Type: "pong"})
+					case "":
+						ok = send(wsMessage{Type: "error", Message: "messages must be JSON objects with an action"})
+					default:
+						ok = send(wsMessage{Type: "error", Message: fmt.Sprintf("unknown action %q", request.Action)})
+					}
+				}
+
+				if !ok {
+					return
+				}
+			}
+		},
+	}
+}
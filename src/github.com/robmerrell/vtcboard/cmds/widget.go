@@ -0,0 +1,179 @@
+package cmds
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/martini"
+	"github.com/robmerrell/vtcboard/cache"
+	"github.com/robmerrell/vtcboard/charts"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// widgetThemes are the colors of the ticker widget, matching the chart themes.
+var widgetThemes = map[string]map[string]string{
+	"light": {"background": "#ffffff", "text": "#0c0c0c", "border": "#c2c2c2"},
+	"dark":  {"background": "#222222", "text": "#cccccc", "border": "#3a3a3a"},
+}
+
+// widgetOptions are the settings a ticker widget can be embedded with.
+type widgetOptions struct {
+	currency  string
+	theme     string
+	sparkline bool
+	width     int
+}
+
+// parseWidgetOptions reads the widget settings from the query, using defaults for
+// anything left out.
+func parseWidgetOptions(query url.Values) (*widgetOptions, error) {
+	o := &widgetOptions{currency: "usd", theme: "light", width: 200}
+
+	if currency := query.Get("currency"); currency != "" {
+		if currency != "usd" && currency != "btc" {
+			return nil, fmt.Errorf("currency must be usd or btc")
+		}
+		o.currency = currency
+	}
+
+	if theme := query.Get("theme"); theme != "" {
+		if _, ok := widgetThemes[theme]; !ok {
+			return nil, fmt.Errorf("theme must be light or dark")
+		}
+		o.theme = theme
+	}
+
+	if width := query.Get("width"); width != "" {
+		value, err := strconv.Atoi(width)
+		if err != nil || value < 120 || value > 600 {
+			return nil, fmt.Errorf("width must be between 120 and 600")
+		}
+		o.width = value
+	}
+
+	o.sparkline = query.Get("sparkline") == "1" || query.Get("sparkline") == "true"
+
+	return o, nil
+}
+
+// renderWidget renders the ticker widget as an HTML fragment with inline styles so it
+// doesn't depend on the page it's embedded in.
+func renderWidget(o *widgetOptions, siteUrl string) (string, error) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	// a missing network snapshot only means there's no market cap, which the widget doesn't show
+	price, priceErr := models.GetLatestPrice(conn)
+	network, _ := models.GetLatestNetworkSnapshot(conn)
+	if priceErr != nil {
+		price = nil
+	}
+
+	valueMap := map[string]interface{}{
+		"siteUrl":     siteUrl,
+		"width":       o.width,
+		"priceOk":     price != nil,
+		"usdCurrency": o.currency == "usd",
+	}
+	for key, value := range widgetThemes[o.theme] {
+		valueMap[key] = value
+	}
+
+	if price == nil {
+		valueMap["priceMessage"] = panelMessage(priceErr, "Price")
+	} else {
+		valueMap["changeColor"] = "#27ae60"
+		if generateTplVars(price, nil)["changeStyle"] == "percent-change-stat-down" {
+			valueMap["changeColor"] = "#c0392b"
+		}
+	}
+
+	if price != nil && o.sparkline {
+		opts := charts.Options{Width: o.width - 20, Height: 30, Theme: charts.Themes[o.theme], Sparkline: true}
+		day, _ := findChartRange("24h")
+		points, _, err := priceHistory(conn, day, o.currency, opts.Width)
+		if err != nil {
+			return "", err
+		}
+
+		valueMap["sparkline"] = charts.SVG(points, opts)
+	}
+
+	return getSite().widgetView.Render(generateTplVars(price, network), valueMap), nil
+}
+
+// widgetScript wraps the widget in a script that inserts it after its own script tag.
+func widgetScript(widget string) (string, error) {
+	html, err := json.Marshal(widget)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf(`(function() {
+  var scripts = document.getElementsByTagName("script");
+  var script = document.currentScript || scripts[scripts.length - 1];
+  var widget = document.createElement("div");
+  widget.innerHTML = %s;
+  script.parentNode.insertBefore(widget, script.nextSibling);
+})();
+`, html), nil
+}
+
+// serveWidget serves the price ticker that other sites can embed, either as a script,
+// eg: <script src="/widget/ticker.js?currency=btc&sparkline=1"></script>, or as a page
+// for an iframe from /widget/ticker.html. Both can be loaded from anywhere and cached.
+func serveWidget(pageCache *cache.Cache) martini.Handler {
+	return func(params martini.Params, res http.ResponseWriter, req *http.Request) {
+		file := params["file"]
+		if file != "ticker.js" && file != "ticker.html" {
+			http.NotFound(res, req)
+			return
+		}
+
+		o, err := parseWidgetOptions(req.URL.Query())
+		if err != nil {
+			http.Error(res, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		key := fmt.Sprintf("/widget/%s?currency=%s&theme=%s&sparkline=%t&width=%d", file, o.currency, o.theme, o.sparkline, o.width)
+
+		body, err := pageCache.Get(key, func() (string, error) {
+			widget, err := renderWidget(o, config.Get().Server.SiteURL)
+			if err != nil {
+				return "", err
+			}
+
+			if file == "ticker.js" {
+				return widgetScript(widget)
+			}
+
+			// the page reloads itself, but not so often that it hammers the server
+			refresh := config.Get().Cache.TTL
+			if refresh < 60 {
+				refresh = 60
+			}
+
+			pageVars := map[string]interface{}{"widget": widget, "refresh": refresh}
+			return getSite().widgetPageView.Render(pageVars), nil
+		})
+		if err != nil {
+			webError(err, res)
+			return
+		}
+
+		contentType := "text/html; charset=utf-8"
+		if file == "ticker.js" {
+			contentType = "application/javascript; charset=utf-8"
+		}
+
+		maxAge := config.Get().Cache.TTL
+		res.Header().Set("Content-Type", contentType)
+		res.Header().Set("Access-Control-Allow-Origin", "*")
+		res.Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d, stale-while-revalidate=%d", maxAge, maxAge*10))
+		res.Write([]byte(body))
+	}
+}
@@ -2,23 +2,154 @@ package config
 
 import (
 	"errors"
+	"fmt"
 	"github.com/pelletier/go-toml"
+	"github.com/robmerrell/vtcboard/resources"
+	"io/fs"
 	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
 	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 )
 
-var tomlconfg *toml.TomlTree
+var current = Defaults()
+var currentMutex sync.RWMutex
 var basePath = "resources/configs/"
 
+// the environment and path the current config was loaded with, used when reloading
+var loadedEnv, loadedPath string
+
+// envPrefix starts the name of every environment variable that overrides a setting.
+var envPrefix = "VTCBOARD_"
+
+// envSelector picks which config file is loaded, so it doesn't also override the env
+// setting. The env setting comes from the file that was picked.
+const envSelector = "VTCBOARD_ENV"
+
+// ValidationError lists every problem found while loading a config.
+type ValidationError struct {
+	Source   string
+	Problems []string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid config %s:\n  %s", e.Source, strings.Join(e.Problems, "\n  "))
+}
+
 // LoadConfig takes an environment name and loads that environment's config file.
 func LoadConfig(env string) error {
-	configPath, err := findConfigPath(".")
+	return LoadFile(env, "")
+}
+
+// LoadFile loads the config file at pathname, or the environment's config file if pathname
+// is empty, and makes it the current config.
+func LoadFile(env, pathname string) error {
+	cfg, err := Load(env, pathname)
 	if err != nil {
 		return err
 	}
 
-	tomlconfg, err = toml.LoadFile(filepath.Join(configPath, basePath, env+".toml"))
-	return err
+	loadedEnv, loadedPath = env, pathname
+	Use(cfg)
+	return nil
+}
+
+// Reload reads the config again from wherever the current config was loaded from. The
+// new config isn't made current so that callers can check it before calling Use.
+func Reload() (*Config, error) {
+	return Load(loadedEnv, loadedPath)
+}
+
+// Use makes cfg the current config.
+func Use(cfg *Config) {
+	currentMutex.Lock()
+	defer currentMutex.Unlock()
+
+	current = cfg
+}
+
+// Get returns the current config. The returned config must not be modified, a reload
+// replaces it instead.
+func Get() *Config {
+	currentMutex.RLock()
+	defer currentMutex.RUnlock()
+
+	return current
+}
+
+// Changed returns the keys of the settings that differ between two configs, and of
+// those, the ones that are only picked up after a restart.
+func Changed(old, updated *Config) (changed []string, needRestart []string) {
+	oldValues := make(map[string]interface{})
+	old.settings(func(key string, field reflect.StructField, value reflect.Value) {
+		oldValues[key] = value.Interface()
+	})
+
+	updated.settings(func(key string, field reflect.StructField, value reflect.Value) {
+		if !reflect.DeepEqual(oldValues[key], value.Interface()) {
+			changed = append(changed, key)
+			if field.Tag.Get("reload") == "restart" {
+				needRestart = append(needRestart, key)
+			}
+		}
+	})
+
+	return changed, needRestart
+}
+
+// Load reads a config without making it current. Settings start out with their
+// defaults, are replaced by the ones in the config file and then by any VTCBOARD_*
+// environment variables. Every problem found along the way is returned together
+// in a ValidationError.
+func Load(env, pathname string) (*Config, error) {
+	source, contents, err := readConfigFile(env, pathname)
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := toml.Load(string(contents))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %s", source, err)
+	}
+
+	cfg := Defaults()
+	cfg.source = source
+	cfg.extra = make(map[string]interface{})
+
+	problems := cfg.applyTree(tree)
+	problems = append(problems, cfg.applyEnv()...)
+	problems = append(problems, cfg.validate()...)
+	if len(problems) > 0 {
+		return nil, &ValidationError{Source: source, Problems: problems}
+	}
+
+	return cfg, nil
+}
+
+// readConfigFile returns the name and contents of the config to load. A resources
+// directory on disk is used if one can be found, otherwise the config embedded in
+// the binary is read.
+func readConfigFile(env, pathname string) (string, []byte, error) {
+	if pathname != "" {
+		contents, err := ioutil.ReadFile(pathname)
+		return pathname, contents, err
+	}
+
+	configPath, err := findConfigPath(".")
+	if err != nil {
+		name := path.Join("configs", env+".toml")
+		contents, err := fs.ReadFile(resources.FS(""), name)
+		return "embedded " + name, contents, err
+	}
+
+	pathname = filepath.Join(configPath, basePath, env+".toml")
+	contents, err := ioutil.ReadFile(pathname)
+	return pathname, contents, err
 }
 
 // findConfigPath recursively travels up a filepath looking for a resources directory. An
@@ -44,12 +175,310 @@ func findConfigPath(pathname string) (string, error) {
 	return findConfigPath(filepath.Join(pathname, ".."))
 }
 
-// String returns a config key as a string
+// settings calls fn with the dotted key of every setting in the config and the field
+// that holds it.
+func (c *Config) settings(fn func(key string, field reflect.StructField, value reflect.Value)) {
+	root := reflect.ValueOf(c).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		field := root.Type().Field(i)
+		name := field.Tag.Get("toml")
+		if name == "" {
+			continue
+		}
+
+		if field.Type.Kind() != reflect.Struct {
+			fn(name, field, root.Field(i))
+			continue
+		}
+
+		section := root.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			fn(name+"."+section.Type().Field(j).Tag.Get("toml"), section.Type().Field(j), section.Field(j))
+		}
+	}
+}
+
+// applyTree copies the settings in a parsed config file onto the config. Sections the
+// config doesn't know about are kept so they can be looked up with String, Int and Bool.
+func (c *Config) applyTree(tree *toml.TomlTree) []string {
+	problems := []string{}
+	known := make(map[string]bool)
+
+	c.settings(func(key string, field reflect.StructField, value reflect.Value) {
+		known[key] = true
+		if tree.Has(key) {
+			if err := setValue(value, tree.Get(key)); err != nil {
+				problems = append(problems, key+": "+err.Error())
+			}
+		}
+	})
+
+	// look for misspelled settings
+	for _, name := range tree.Keys() {
+		section, isSection := tree.Get(name).(*toml.TomlTree)
+		if !isSection {
+			if !known[name] {
+				problems = append(problems, name+": unknown setting")
+			}
+			continue
+		}
+
+		sectionKnown := false
+		for key := range known {
+			sectionKnown = sectionKnown || strings.HasPrefix(key, name+".")
+		}
+
+		for _, key := range section.Keys() {
+			switch {
+			case !sectionKnown:
+				c.extra[name+"."+key] = section.Get(key)
+			case !known[name+"."+key]:
+				problems = append(problems, name+"."+key+": unknown setting")
+			}
+		}
+	}
+
+	return problems
+}
+
+// applyEnv overrides settings with any matching environment variables, eg: server.listen
+// is replaced by VTCBOARD_SERVER_LISTEN.
+func (c *Config) applyEnv() []string {
+	problems := []string{}
+
+	c.settings(func(key string, field reflect.StructField, value reflect.Value) {
+		name := EnvName(key)
+		if name == envSelector {
+			return
+		}
+
+		if raw, ok := os.LookupEnv(name); ok {
+			if err := setValueFromString(value, raw); err != nil {
+				problems = append(problems, name+": "+err.Error())
+			}
+		}
+	})
+
+	return problems
+}
+
+// EnvName returns the environment variable that overrides a setting. The env setting's
+// would be VTCBOARD_ENV, which picks the config file instead.
+func EnvName(key string) string {
+	return envPrefix + strings.ToUpper(strings.Replace(key, ".", "_", -1))
+}
+
+// setValue sets a config field from a value parsed out of a config file.
+func setValue(value reflect.Value, raw interface{}) error {
+	switch value.Kind() {
+	case reflect.String:
+		if s, ok := raw.(string); ok {
+			value.SetString(s)
+			return nil
+		}
+	case reflect.Int:
+		if i, ok := raw.(int64); ok {
+			value.SetInt(i)
+			return nil
+		}
+	case reflect.Bool:
+		if b, ok := raw.(bool); ok {
+			value.SetBool(b)
+			return nil
+		}
+	case reflect.Slice:
+		if list, ok := raw.([]interface{}); ok {
+			strs := make([]string, len(list))
+			for i, item := range list {
+				s, ok := item.(string)
+				if !ok {
+					return fmt.Errorf("expected a list of strings, got %T in the list", item)
+				}
+				strs[i] = s
+			}
+			value.Set(reflect.ValueOf(strs))
+			return nil
+		}
+	}
+
+	return fmt.Errorf("expected %s, got %T", kindName(value), raw)
+}
+
+// setValueFromString sets a config field from an environment variable. Lists are comma
+// separated.
+func setValueFromString(value reflect.Value, raw string) error {
+	switch value.Kind() {
+	case reflect.String:
+		value.SetString(raw)
+	case reflect.Int:
+		i, err := strconv.Atoi(raw)
+		if err != nil {
+			return fmt.Errorf("expected %s, got %q", kindName(value), raw)
+		}
+		value.SetInt(int64(i))
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("expected %s, got %q", kindName(value), raw)
+		}
+		value.SetBool(b)
+	case reflect.Slice:
+		strs := []string{}
+		for _, s := range strings.Split(raw, ",") {
+			if s = strings.TrimSpace(s); s != "" {
+				strs = append(strs, s)
+			}
+		}
+		value.Set(reflect.ValueOf(strs))
+	}
+
+	return nil
+}
+
+// kindName describes the type of value a config field expects.
+func kindName(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.Int:
+		return "an integer"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice:
+		return "a list of strings"
+	default:
+		return "a string"
+	}
+}
+
+// Source returns where the config was loaded from.
+func (c *Config) Source() string {
+	return c.source
+}
+
+// Redacted returns the effective config in TOML format with secret settings hidden.
+func (c *Config) Redacted() string {
+	out := "# loaded from " + c.source + "\n"
+	lastSection := ""
+
+	c.settings(func(key string, field reflect.StructField, value reflect.Value) {
+		if i := strings.Index(key, "."); i != -1 {
+			if section := key[:i]; section != lastSection {
+				out += "\n[" + section + "]\n"
+				lastSection = section
+			}
+			key = key[i+1:]
+		}
+
+		if field.Tag.Get("secret") == "true" && value.Len() > 0 {
+			out += fmt.Sprintf("%s = %s\n", key, formatValue(redactValue(value)))
+		} else {
+			out += fmt.Sprintf("%s = %s\n", key, formatValue(value))
+		}
+	})
+
+	return out
+}
+
+// redactValue redacts a secret setting, each entry of it for a list.
+func redactValue(value reflect.Value) reflect.Value {
+	if value.Kind() != reflect.Slice {
+		return reflect.ValueOf(redact(value.String()))
+	}
+
+	redacted := make([]string, value.Len())
+	for i := range redacted {
+		redacted[i] = redact(value.Index(i).String())
+	}
+	return reflect.ValueOf(redacted)
+}
+
+// redact hides a secret. In URLs only the password and query values are hidden so that
+// the rest can be checked, and in settings that are a URL with other words, like pool
+// apis, the words are left as they are.
+func redact(secret string) string {
+	fields := strings.Fields(secret)
+	if len(fields) == 0 {
+		return "[redacted]"
+	}
+
+	for i, field := range fields {
+		u, err := url.Parse(field)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			if len(fields) == 1 {
+				return "[redacted]"
+			}
+			continue
+		}
+
+		if u.User != nil {
+			if _, hasPassword := u.User.Password(); hasPassword {
+				u.User = url.UserPassword(u.User.Username(), "redacted")
+			}
+		}
+		if u.RawQuery != "" {
+			query := u.Query()
+			for name := range query {
+				query.Set(name, "redacted")
+			}
+			u.RawQuery = query.Encode()
+		}
+		fields[i] = u.String()
+	}
+	return strings.Join(fields, " ")
+}
+
+// formatValue formats a config field as a TOML value.
+func formatValue(value reflect.Value) string {
+	switch value.Kind() {
+	case reflect.String:
+		return strconv.Quote(value.String())
+	case reflect.Slice:
+		quoted := make([]string, value.Len())
+		for i := range quoted {
+			quoted[i] = strconv.Quote(value.Index(i).String())
+		}
+		return "[" + strings.Join(quoted, ", ") + "]"
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
+
+// lookup returns the value of a setting by its dotted key.
+func lookup(key string) interface{} {
+	cfg := Get()
+
+	var found interface{}
+	cfg.settings(func(k string, field reflect.StructField, value reflect.Value) {
+		if k == key {
+			found = value.Interface()
+		}
+	})
+
+	if found == nil {
+		found = cfg.extra[key]
+	}
+	return found
+}
+
+// String returns a config key as a string, or "" if it isn't set
 func String(key string) string {
-	return tomlconfg.Get(key).(string)
+	s, _ := lookup(key).(string)
+	return s
 }
 
-// Int returns a config key an int64
+// Int returns a config key an int64, or 0 if it isn't set
 func Int(key string) int64 {
-	return tomlconfg.Get(key).(int64)
+	switch i := lookup(key).(type) {
+	case int:
+		return int64(i)
+	case int64:
+		return i
+	}
+
+	return 0
+}
+
+// Bool returns a config key as a bool, or false if it isn't set
+func Bool(key string) bool {
+	b, _ := lookup(key).(bool)
+	return b
 }
@@ -0,0 +1,444 @@
+package config
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/robmerrell/vtcboard/pools"
+	"github.com/robmerrell/vtcboard/retarget"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// Config holds every setting vtcboard knows about. Each field is named in the config
+// file by its toml tag under its section, eg: server.listen. Settings tagged with
+// reload:"restart" are only read when the server starts, everything else is picked
+// up when the config is reloaded.
+type Config struct {
+	Env        string           `toml:"env" reload:"restart"`
+	Database   DatabaseConfig   `toml:"database"`
+	Lock       LockConfig       `toml:"lock"`
+	Server     ServerConfig     `toml:"server"`
+	Cache      CacheConfig      `toml:"cache"`
+	Posts      PostsConfig      `toml:"posts"`
+	HTTP       HTTPConfig       `toml:"http"`
+	Live       LiveConfig       `toml:"live"`
+	Chart      ChartConfig      `toml:"chart"`
+	Chain      ChainConfig      `toml:"chain"`
+	Blocks     BlocksConfig     `toml:"blocks"`
+	Pools      PoolsConfig      `toml:"pools"`
+	Difficulty DifficultyConfig `toml:"difficulty"`
+	Nodes      NodesConfig      `toml:"nodes"`
+	Mempool    MempoolConfig    `toml:"mempool"`
+	Network    NetworkConfig    `toml:"network"`
+
+	// where the config was loaded from and any sections it has that aren't listed above
+	source string
+	extra  map[string]interface{}
+}
+
+type DatabaseConfig struct {
+	// a mongodb:// URI takes precedence over the individual settings below
+	URI string `toml:"uri" secret:"true" reload:"restart"`
+
+	// comma separated list of host:port
+	Host       string `toml:"host" reload:"restart"`
+	DB         string `toml:"db" reload:"restart"`
+	Username   string `toml:"username" reload:"restart"`
+	Password   string `toml:"password" secret:"true" reload:"restart"`
+	AuthSource string `toml:"auth_source" reload:"restart"`
+	ReplicaSet string `toml:"replica_set" reload:"restart"`
+	TLS        bool   `toml:"tls" reload:"restart"`
+	TLSCAFile  string `toml:"tls_ca_file" reload:"restart"`
+
+	// where the web server reads from: primary, secondaryPreferred or nearest
+	ReadPreference string `toml:"read_preference" reload:"restart"`
+
+	// timeouts in seconds
+	DialTimeout   int `toml:"dial_timeout" reload:"restart"`
+	SocketTimeout int `toml:"socket_timeout" reload:"restart"`
+}
+
+type LockConfig struct {
+	// seconds an updater holds its lease for
+	TTL int `toml:"ttl"`
+}
+
+type ServerConfig struct {
+	Listen     string `toml:"listen" reload:"restart"`
+	TLSCert    string `toml:"tls_cert" reload:"restart"`
+	TLSKey     string `toml:"tls_key" reload:"restart"`
+	SelfSigned bool   `toml:"self_signed" reload:"restart"`
+
+	// timeouts in seconds
+	ReadTimeout     int `toml:"read_timeout" reload:"restart"`
+	WriteTimeout    int `toml:"write_timeout" reload:"restart"`
+	IdleTimeout     int `toml:"idle_timeout" reload:"restart"`
+	ShutdownTimeout int `toml:"shutdown_timeout" reload:"restart"`
+	MaxHeaderBytes  int `toml:"max_header_bytes" reload:"restart"`
+
+	ResourcesDir string `toml:"resources_dir"`
+
+	// where the site is served from, links in widgets embedded elsewhere point here
+	SiteURL string `toml:"site_url"`
+
+	// minutes before a panel is flagged as stale
+	StaleAfter int `toml:"stale_after"`
+}
+
+type CacheConfig struct {
+	// seconds a response is cached for and between checks for new data
+	TTL  int `toml:"ttl"`
+	Poll int `toml:"poll"`
+
+	// most responses kept in each cache, the ones closest to expiring make way for new ones
+	MaxEntries int `toml:"max_entries"`
+}
+
+type PostsConfig struct {
+	// subreddits to pull posts from, in the order they're shown
+	Sources []string `toml:"sources"`
+}
+
+type HTTPConfig struct {
+	// seconds before a request to an external api is given up on
+	Timeout int `toml:"timeout"`
+}
+
+type LiveConfig struct {
+	// events a client can fall behind by before it is dropped
+	Buffer int `toml:"buffer"`
+
+	// seconds between heartbeats and before a stuck write drops the client
+	Heartbeat    int `toml:"heartbeat"`
+	WriteTimeout int `toml:"write_timeout"`
+
+	// messages per second a websocket client can send, with bursts of up to client_burst
+	ClientRate  int `toml:"client_rate"`
+	ClientBurst int `toml:"client_burst"`
+}
+
+type ChartConfig struct {
+	// most points returned for a chart, longer ranges are rolled up to fit
+	MaxPoints int `toml:"max_points"`
+}
+
+type ChainConfig struct {
+	// where blocks are read from: rpc for a node, or esplora or insight for an explorer
+	Backend string `toml:"backend" reload:"restart"`
+
+	// the node's JSON-RPC interface
+	RPCURL      string `toml:"rpc_url" reload:"restart"`
+	RPCUser     string `toml:"rpc_user" reload:"restart"`
+	RPCPassword string `toml:"rpc_password" secret:"true" reload:"restart"`
+
+	// the explorer's REST api, eg: https://explorer.example/api
+	ExplorerURL string `toml:"explorer_url" reload:"restart"`
+}
+
+type BlocksConfig struct {
+	// blocks below the tip ingested on the first run
+	Backfill int `toml:"backfill"`
+
+	// most blocks ingested in one run
+	PerRun int `toml:"per_run"`
+
+	// deepest reorg that is rewound before giving up
+	MaxReorgDepth int `toml:"max_reorg_depth"`
+
+	// blocks shown in the recent blocks table
+	Recent int `toml:"recent"`
+}
+
+type PoolsConfig struct {
+	// percent of the last day's blocks a single pool can find before the dashboard warns
+	Dominance int `toml:"dominance"`
+
+	// stats apis polled by update_pools, each a dialect followed by a url and optionally
+	// the pool's name. MPOS urls hold an api key.
+	APIs []string `toml:"apis" secret:"true"`
+
+	// stratum endpoints checked by probe_stratum, each a pool name followed by a url
+	Stratum []string `toml:"stratum"`
+
+	// the worker the probe authorizes as
+	ProbeWorker   string `toml:"probe_worker"`
+	ProbePassword string `toml:"probe_password" secret:"true"`
+
+	// seconds a probe has to get a job before the pool counts as down
+	ProbeTimeout int `toml:"probe_timeout"`
+}
+
+type DifficultyConfig struct {
+	// retarget algorithm used to estimate the next difficulty, kgw or dgw
+	Algorithm string `toml:"algorithm"`
+
+	// blocks the interval stats are worked out over
+	Window int `toml:"window"`
+
+	// a run of this many blocks is flagged when its average time is below Fast or above
+	// Slow percent of the target
+	Run  int `toml:"run"`
+	Fast int `toml:"fast"`
+	Slow int `toml:"slow"`
+}
+
+type NodesConfig struct {
+	// where crawl_nodes starts, each a host name or address with an optional port
+	Seeds []string `toml:"seeds"`
+
+	// the network's message start bytes in hex, and the port used for seeds without one
+	Magic string `toml:"magic"`
+	Port  int    `toml:"port"`
+
+	// nodes connected to at once, and the most visited in one crawl
+	Concurrency int `toml:"concurrency"`
+	MaxNodes    int `toml:"max_nodes"`
+
+	// seconds a node has to handshake and share its peers
+	Timeout int `toml:"timeout"`
+
+	// visit peers on loopback and private networks, only useful for a local test network
+	AllowPrivate bool `toml:"allow_private"`
+}
+
+type MempoolConfig struct {
+	// virtual bytes that fit in a block, used to estimate fees
+	BlockBytes int `toml:"block_bytes"`
+
+	// days of snapshots kept for the chart
+	History int `toml:"history"`
+}
+
+// NetworkConfig is where update_network gets the hashrate, difficulty and supply the
+// dashboard shows.
+type NetworkConfig struct {
+	// where update_network reads the network's stats, tried in order. Each is abe or rpc
+	// on its own, or insight or esplora followed by the api's url
+	Backends []string `toml:"backends"`
+
+	// blocks a backend can be behind the highest one before the next is used
+	MaxLag int `toml:"max_lag"`
+}
+
+// Defaults returns the config used for any setting that isn't in the config file or
+// the environment.
+func Defaults() *Config {
+	return &Config{
+		Env: "dev",
+		Database: DatabaseConfig{
+			Host:           "localhost",
+			DB:             "vtcboard",
+			ReadPreference: "primary",
+			DialTimeout:    10,
+			SocketTimeout:  60,
+		},
+		Lock: LockConfig{
+			TTL: 50,
+		},
+		Server: ServerConfig{
+			Listen:          ":4000",
+			ReadTimeout:     10,
+			WriteTimeout:    30,
+			IdleTimeout:     120,
+			ShutdownTimeout: 30,
+			MaxHeaderBytes:  1 << 16,
+			SiteURL:         "http://localhost:4000/",
+			StaleAfter:      30,
+		},
+		Cache: CacheConfig{
+			TTL:        60,
+			Poll:       5,
+			MaxEntries: 1000,
+		},
+		Posts: PostsConfig{
+			Sources: []string{"/r/vertcoin", "/r/vertmarket", "/r/vertcoinmining"},
+		},
+		HTTP: HTTPConfig{
+			Timeout: 30,
+		},
+		Live: LiveConfig{
+			Buffer:       16,
+			Heartbeat:    15,
+			WriteTimeout: 10,
+			ClientRate:   2,
+			ClientBurst:  10,
+		},
+		Chart: ChartConfig{
+			MaxPoints: 500,
+		},
+		Chain: ChainConfig{
+			Backend: "rpc",
+			RPCURL:  "http://localhost:5888",
+		},
+		Blocks: BlocksConfig{
+			Backfill:      4032,
+			PerRun:        500,
+			MaxReorgDepth: 100,
+			Recent:        10,
+		},
+		Pools: PoolsConfig{
+			Dominance:     40,
+			APIs:          []string{},
+			Stratum:       []string{},
+			ProbePassword: "x",
+			ProbeTimeout:  10,
+		},
+		Difficulty: DifficultyConfig{
+			Algorithm: "kgw",
+			Window:    120,
+			Run:       12,
+			Fast:      50,
+			Slow:      200,
+		},
+		Nodes: NodesConfig{
+			Seeds:       []string{},
+			Magic:       "fabfb5da",
+			Port:        5889,
+			Concurrency: 32,
+			MaxNodes:    2000,
+			Timeout:     10,
+		},
+		Mempool: MempoolConfig{
+			BlockBytes: 1000000,
+			History:    30,
+		},
+		Network: NetworkConfig{
+			Backends: []string{"abe"},
+			MaxLag:   5,
+		},
+	}
+}
+
+// readPreferences are the allowed values of database.read_preference.
+var readPreferences = map[string]bool{"primary": true, "secondaryPreferred": true, "nearest": true}
+
+// backends are the allowed values of chain.backend.
+var backends = map[string]bool{"rpc": true, "esplora": true, "insight": true}
+
+// NetworkDialects are the backends that can be listed in network.backends, and whether
+// they need a url. update_network creates them.
+var NetworkDialects = map[string]bool{"abe": false, "rpc": false, "insight": true, "esplora": true}
+
+// choices lists names for an error message, eg: "a, b or c".
+func choices(names []string) string {
+	sort.Strings(names)
+	if len(names) < 2 {
+		return strings.Join(names, "")
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " or " + names[len(names)-1]
+}
+
+// validate returns a description of everything wrong with the config.
+func (c *Config) validate() []string {
+	problems := []string{}
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, key+": "+fmt.Sprintf(format, args...))
+		}
+	}
+
+	check(c.Database.Host != "" || c.Database.URI != "", "database.host", "database.host or database.uri must be set")
+	check(c.Database.DB != "" || c.Database.URI != "", "database.db", "must be set")
+	check(c.Database.URI == "" || strings.HasPrefix(c.Database.URI, "mongodb://"), "database.uri", "must start with mongodb://")
+	check(c.Database.TLSCAFile == "" || c.Database.TLS, "database.tls_ca_file", "is only used when database.tls is true")
+	check(readPreferences[c.Database.ReadPreference], "database.read_preference", "must be primary, secondaryPreferred or nearest, got %q", c.Database.ReadPreference)
+	check(c.Database.DialTimeout >= 0, "database.dial_timeout", "must not be negative, got %d", c.Database.DialTimeout)
+	check(c.Database.SocketTimeout >= 0, "database.socket_timeout", "must not be negative, got %d", c.Database.SocketTimeout)
+
+	check(c.Lock.TTL > 0, "lock.ttl", "must be greater than 0, got %d", c.Lock.TTL)
+
+	check(c.Server.Listen != "", "server.listen", "must be set")
+	check((c.Server.TLSCert == "") == (c.Server.TLSKey == ""), "server.tls_cert", "server.tls_cert and server.tls_key must be set together")
+	check(c.Server.ReadTimeout >= 0, "server.read_timeout", "must not be negative, got %d", c.Server.ReadTimeout)
+	check(c.Server.WriteTimeout >= 0, "server.write_timeout", "must not be negative, got %d", c.Server.WriteTimeout)
+	check(c.Server.IdleTimeout >= 0, "server.idle_timeout", "must not be negative, got %d", c.Server.IdleTimeout)
+	check(c.Server.ShutdownTimeout >= 0, "server.shutdown_timeout", "must not be negative, got %d", c.Server.ShutdownTimeout)
+	check(c.Server.MaxHeaderBytes >= 0, "server.max_header_bytes", "must not be negative, got %d", c.Server.MaxHeaderBytes)
+	siteURL, err := url.Parse(c.Server.SiteURL)
+	check(err == nil && (siteURL.Scheme == "http" || siteURL.Scheme == "https") && siteURL.Host != "", "server.site_url", "must be an http url, got %q", c.Server.SiteURL)
+	check(c.Server.StaleAfter > 0, "server.stale_after", "must be greater than 0, got %d", c.Server.StaleAfter)
+
+	check(c.Cache.TTL >= 0, "cache.ttl", "must not be negative, got %d", c.Cache.TTL)
+	check(c.Cache.Poll > 0, "cache.poll", "must be greater than 0, got %d", c.Cache.Poll)
+	check(c.Cache.MaxEntries > 0, "cache.max_entries", "must be greater than 0, got %d", c.Cache.MaxEntries)
+
+	check(c.HTTP.Timeout >= 0, "http.timeout", "must not be negative, got %d", c.HTTP.Timeout)
+
+	check(c.Live.Buffer > 0, "live.buffer", "must be greater than 0, got %d", c.Live.Buffer)
+	check(c.Live.Heartbeat > 0, "live.heartbeat", "must be greater than 0, got %d", c.Live.Heartbeat)
+	check(c.Live.WriteTimeout > 0, "live.write_timeout", "must be greater than 0, got %d", c.Live.WriteTimeout)
+	check(c.Live.ClientRate > 0, "live.client_rate", "must be greater than 0, got %d", c.Live.ClientRate)
+	check(c.Live.ClientBurst >= c.Live.ClientRate, "live.client_burst", "must be at least live.client_rate, got %d", c.Live.ClientBurst)
+
+	check(c.Chart.MaxPoints >= 10, "chart.max_points", "must be at least 10, got %d", c.Chart.MaxPoints)
+
+	check(backends[c.Chain.Backend], "chain.backend", "must be rpc, esplora or insight, got %q", c.Chain.Backend)
+	check(c.Chain.RPCURL != "" || c.Chain.Backend != "rpc", "chain.rpc_url", "must be set when chain.backend is rpc")
+	check(c.Chain.ExplorerURL != "" || c.Chain.Backend == "rpc", "chain.explorer_url", "must be set when chain.backend is %s", c.Chain.Backend)
+
+	check(c.Blocks.Backfill >= 0, "blocks.backfill", "must not be negative, got %d", c.Blocks.Backfill)
+	check(c.Blocks.PerRun > 0, "blocks.per_run", "must be greater than 0, got %d", c.Blocks.PerRun)
+	check(c.Blocks.MaxReorgDepth > 0, "blocks.max_reorg_depth", "must be greater than 0, got %d", c.Blocks.MaxReorgDepth)
+	check(c.Blocks.Recent > 0, "blocks.recent", "must be greater than 0, got %d", c.Blocks.Recent)
+
+	check(c.Pools.Dominance > 0 && c.Pools.Dominance <= 100, "pools.dominance", "must be between 1 and 100, got %d", c.Pools.Dominance)
+	for _, api := range c.Pools.APIs {
+		_, err := pools.ParseAPI(api)
+		check(err == nil, "pools.apis", "%s", err)
+	}
+	for _, endpoint := range c.Pools.Stratum {
+		fields := strings.Fields(endpoint)
+		check(len(fields) >= 2 && strings.HasPrefix(fields[len(fields)-1], "stratum+tcp://"), "pools.stratum", "%q should be a pool name followed by a stratum+tcp:// url", endpoint)
+	}
+	check(len(c.Pools.Stratum) == 0 || c.Pools.ProbeWorker != "", "pools.probe_worker", "must be set to probe pools.stratum")
+	check(c.Pools.ProbeTimeout > 0, "pools.probe_timeout", "must be greater than 0, got %d", c.Pools.ProbeTimeout)
+
+	algorithms := []string{}
+	for name := range retarget.Algorithms {
+		algorithms = append(algorithms, name)
+	}
+	_, known := retarget.Algorithms[c.Difficulty.Algorithm]
+	check(known, "difficulty.algorithm", "must be %s, got %q", choices(algorithms), c.Difficulty.Algorithm)
+	check(c.Difficulty.Window > 0, "difficulty.window", "must be greater than 0, got %d", c.Difficulty.Window)
+	check(c.Difficulty.Run > 0, "difficulty.run", "must be greater than 0, got %d", c.Difficulty.Run)
+	check(c.Difficulty.Fast > 0 && c.Difficulty.Fast < 100, "difficulty.fast", "must be between 1 and 99, got %d", c.Difficulty.Fast)
+	check(c.Difficulty.Slow > 100, "difficulty.slow", "must be greater than 100, got %d", c.Difficulty.Slow)
+
+	magic, err := hex.DecodeString(c.Nodes.Magic)
+	check(err == nil && len(magic) == 4, "nodes.magic", "must be 8 hex characters, got %q", c.Nodes.Magic)
+	check(c.Nodes.Port > 0 && c.Nodes.Port < 65536, "nodes.port", "must be a port number, got %d", c.Nodes.Port)
+	check(c.Nodes.Concurrency > 0, "nodes.concurrency", "must be greater than 0, got %d", c.Nodes.Concurrency)
+	check(c.Nodes.MaxNodes > 0, "nodes.max_nodes", "must be greater than 0, got %d", c.Nodes.MaxNodes)
+	check(c.Nodes.Timeout > 0, "nodes.timeout", "must be greater than 0, got %d", c.Nodes.Timeout)
+
+	check(c.Mempool.BlockBytes > 0, "mempool.block_bytes", "must be greater than 0, got %d", c.Mempool.BlockBytes)
+	check(c.Mempool.History > 0, "mempool.history", "must be greater than 0, got %d", c.Mempool.History)
+
+	check(len(c.Network.Backends) > 0, "network.backends", "must list at least one backend")
+	plain, withURL := []string{}, []string{}
+	for name, needsURL := range NetworkDialects {
+		if needsURL {
+			withURL = append(withURL, name)
+		} else {
+			plain = append(plain, name)
+		}
+	}
+	for _, backend := range c.Network.Backends {
+		fields := strings.Fields(backend)
+		ok := false
+		if len(fields) > 0 {
+			needsURL, known := NetworkDialects[fields[0]]
+			ok = known && (len(fields) == 2) == needsURL && len(fields) <= 2
+		}
+		check(ok, "network.backends", "%q should be %s, or %s followed by a url", backend, choices(plain), choices(withURL))
+		check(len(fields) == 0 || fields[0] != "rpc" || c.Chain.RPCURL != "", "network.backends", "rpc needs chain.rpc_url to be set")
+	}
+	check(c.Network.MaxLag >= 0, "network.max_lag", "must be 0 or more, got %d", c.Network.MaxLag)
+
+	for _, source := range c.Posts.Sources {
+		check(strings.HasPrefix(source, "/r/"), "posts.sources", "%q should look like /r/name", source)
+	}
+
+	return problems
+}
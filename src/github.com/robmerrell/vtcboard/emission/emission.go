@@ -0,0 +1,146 @@
+package emission
+
+import (
+	"math"
+	"time"
+)
+
+// coin is the number of base units in a coin.
+const coin = 100000000
+
+// Schedule describes how a coin is created: every block pays a reward that halves every
+// HalvingInterval blocks until it rounds down to nothing.
+type Schedule struct {
+	// reward for the first blocks, in coins
+	InitialReward int64
+
+	// blocks between each halving of the reward
+	HalvingInterval int64
+
+	// the most coins there will ever be
+	MaxSupply int64
+
+	// the time the network aims to produce a block in
+	BlockTime time.Duration
+}
+
+// Vertcoin is the emission schedule of vertcoin.
+var Vertcoin = Schedule{
+	InitialReward:   50,
+	HalvingInterval: 840000,
+	MaxSupply:       84000000,
+	BlockTime:       time.Second * 150,
+}
+
+// rewardUnits returns the reward for the block at height in base units. The reward is
+// halved by shifting like the reference client so rounding matches it exactly.
+func (s Schedule) rewardUnits(height int64) int64 {
+	halvings := height / s.HalvingInterval
+	if halvings >= 64 {
+		return 0
+	}
+
+	return (s.InitialReward * coin) >> uint(halvings)
+}
+
+// Reward returns the reward in coins for mining the block at height.
+func (s Schedule) Reward(height int64) float64 {
+	return float64(s.rewardUnits(height)) / coin
+}
+
+// SupplyAt returns the number of coins that exist once the block at height has been
+// mined. The genesis block's reward can't be spent so it isn't counted.
+func (s Schedule) SupplyAt(height int64) float64 {
+	if height <= 0 {
+		return 0
+	}
+
+	var units int64
+	for era := int64(0); ; era++ {
+		first := era * s.HalvingInterval
+		if first > height {
+			break
+		}
+
+		reward := s.rewardUnits(first)
+		if reward == 0 {
+			break
+		}
+
+		last := first + s.HalvingInterval - 1
+		if last > height {
+			last = height
+		}
+		if first == 0 {
+			first = 1
+		}
+
+		units += (last - first + 1) * reward
+	}
+
+	return float64(units) / coin
+}
+
+// Remaining returns the number of coins left to mine after the block at height.
+func (s Schedule) Remaining(height int64) float64 {
+	return math.Max(float64(s.MaxSupply)-s.SupplyAt(height), 0)
+}
+
+// NextHalving returns the height of the first block after height that pays a smaller
+// reward, or 0 if the reward has already run out.
+func (s Schedule) NextHalving(height int64) int64 {
+	next := (height/s.HalvingInterval + 1) * s.HalvingInterval
+	if s.rewardUnits(next) == 0 && s.rewardUnits(height) == 0 {
+		return 0
+	}
+
+	return next
+}
+
+// Discrepancy returns how far a reported supply is from the supply the schedule expects
+// at height, as a fraction of the expected supply.
+func (s Schedule) Discrepancy(height int64, reported float64) float64 {
+	expected := s.SupplyAt(height)
+	if expected == 0 {
+		return 0
+	}
+
+	return (reported - expected) / expected
+}
+
+// Countdown is how long until the next halving.
+type Countdown struct {
+	Height    int64
+	Blocks    int64
+	Estimated time.Time
+}
+
+// HalvingCountdown works out when the next halving after height will happen if blocks
+// keep coming every blockTime. A blockTime of 0 uses the schedule's target.
+func (s Schedule) HalvingCountdown(height int64, blockTime time.Duration, now time.Time) (Countdown, bool) {
+	next := s.NextHalving(height)
+	if next == 0 {
+		return Countdown{}, false
+	}
+
+	if blockTime <= 0 {
+		blockTime = s.BlockTime
+	}
+
+	blocks := next - height
+	return Countdown{
+		Height:    next,
+		Blocks:    blocks,
+		Estimated: now.Add(time.Duration(blocks) * blockTime),
+	}, true
+}
+
+// AverageBlockTime returns the average time between blocks given two observations of
+// the block height. It returns 0 if no blocks were found between them.
+func AverageBlockTime(fromHeight int64, from time.Time, toHeight int64, to time.Time) time.Duration {
+	if toHeight <= fromHeight || !to.After(from) {
+		return 0
+	}
+
+	return to.Sub(from) / time.Duration(toHeight-fromHeight)
+}
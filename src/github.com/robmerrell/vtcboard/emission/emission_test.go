@@ -0,0 +1,79 @@
+package emission
+
+import (
+	. "launchpad.net/gocheck"
+	"math"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type emissionSuite struct{}
+
+var _ = Suite(&emissionSuite{})
+
+func (s *emissionSuite) TestReward(c *C) {
+	c.Check(Vertcoin.Reward(1), Equals, float64(50))
+	c.Check(Vertcoin.Reward(839999), Equals, float64(50))
+	c.Check(Vertcoin.Reward(840000), Equals, float64(25))
+	c.Check(Vertcoin.Reward(840000*2), Equals, 12.5)
+	c.Check(Vertcoin.Reward(840000*64), Equals, float64(0))
+}
+
+func (s *emissionSuite) TestSupplyAt(c *C) {
+	c.Check(Vertcoin.SupplyAt(0), Equals, float64(0))
+	c.Check(Vertcoin.SupplyAt(1), Equals, float64(50))
+	c.Check(Vertcoin.SupplyAt(100), Equals, float64(5000))
+
+	// the first era, less the genesis block, then into the second
+	c.Check(Vertcoin.SupplyAt(839999), Equals, float64(839999*50))
+	c.Check(Vertcoin.SupplyAt(840001), Equals, float64(839999*50+25*2))
+}
+
+func (s *emissionSuite) TestSupplyNeverPassesTheMax(c *C) {
+	final := Vertcoin.SupplyAt(840000 * 70)
+
+	// short of the max by the genesis reward and a little rounding
+	c.Check(final <= float64(Vertcoin.MaxSupply), Equals, true)
+	c.Check(float64(Vertcoin.MaxSupply)-final < 51, Equals, true)
+	c.Check(Vertcoin.Remaining(840000*70) < 51, Equals, true)
+}
+
+func (s *emissionSuite) TestNextHalving(c *C) {
+	c.Check(Vertcoin.NextHalving(1), Equals, int64(840000))
+	c.Check(Vertcoin.NextHalving(840000), Equals, int64(840000*2))
+	c.Check(Vertcoin.NextHalving(840000*70), Equals, int64(0))
+}
+
+func (s *emissionSuite) TestDiscrepancy(c *C) {
+	c.Check(Vertcoin.Discrepancy(100, 5000), Equals, float64(0))
+	c.Check(math.Abs(Vertcoin.Discrepancy(100, 5050)-0.01) < 1e-9, Equals, true)
+	c.Check(Vertcoin.Discrepancy(0, 10), Equals, float64(0))
+}
+
+func (s *emissionSuite) TestHalvingCountdown(c *C) {
+	now := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	countdown, ok := Vertcoin.HalvingCountdown(839000, time.Minute, now)
+	c.Assert(ok, Equals, true)
+	c.Check(countdown.Height, Equals, int64(840000))
+	c.Check(countdown.Blocks, Equals, int64(1000))
+	c.Check(countdown.Estimated, Equals, now.Add(time.Minute*1000))
+
+	// falls back to the target block time
+	countdown, _ = Vertcoin.HalvingCountdown(839000, 0, now)
+	c.Check(countdown.Estimated, Equals, now.Add(Vertcoin.BlockTime*1000))
+
+	_, ok = Vertcoin.HalvingCountdown(840000*70, time.Minute, now)
+	c.Check(ok, Equals, false)
+}
+
+func (s *emissionSuite) TestAverageBlockTime(c *C) {
+	start := time.Date(2014, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	c.Check(AverageBlockTime(100, start, 110, start.Add(time.Minute*20)), Equals, time.Minute*2)
+	c.Check(AverageBlockTime(100, start, 100, start.Add(time.Minute)), Equals, time.Duration(0))
+	c.Check(AverageBlockTime(100, start, 110, start), Equals, time.Duration(0))
+}
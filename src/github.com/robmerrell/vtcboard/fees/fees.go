@@ -0,0 +1,90 @@
+// Package fees sums up the transactions waiting to be mined, and works out what fee a new
+// one needs to get into a block soon.
+package fees
+
+import (
+	"math"
+	"sort"
+)
+
+// satoshisPerCoin is the number of base units in a coin.
+const satoshisPerCoin = 100000000
+
+// Tx is a transaction in the mempool.
+type Tx struct {
+	// bytes, or virtual bytes for segwit transactions
+	Size int
+
+	// paid to the miner, in coins
+	Fee float64
+}
+
+// Rate returns the fee a transaction pays per byte in satoshis.
+func (t Tx) Rate() float64 {
+	if t.Size <= 0 {
+		return 0
+	}
+
+	return t.Fee * satoshisPerCoin / float64(t.Size)
+}
+
+// Buckets are the lower bounds in satoshis per byte of the histogram's buckets.
+var Buckets = []float64{0, 1, 2, 5, 10, 20, 50, 100, 200, 500}
+
+// Bucket is the transactions paying between Min and Max satoshis per byte. Max is
+// infinite for the last bucket.
+type Bucket struct {
+	Min   float64
+	Max   float64
+	Count int
+	Bytes int64
+}
+
+// Histogram sorts transactions into buckets by fee rate, given the lower bound of each
+// bucket in increasing order.
+func Histogram(txs []Tx, bounds []float64) []Bucket {
+	buckets := make([]Bucket, len(bounds))
+	for i, min := range bounds {
+		buckets[i] = Bucket{Min: min, Max: math.Inf(1)}
+		if i+1 < len(bounds) {
+			buckets[i].Max = bounds[i+1]
+		}
+	}
+
+	for _, tx := range txs {
+		rate := tx.Rate()
+		i := sort.Search(len(buckets), func(i int) bool { return buckets[i].Max > rate })
+		if i == len(buckets) || rate < buckets[i].Min {
+			continue
+		}
+
+		buckets[i].Count++
+		buckets[i].Bytes += int64(tx.Size)
+	}
+
+	return buckets
+}
+
+// Targets are the numbers of blocks fees are estimated for.
+var Targets = []int{1, 3, 6}
+
+// Estimate returns the fee rate a transaction needs to be mined within blocks blocks if
+// nothing else arrives. Miners fill blocks of blockBytes with the best paying transactions
+// first, so it's the rate of the first transaction that wouldn't fit. If the whole mempool
+// fits the minimum rate the node relays is enough.
+func Estimate(txs []Tx, blockBytes, blocks int, minRate float64) float64 {
+	rates := make([]Tx, len(txs))
+	copy(rates, txs)
+	sort.Slice(rates, func(i, j int) bool { return rates[i].Rate() > rates[j].Rate() })
+
+	capacity := int64(blockBytes) * int64(blocks)
+	used := int64(0)
+	for _, tx := range rates {
+		used += int64(tx.Size)
+		if used > capacity {
+			return math.Max(tx.Rate(), minRate)
+		}
+	}
+
+	return minRate
+}
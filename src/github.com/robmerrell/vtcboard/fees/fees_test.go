@@ -0,0 +1,72 @@
+package fees
+
+import (
+	. "launchpad.net/gocheck"
+	"math"
+	"testing"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+// ---------
+// Histogram
+// ---------
+
+type histogramSuite struct{}
+
+var _ = Suite(&histogramSuite{})
+
+func (s *histogramSuite) TestRate(c *C) {
+	c.Check(Tx{Size: 250, Fee: 0.0001}.Rate(), Equals, float64(40))
+	c.Check(Tx{Size: 0, Fee: 0.0001}.Rate(), Equals, float64(0))
+}
+
+func (s *histogramSuite) TestHistogram(c *C) {
+	txs := []Tx{
+		{Size: 200, Fee: 0.000001},  // 0.5 sat/byte
+		{Size: 100, Fee: 0.000001},  // 1
+		{Size: 100, Fee: 0.0000015}, // 1.5
+		{Size: 250, Fee: 0.0001},    // 40
+	}
+
+	buckets := Histogram(txs, []float64{0, 1, 10})
+	c.Check(buckets, DeepEquals, []Bucket{
+		{Min: 0, Max: 1, Count: 1, Bytes: 200},
+		{Min: 1, Max: 10, Count: 2, Bytes: 200},
+		{Min: 10, Max: math.Inf(1), Count: 1, Bytes: 250},
+	})
+}
+
+func (s *histogramSuite) TestBelowLowestBucket(c *C) {
+	buckets := Histogram([]Tx{{Size: 100, Fee: 0.0000005}}, []float64{1, 10})
+	c.Check(buckets[0].Count+buckets[1].Count, Equals, 0)
+}
+
+// ----------
+// Estimation
+// ----------
+
+type estimateSuite struct{}
+
+var _ = Suite(&estimateSuite{})
+
+func (s *estimateSuite) TestEstimate(c *C) {
+	txs := []Tx{
+		{Size: 500, Fee: 0.00001},  // 2 sat/byte
+		{Size: 500, Fee: 0.0001},   // 20
+		{Size: 500, Fee: 0.00005},  // 10
+		{Size: 500, Fee: 0.000025}, // 5
+	}
+
+	// the next block fits the two best paying transactions
+	c.Check(Estimate(txs, 1000, 1, 1), Equals, float64(5))
+	c.Check(Estimate(txs, 1000, 1, 8), Equals, float64(8))
+
+	// two blocks clear the mempool
+	c.Check(Estimate(txs, 1000, 2, 1), Equals, float64(1))
+}
+
+func (s *estimateSuite) TestEmptyMempool(c *C) {
+	c.Check(Estimate(nil, 1000, 1, 1), Equals, float64(1))
+}
@@ -4,13 +4,41 @@ import (
 	"fmt"
 	"github.com/robmerrell/comandante"
 	"github.com/robmerrell/vtcboard/cmds"
-	"github.com/robmerrell/vtcboard/config"
 	"github.com/robmerrell/vtcboard/models"
 	"github.com/robmerrell/vtcboard/updaters"
 	"os"
+	"strings"
 )
 
+// configFlag removes a --config flag from the command line arguments and returns its
+// value. It is handled here instead of by each command because the config has to be
+// loaded before any command runs.
+func configFlag() string {
+	path := ""
+	args := []string{os.Args[0]}
+
+	for i := 1; i < len(os.Args); i++ {
+		arg := os.Args[i]
+		switch {
+		case arg == "--config" || arg == "-config":
+			if i+1 < len(os.Args) {
+				path = os.Args[i+1]
+				i++
+			}
+		case strings.HasPrefix(arg, "--config="), strings.HasPrefix(arg, "-config="):
+			path = arg[strings.Index(arg, "=")+1:]
+		default:
+			args = append(args, arg)
+		}
+	}
+
+	os.Args = args
+	return path
+}
+
 func main() {
+	configPath := configFlag()
+
 	// get the environment for the config
 	appEnv := ""
 	env := os.Getenv("VTCBOARD_ENV")
@@ -21,49 +49,78 @@ func main() {
 		appEnv = "dev"
 	}
 
-	config.LoadConfig(appEnv)
-
-	// make the package level database connection
-	if err := models.ConnectToDB(config.String("database.host"), config.String("database.db")); err != nil {
-		fmt.Fprintln(os.Stderr, "Could not connect to the database")
-		os.Exit(1)
-	}
-	defer models.CloseDB()
+	// the config and database are set up by each command that needs them
+	cmds.ConfigEnv, cmds.ConfigPath = appEnv, configPath
 
 	bin := comandante.New("vtcboard", "Vertcoin dashboard")
 	bin.IncludeHelp()
 
 	// add indexes to the database
-	addIndexes := comandante.NewCommand("index", "Add indexes to the database", cmds.IndexAction)
+	addIndexes := comandante.NewCommand("index", "Add indexes to the database", cmds.Requires(cmds.IndexAction, cmds.NeedsDB))
 	addIndexes.Documentation = cmds.IndexDoc
 	bin.RegisterCommand(addIndexes)
 
 	// update vertcoin prices
-	updateCoinPrices := comandante.NewCommand("update_coin_prices", "Get updated vertcoin prices", cmds.UpdateAction(&updaters.CoinPrice{}))
+	updateCoinPrices := comandante.NewCommand("update_coin_prices", "Get updated vertcoin prices", cmds.Requires(cmds.RunLocked("update_coin_prices", cmds.UpdateAction(&updaters.CoinPrice{})), cmds.NeedsDB, cmds.NeedsHTTPClient))
 	updateCoinPrices.Documentation = cmds.UpdateCoinPricesDoc
 	bin.RegisterCommand(updateCoinPrices)
 
 	// pricing rollup for the graph
-	rollupPricing := comandante.NewCommand("pricing_rollup", "Aggregate pricing information", cmds.PricingRollupAction)
+	rollupPricing := comandante.NewCommand("pricing_rollup", "Aggregate pricing information", cmds.Requires(cmds.RunLocked("pricing_rollup", cmds.Unstoppable(cmds.PricingRollupAction)), cmds.NeedsDB))
 	rollupPricing.Documentation = cmds.PricingRollupDoc
 	bin.RegisterCommand(rollupPricing)
 
 	// update network info
-	updateNetwork := comandante.NewCommand("update_network", "Get updated network information", cmds.UpdateAction(&updaters.Network{}))
-	updateNetwork.Documentation = cmds.UpdateCoinPricesDoc
+	updateNetwork := comandante.NewCommand("update_network", "Get updated network information", cmds.Requires(cmds.RunLocked("update_network", cmds.UpdateAction(&updaters.Network{})), cmds.NeedsDB, cmds.NeedsHTTPClient))
+	updateNetwork.Documentation = cmds.UpdateNetworkDoc
 	bin.RegisterCommand(updateNetwork)
 
+	// ingest new blocks
+	updateBlocks := comandante.NewCommand("update_blocks", "Ingest new blocks from the chain backend", cmds.Requires(cmds.RunLocked("update_blocks", cmds.UpdateAction(&updaters.Blocks{})), cmds.NeedsDB, cmds.NeedsHTTPClient))
+	updateBlocks.Documentation = cmds.UpdateBlocksDoc
+	bin.RegisterCommand(updateBlocks)
+
+	// poll pool apis
+	updatePools := comandante.NewCommand("update_pools", "Get stats from the pool apis in the config", cmds.Requires(cmds.RunLocked("update_pools", cmds.UpdateAction(&updaters.Pools{})), cmds.NeedsDB, cmds.NeedsHTTPClient))
+	updatePools.Documentation = cmds.UpdatePoolsDoc
+	bin.RegisterCommand(updatePools)
+
+	// probe pool stratum endpoints
+	probeStratum := comandante.NewCommand("probe_stratum", "Check that pools accept miners", cmds.Requires(cmds.RunLocked("probe_stratum", cmds.UpdateAction(&updaters.Stratum{})), cmds.NeedsDB))
+	probeStratum.Documentation = cmds.ProbeStratumDoc
+	bin.RegisterCommand(probeStratum)
+
+	// crawl the p2p network
+	crawlNodes := comandante.NewCommand("crawl_nodes", "Count reachable nodes and their versions", cmds.Requires(cmds.RunLocked("crawl_nodes", cmds.UpdateAction(&updaters.Nodes{})), cmds.NeedsDB))
+	crawlNodes.Documentation = cmds.CrawlNodesDoc
+	bin.RegisterCommand(crawlNodes)
+
+	// snapshot the mempool
+	updateMempool := comandante.NewCommand("update_mempool", "Get mempool size and fee estimates", cmds.Requires(cmds.RunLocked("update_mempool", cmds.UpdateAction(&updaters.Mempool{})), cmds.NeedsDB, cmds.NeedsHTTPClient))
+	updateMempool.Documentation = cmds.UpdateMempoolDoc
+	bin.RegisterCommand(updateMempool)
+
 	// update reddit stories
-	updateReddit := comandante.NewCommand("update_reddit", "Get new /r/vertcoin posts", cmds.UpdateAction(&updaters.Reddit{}))
+	updateReddit := comandante.NewCommand("update_reddit", "Get new /r/vertcoin posts", cmds.Requires(cmds.RunLocked("update_reddit", cmds.UpdateAction(&updaters.Reddit{})), cmds.NeedsDB, cmds.NeedsHTTPClient))
 	updateReddit.Documentation = cmds.UpdateRedditDoc
 	bin.RegisterCommand(updateReddit)
 
+	// check the config
+	checkConfig := comandante.NewCommand("config", "Validate and print the config", cmds.Requires(cmds.ConfigAction, cmds.NeedsConfig))
+	checkConfig.Documentation = cmds.ConfigDoc
+	checkConfig.FlagPostParse = cmds.ConfigFlagPostParse
+	bin.RegisterCommand(checkConfig)
+
 	// run web service
-	webService := comandante.NewCommand("serve", "Start the VTCBoard web server", cmds.ServeAction)
+	webService := comandante.NewCommand("serve", "Start the VTCBoard web server", cmds.Requires(cmds.ServeAction, cmds.WaitsForDB))
 	webService.Documentation = cmds.ServerDoc
 	bin.RegisterCommand(webService)
 
-	if err := bin.Run(); err != nil {
+	err := bin.Run()
+	models.CloseDB()
+
+	if err != nil {
 		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
 }
@@ -28,10 +28,50 @@ func GetAverages(conn *MgoConnection, hours int) ([]*Average, error) {
 	return results, err
 }
 
-// GenerateAverage generates the average data for prices between to times
+// averageBlock is how often averages are generated.
+const averageBlock = time.Minute * 10
+
+// GetAveragesSince returns the averages from a time onwards rolled up into blocks of the
+// given resolution. Resolutions of 10 minutes or less return the averages as they are.
+func GetAveragesSince(conn *MgoConnection, since time.Time, resolution time.Duration) ([]*Average, error) {
+	var results []*Average
+	match := bson.M{"timeBlock": bson.M{"$gte": since}}
+
+	if resolution <= averageBlock {
+		err := conn.DB.C(averageCollection).Find(match).Sort("timeBlock").All(&results)
+		return results, err
+	}
+
+	// round each time block down to the resolution and average everything in it
+	epoch := time.Unix(0, 0).UTC()
+	block := bson.M{"$subtract": []interface{}{
+		"$timeBlock",
+		bson.M{"$mod": []interface{}{bson.M{"$subtract": []interface{}{"$timeBlock", epoch}}, int64(resolution / time.Millisecond)}},
+	}}
+
+	pipeline := []bson.M{
+		{"$match": match},
+		{"$group": bson.M{"_id": block, "btc": bson.M{"$avg": "$cryptsy.btc"}, "usd": bson.M{"$avg": "$cryptsy.usd"}}},
+		{"$sort": bson.M{"_id": 1}},
+		{"$project": bson.M{"_id": 0, "timeBlock": "$_id", "cryptsy": bson.M{"btc": "$btc", "usd": "$usd"}}},
+	}
+
+	err := conn.DB.C(averageCollection).Pipe(pipeline).All(&results)
+	return results, err
+}
+
+// GetFirstAverage returns the oldest average.
+func GetFirstAverage(conn *MgoConnection) (*Average, error) {
+	var average *Average
+	err := conn.DB.C(averageCollection).Find(bson.M{}).Sort("timeBlock").One(&average)
+	return average, err
+}
+
+// GenerateAverage generates the average data for prices between to times. Nothing is
+// written and the average is nil if there weren't any prices.
 func GenerateAverage(conn *MgoConnection, startTime, endTime time.Time) (*Average, error) {
 	prices, err := GetPricesBetweenDates(conn, startTime, endTime)
-	if err != nil {
+	if err != nil || len(prices) == 0 {
 		return nil, err
 	}
 
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+type Block struct {
+	Height          int64     "_id"
+	Hash            string    "hash"
+	PrevHash        string    "prevHash"
+	Time            time.Time "time"
+	Difficulty      float64   "difficulty"
+	TxCount         int       "txCount"
+	Size            int       "size"
+	CoinbaseValue   float64   "coinbaseValue"
+	MinerTag        string    "minerTag"
+	PayoutAddresses []string  "payoutAddresses"
+	IngestedAt      time.Time "ingestedAt"
+}
+
+var blockCollection = "blocks"
+
+// Save stores a block, replacing any block already stored at its height.
+func (b *Block) Save(conn *MgoConnection) error {
+	_, err := conn.DB.C(blockCollection).UpsertId(b.Height, b)
+	return err
+}
+
+// GetBlock gets the block at a height.
+func GetBlock(conn *MgoConnection, height int64) (*Block, error) {
+	var block *Block
+	err := conn.DB.C(blockCollection).FindId(height).One(&block)
+	return block, err
+}
+
+// GetBlockByHash gets the block with a hash.
+func GetBlockByHash(conn *MgoConnection, hash string) (*Block, error) {
+	var block *Block
+	err := conn.DB.C(blockCollection).Find(bson.M{"hash": hash}).One(&block)
+	return block, err
+}
+
+// GetLatestBlock gets the highest block.
+func GetLatestBlock(conn *MgoConnection) (*Block, error) {
+	var block *Block
+	err := conn.DB.C(blockCollection).Find(bson.M{}).Sort("-_id").One(&block)
+	return block, err
+}
+
+// GetRecentBlocks gets the highest blocks, newest first.
+func GetRecentBlocks(conn *MgoConnection, limit int) ([]*Block, error) {
+	var blocks []*Block
+	err := conn.DB.C(blockCollection).Find(bson.M{}).Sort("-_id").Limit(limit).All(&blocks)
+	return blocks, err
+}
+
+// GetBlocksAbove gets every block higher than a height, oldest first.
+func GetBlocksAbove(conn *MgoConnection, height int64) ([]*Block, error) {
+	var blocks []*Block
+	err := conn.DB.C(blockCollection).Find(bson.M{"_id": bson.M{"$gt": height}}).Sort("_id").All(&blocks)
+	return blocks, err
+}
+
+// GetMinersSince gets the height, miner tag and payout addresses of every block found since
+// a time, which is all that's needed to tell which pool found them.
+func GetMinersSince(conn *MgoConnection, since time.Time) ([]*Block, error) {
+	var blocks []*Block
+	fields := bson.M{"minerTag": 1, "payoutAddresses": 1}
+	err := conn.DB.C(blockCollection).Find(bson.M{"time": bson.M{"$gte": since}}).Select(fields).Sort("_id").All(&blocks)
+	return blocks, err
+}
+
+// GetRecentBlockTimes gets the height, time and difficulty of the highest blocks, newest
+// first, which is all the difficulty retarget needs.
+func GetRecentBlockTimes(conn *MgoConnection, limit int) ([]*Block, error) {
+	var blocks []*Block
+	fields := bson.M{"time": 1, "difficulty": 1}
+	err := conn.DB.C(blockCollection).Find(bson.M{}).Select(fields).Sort("-_id").Limit(limit).All(&blocks)
+	return blocks, err
+}
+
+// GetBlocksIngestedAfter gets every block stored after a time, lowest first. Blocks that
+// replaced orphaned ones are included since they're stored again.
+func GetBlocksIngestedAfter(conn *MgoConnection, after time.Time) ([]*Block, error) {
+	var blocks []*Block
+	err := conn.DB.C(blockCollection).Find(bson.M{"ingestedAt": bson.M{"$gt": after}}).Sort("_id").All(&blocks)
+	return blocks, err
+}
+
+// RemoveBlocksFrom removes the block at a height and every block above it, for when
+// they've been orphaned by a reorg.
+func RemoveBlocksFrom(conn *MgoConnection, height int64) error {
+	_, err := conn.DB.C(blockCollection).RemoveAll(bson.M{"_id": bson.M{"$gte": height}})
+	return err
+}
@@ -0,0 +1,45 @@
+package models
+
+import (
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// DataVersion is a counter that is bumped every time an updater writes new data. Long
+// running processes watch it to know when anything they cached is out of date.
+type DataVersion struct {
+	Name      string    "_id"
+	Version   int64     "version"
+	UpdatedAt time.Time "updatedAt"
+}
+
+var versionCollection = "versions"
+
+// dataVersionName is the name of the version shared by all updaters.
+var dataVersionName = "data"
+
+// BumpDataVersion marks that new data has been written.
+func BumpDataVersion(conn *MgoConnection) error {
+	update := bson.M{
+		"$inc": bson.M{"version": 1},
+		"$set": bson.M{"updatedAt": time.Now().UTC()},
+	}
+
+	_, err := conn.DB.C(versionCollection).UpsertId(dataVersionName, update)
+	return err
+}
+
+// GetDataVersion returns the current data version, which is 0 if nothing has been
+// written yet.
+func GetDataVersion(conn *MgoConnection) (int64, error) {
+	var version DataVersion
+	if err := conn.DB.C(versionCollection).FindId(dataVersionName).One(&version); err != nil {
+		if err == mgo.ErrNotFound {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	return version.Version, nil
+}
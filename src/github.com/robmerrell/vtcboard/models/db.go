@@ -1,8 +1,17 @@
 package models
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"github.com/robmerrell/vtcboard/config"
+	"io"
+	"io/ioutil"
 	"labix.org/v2/mgo"
+	"net"
+	"net/url"
+	"strings"
+	"time"
 )
 
 // MgoConnection holds a database connection and should be
@@ -23,25 +32,178 @@ func (m *MgoConnection) Close() {
 // pool) and all clone need to call Close() when finished.
 var mainConnection = &MgoConnection{}
 
-// ConnectToDB connects the main connection to the database at a given server
-// and also creates a reference to the given database.
-func ConnectToDB(server, database string) error {
-	// connect to the db server
-	var err error
-	mainConnection.Session, err = mgo.Dial(server)
+// ConnectToDB connects the main connection to the database described by the [database]
+// section of the config and also creates a reference to the database.
+func ConnectToDB(settings config.DatabaseConfig) error {
+	settings, err := resolveDatabaseSettings(settings)
 	if err != nil {
 		return err
 	}
 
+	info, err := dialInfo(settings)
+	if err != nil {
+		return err
+	}
+
+	// connect to the db server
+	session, err := mgo.DialWithInfo(info)
+	if err != nil {
+		if unreachable(err) {
+			return &UnreachableError{Host: settings.Host, Err: err}
+		}
+		return fmt.Errorf("could not connect to the database at %s: %s", settings.Host, err)
+	}
+
+	if settings.ReplicaSet != "" {
+		if err := checkReplicaSet(session, settings.ReplicaSet); err != nil {
+			session.Close()
+			return err
+		}
+	}
+
+	session.SetSyncTimeout(info.Timeout)
+	session.SetSocketTimeout(time.Duration(settings.SocketTimeout) * time.Second)
+
 	// use a database
-	mainConnection.DBName = database
-	mainConnection.DB = mainConnection.Session.DB(database)
+	mainConnection.Session = session
+	mainConnection.DBName = settings.DB
+	mainConnection.DB = mainConnection.Session.DB(settings.DB)
 	return nil
 }
 
-// CloseDB closes the main database connection.
+// UnreachableError is returned by ConnectToDB when no database server answered. Unlike a
+// bad setting or a failed login it can clear up by itself.
+type UnreachableError struct {
+	Host string
+	Err  error
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("could not connect to the database at %s: %s", e.Host, e.Err)
+}
+
+// unreachable reports whether a dial failed because the servers couldn't be reached. mgo
+// doesn't export the error it gives when none of them answered.
+func unreachable(err error) bool {
+	if _, ok := err.(net.Error); ok {
+		return true
+	}
+	return err == io.EOF || err.Error() == "no reachable servers"
+}
+
+// resolveDatabaseSettings fills in the database settings from database.uri, which take
+// precedence over the individual settings.
+func resolveDatabaseSettings(settings config.DatabaseConfig) (config.DatabaseConfig, error) {
+	if settings.URI == "" {
+		return settings, nil
+	}
+
+	uri, err := url.Parse(settings.URI)
+	if err != nil {
+		return settings, fmt.Errorf("database.uri: %s", err)
+	}
+
+	settings.Host = uri.Host
+	if db := strings.TrimPrefix(uri.Path, "/"); db != "" {
+		settings.DB = db
+	}
+	if uri.User != nil {
+		settings.Username = uri.User.Username()
+		settings.Password, _ = uri.User.Password()
+	}
+
+	for key, values := range uri.Query() {
+		value := values[0]
+		switch key {
+		case "authSource":
+			settings.AuthSource = value
+		case "replicaSet":
+			settings.ReplicaSet = value
+		case "ssl", "tls":
+			settings.TLS = value == "true"
+		case "readPreference":
+			settings.ReadPreference = value
+		default:
+			return settings, fmt.Errorf("database.uri: unsupported option %s", key)
+		}
+	}
+
+	return settings, nil
+}
+
+// dialInfo builds the driver's connection options from the database settings.
+func dialInfo(settings config.DatabaseConfig) (*mgo.DialInfo, error) {
+	info := &mgo.DialInfo{
+		Addrs:    strings.Split(settings.Host, ","),
+		Timeout:  time.Duration(settings.DialTimeout) * time.Second,
+		Username: settings.Username,
+		Password: settings.Password,
+	}
+
+	// the driver authenticates against the database it is given
+	if settings.Username != "" {
+		info.Database = settings.DB
+		if settings.AuthSource != "" {
+			info.Database = settings.AuthSource
+		}
+	}
+
+	if settings.TLS {
+		tlsConfig := &tls.Config{}
+		if settings.TLSCAFile != "" {
+			pem, err := ioutil.ReadFile(settings.TLSCAFile)
+			if err != nil {
+				return nil, err
+			}
+
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in %s", settings.TLSCAFile)
+			}
+		}
+
+		info.DialServer = func(addr *mgo.ServerAddr) (net.Conn, error) {
+			return tls.Dial("tcp", addr.String(), tlsConfig)
+		}
+	}
+
+	return info, nil
+}
+
+// checkReplicaSet makes sure the servers we connected to belong to the expected replica set.
+func checkReplicaSet(session *mgo.Session, name string) error {
+	var result struct {
+		SetName string "setName"
+	}
+	if err := session.Run("ismaster", &result); err != nil {
+		return err
+	}
+
+	if result.SetName != name {
+		return fmt.Errorf("expected the database to be in replica set %q but it is in %q", name, result.SetName)
+	}
+	return nil
+}
+
+// SetReadPreference changes where connections cloned from the main connection read from.
+// primary always reads from the primary, secondaryPreferred reads from secondaries
+// until the first write and nearest reads from any member.
+func SetReadPreference(preference string) {
+	switch preference {
+	case "secondaryPreferred":
+		mainConnection.Session.SetMode(mgo.Monotonic, true)
+	case "nearest":
+		mainConnection.Session.SetMode(mgo.Eventual, true)
+	default:
+		mainConnection.Session.SetMode(mgo.Strong, true)
+	}
+}
+
+// CloseDB closes the main database connection if one was made.
 func CloseDB() {
-	mainConnection.Close()
+	if mainConnection.Session != nil {
+		mainConnection.Close()
+	}
 }
 
 // CloneConnection clones the main database connection and returns it. Remember
@@ -58,14 +220,14 @@ func CloneConnection() *MgoConnection {
 // DropCollection drops all collections in the database. For this function to
 // work the config environment must be set to "test".
 func DropCollections() {
-	if config.String("env") != "test" {
+	if config.Get().Env != "test" {
 		panic("DropCollections only works in the test environment")
 	}
 
 	conn := CloneConnection()
 	defer conn.Close()
 
-	collections := []string{priceCollection, networkCollection, postCollection, averageCollection}
+	collections := []string{priceCollection, networkCollection, postCollection, averageCollection, lockCollection, versionCollection, blockCollection, poolCollection, probeCollection, nodeCollection, mempoolCollection}
 	for _, collection := range collections {
 		conn.DB.C(collection).DropCollection()
 	}
@@ -7,6 +7,45 @@ func Index(conn *MgoConnection) error {
 		return err
 	}
 
+	averages := mainConnection.DB.C(averageCollection)
+	if err := averages.EnsureIndexKey("timeBlock"); err != nil {
+		return err
+	}
+
+	network := mainConnection.DB.C(networkCollection)
+	if err := network.EnsureIndexKey("generatedAt"); err != nil {
+		return err
+	}
+
+	blocks := mainConnection.DB.C(blockCollection)
+	if err := blocks.EnsureIndexKey("hash"); err != nil {
+		return err
+	}
+	if err := blocks.EnsureIndexKey("time"); err != nil {
+		return err
+	}
+	if err := blocks.EnsureIndexKey("ingestedAt"); err != nil {
+		return err
+	}
+
+	probes := mainConnection.DB.C(probeCollection)
+	if err := probes.EnsureIndexKey("endpoint", "-checkedAt"); err != nil {
+		return err
+	}
+	if err := probes.EnsureIndexKey("checkedAt"); err != nil {
+		return err
+	}
+
+	nodes := mainConnection.DB.C(nodeCollection)
+	if err := nodes.EnsureIndexKey("crawledAt"); err != nil {
+		return err
+	}
+
+	mempool := mainConnection.DB.C(mempoolCollection)
+	if err := mempool.EnsureIndexKey("takenAt"); err != nil {
+		return err
+	}
+
 	posts := mainConnection.DB.C(postCollection)
 	if err := posts.EnsureIndexKey("uniqueId"); err != nil {
 		return err
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"labix.org/v2/mgo"
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// Lock is a lease on a named resource held by a single owner until it expires.
+type Lock struct {
+	Name      string    "_id"
+	Owner     string    "owner"
+	ExpiresAt time.Time "expiresAt"
+}
+
+var lockCollection = "locks"
+
+// AcquireLock takes the lease on the named lock for owner, or extends it if owner
+// already holds it. False is returned when another owner holds an unexpired lease.
+func AcquireLock(conn *MgoConnection, name, owner string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	selector := bson.M{
+		"_id": name,
+		"$or": []bson.M{{"owner": owner}, {"expiresAt": bson.M{"$lt": now}}},
+	}
+	update := bson.M{"$set": bson.M{"owner": owner, "expiresAt": now.Add(ttl)}}
+
+	// if the lock is held by someone else the selector won't match and the upsert
+	// will collide with the existing _id.
+	if _, err := conn.DB.C(lockCollection).Upsert(selector, update); err != nil {
+		if mgo.IsDup(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// RenewLock pushes back the expiration of a lease that owner still holds. False is
+// returned if the lease was lost to another owner in the meantime.
+func RenewLock(conn *MgoConnection, name, owner string, ttl time.Duration) (bool, error) {
+	selector := bson.M{"_id": name, "owner": owner}
+	update := bson.M{"$set": bson.M{"expiresAt": time.Now().UTC().Add(ttl)}}
+
+	if err := conn.DB.C(lockCollection).Update(selector, update); err != nil {
+		if err == mgo.ErrNotFound {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+// ReleaseLock gives up the lease on the named lock if owner holds it.
+func ReleaseLock(conn *MgoConnection, name, owner string) error {
+	err := conn.DB.C(lockCollection).Remove(bson.M{"_id": name, "owner": owner})
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	return err
+}
+
+// GetLock returns the current state of the named lock.
+func GetLock(conn *MgoConnection, name string) (*Lock, error) {
+	var lock *Lock
+	err := conn.DB.C(lockCollection).FindId(name).One(&lock)
+	return lock, err
+}
@@ -0,0 +1,77 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// MempoolSnapshot is the node's mempool at a point in time. Fee rates are in satoshis
+// per byte.
+type MempoolSnapshot struct {
+	Id    bson.ObjectId "_id,omitempty"
+	Count int           "count"
+	Bytes int64         "bytes"
+
+	// the lowest rate the node accepts
+	MinFeeRate float64 "minFeeRate"
+
+	Buckets   []FeeBucket   "buckets"
+	Estimates []FeeEstimate "estimates"
+
+	TakenAt time.Time "takenAt"
+}
+
+// FeeBucket is the transactions paying at least Min and less than Max. Max is 0 for the
+// last bucket, which has no upper bound.
+type FeeBucket struct {
+	Min   float64 "min"
+	Max   float64 "max"
+	Count int     "count"
+	Bytes int64   "bytes"
+}
+
+// FeeEstimate is the rate needed to be mined within a number of blocks.
+type FeeEstimate struct {
+	Blocks  int     "blocks"
+	FeeRate float64 "feeRate"
+}
+
+var mempoolCollection = "mempool"
+
+// Insert saves a new snapshot of the mempool.
+func (m *MempoolSnapshot) Insert(conn *MgoConnection) error {
+	m.Id = bson.NewObjectId()
+	return conn.DB.C(mempoolCollection).Insert(m)
+}
+
+// Estimate returns the rate needed to be mined within blocks blocks, or 0 if it wasn't
+// estimated.
+func (m *MempoolSnapshot) Estimate(blocks int) float64 {
+	for _, estimate := range m.Estimates {
+		if estimate.Blocks == blocks {
+			return estimate.FeeRate
+		}
+	}
+
+	return 0
+}
+
+// GetLatestMempoolSnapshot gets the latest snapshot of the mempool.
+func GetLatestMempoolSnapshot(conn *MgoConnection) (*MempoolSnapshot, error) {
+	var snapshot *MempoolSnapshot
+	err := conn.DB.C(mempoolCollection).Find(bson.M{}).Sort("-takenAt").One(&snapshot)
+	return snapshot, err
+}
+
+// GetMempoolSnapshotsSince gets every snapshot taken at or after a time, oldest first.
+func GetMempoolSnapshotsSince(conn *MgoConnection, since time.Time) ([]*MempoolSnapshot, error) {
+	var snapshots []*MempoolSnapshot
+	err := conn.DB.C(mempoolCollection).Find(bson.M{"takenAt": bson.M{"$gte": since}}).Sort("takenAt").All(&snapshots)
+	return snapshots, err
+}
+
+// RemoveMempoolSnapshotsBefore deletes snapshots taken before a time.
+func RemoveMempoolSnapshotsBefore(conn *MgoConnection, before time.Time) error {
+	_, err := conn.DB.C(mempoolCollection).RemoveAll(bson.M{"takenAt": bson.M{"$lt": before}})
+	return err
+}
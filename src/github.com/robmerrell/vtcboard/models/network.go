@@ -26,3 +26,10 @@ func GetLatestNetworkSnapshot(conn *MgoConnection) (*Network, error) {
 	err := conn.DB.C(networkCollection).Find(bson.M{}).Sort("-_id").One(&network)
 	return network, err
 }
+
+// GetNetworkSnapshotsSince gets every network snapshot generated at or after a time, oldest first.
+func GetNetworkSnapshotsSince(conn *MgoConnection, since time.Time) ([]*Network, error) {
+	var snapshots []*Network
+	err := conn.DB.C(networkCollection).Find(bson.M{"generatedAt": bson.M{"$gte": since}}).Sort("generatedAt").All(&snapshots)
+	return snapshots, err
+}
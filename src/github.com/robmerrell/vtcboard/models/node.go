@@ -0,0 +1,52 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+// NodeSnapshot is what a crawl of the p2p network found.
+type NodeSnapshot struct {
+	Id          bson.ObjectId "_id,omitempty"
+	Reachable   int           "reachable"
+	Unreachable int           "unreachable"
+
+	// best block heights the reachable nodes reported
+	MedianHeight int64 "medianHeight"
+	MaxHeight    int64 "maxHeight"
+
+	// most common first
+	Versions []NodeVersion "versions"
+
+	CrawledAt time.Time "crawledAt"
+}
+
+// NodeVersion is how many reachable nodes run a version of the node software. User
+// agents have dots in them so they can't be used as keys.
+type NodeVersion struct {
+	UserAgent string "userAgent"
+	Protocol  int32  "protocol"
+	Count     int    "count"
+}
+
+var nodeCollection = "nodes"
+
+// Insert saves a new crawl of the network.
+func (n *NodeSnapshot) Insert(conn *MgoConnection) error {
+	n.Id = bson.NewObjectId()
+	return conn.DB.C(nodeCollection).Insert(n)
+}
+
+// GetLatestNodeSnapshot gets the latest crawl of the network.
+func GetLatestNodeSnapshot(conn *MgoConnection) (*NodeSnapshot, error) {
+	var snapshot *NodeSnapshot
+	err := conn.DB.C(nodeCollection).Find(bson.M{}).Sort("-crawledAt").One(&snapshot)
+	return snapshot, err
+}
+
+// GetNodeSnapshotsSince gets every crawl made at or after a time, oldest first.
+func GetNodeSnapshotsSince(conn *MgoConnection, since time.Time) ([]*NodeSnapshot, error) {
+	var snapshots []*NodeSnapshot
+	err := conn.DB.C(nodeCollection).Find(bson.M{"crawledAt": bson.M{"$gte": since}}).Sort("crawledAt").All(&snapshots)
+	return snapshots, err
+}
@@ -0,0 +1,40 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+type Pool struct {
+	Name          string    "_id"
+	Dialect       string    "dialect"
+	Link          string    "link"
+	Hashrate      float64   "hashrate"
+	Miners        int       "miners"
+	Workers       int       "workers"
+	LastBlock     int64     "lastBlock"
+	LastBlockTime time.Time "lastBlockTime"
+	UpdatedAt     time.Time "updatedAt"
+}
+
+var poolCollection = "pools"
+
+// Save stores a pool's stats, replacing the ones it had before.
+func (p *Pool) Save(conn *MgoConnection) error {
+	_, err := conn.DB.C(poolCollection).UpsertId(p.Name, p)
+	return err
+}
+
+// GetPools gets every pool, the highest hashrate first.
+func GetPools(conn *MgoConnection) ([]*Pool, error) {
+	var pools []*Pool
+	err := conn.DB.C(poolCollection).Find(bson.M{}).Sort("-hashrate").All(&pools)
+	return pools, err
+}
+
+// RemovePoolsExcept removes every pool that isn't named, for when pools are taken out of
+// the config.
+func RemovePoolsExcept(conn *MgoConnection, names []string) error {
+	_, err := conn.DB.C(poolCollection).RemoveAll(bson.M{"_id": bson.M{"$nin": names}})
+	return err
+}
@@ -0,0 +1,61 @@
+package models
+
+import (
+	"labix.org/v2/mgo/bson"
+	"time"
+)
+
+type Probe struct {
+	Id       bson.ObjectId "_id,omitempty"
+	Pool     string        "pool"
+	Endpoint string        "endpoint"
+	Up       bool          "up"
+
+	// milliseconds to answer the subscribe and to send the first job
+	Latency  float64 "latency"
+	FirstJob float64 "firstJob"
+
+	Error     string    "error"
+	CheckedAt time.Time "checkedAt"
+}
+
+var probeCollection = "probes"
+
+// Insert saves the result of probing a stratum endpoint.
+func (p *Probe) Insert(conn *MgoConnection) error {
+	p.Id = bson.NewObjectId()
+	return conn.DB.C(probeCollection).Insert(p)
+}
+
+// GetLatestProbes gets the newest probe of every endpoint.
+func GetLatestProbes(conn *MgoConnection) ([]*Probe, error) {
+	var endpoints []string
+	if err := conn.DB.C(probeCollection).Find(bson.M{}).Distinct("endpoint", &endpoints); err != nil {
+		return nil, err
+	}
+
+	probes := make([]*Probe, 0, len(endpoints))
+	for _, endpoint := range endpoints {
+		var probe *Probe
+		if err := conn.DB.C(probeCollection).Find(bson.M{"endpoint": endpoint}).Sort("-checkedAt").One(&probe); err != nil {
+			return nil, err
+		}
+		probes = append(probes, probe)
+	}
+
+	return probes, nil
+}
+
+// GetProbesSince gets the probes of an endpoint made since a time, oldest first.
+func GetProbesSince(conn *MgoConnection, endpoint string, since time.Time) ([]*Probe, error) {
+	var probes []*Probe
+	query := bson.M{"endpoint": endpoint, "checkedAt": bson.M{"$gte": since}}
+	err := conn.DB.C(probeCollection).Find(query).Sort("checkedAt").All(&probes)
+	return probes, err
+}
+
+// RemoveProbesBefore removes probes older than a time.
+func RemoveProbesBefore(conn *MgoConnection, before time.Time) error {
+	_, err := conn.DB.C(probeCollection).RemoveAll(bson.M{"checkedAt": bson.M{"$lt": before}})
+	return err
+}
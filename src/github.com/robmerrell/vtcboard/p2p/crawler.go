@@ -0,0 +1,321 @@
+// Package p2p speaks enough of the bitcoin wire protocol, which vertcoin shares, to
+// handshake with nodes and ask them for their peers. Crawling outward from a few seed
+// nodes finds the reachable part of the network.
+package p2p
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math/rand"
+	"net"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Network is a chain the crawler can connect to.
+type Network struct {
+	// starts every message on the network
+	Magic [4]byte
+
+	// used for seeds given without one
+	Port int
+}
+
+// Vertcoin is vertcoin's main network.
+var Vertcoin = Network{Magic: [4]byte{0xfa, 0xbf, 0xb5, 0xda}, Port: 5889}
+
+// ParseMagic reads network magic written as 8 hex characters, eg: fabfb5da.
+func ParseMagic(s string) ([4]byte, error) {
+	var magic [4]byte
+	raw, err := hex.DecodeString(s)
+	if err != nil || len(raw) != 4 {
+		return magic, fmt.Errorf("%q should be 4 bytes of hex", s)
+	}
+
+	copy(magic[:], raw)
+	return magic, nil
+}
+
+// ProtocolVersion is the protocol version the crawler claims to speak.
+const ProtocolVersion = 70015
+
+// Agent is the user agent the crawler connects with.
+var Agent = "/vtcboard-crawler:1.0/"
+
+// Node is a node that answered the handshake.
+type Node struct {
+	Address string
+	Version
+}
+
+// Visit connects to the node at address, handshakes and asks it for its peers. Peers
+// that arrive before timeout are returned, a node with none to share isn't an error.
+func Visit(address string, network Network, timeout time.Duration) (*Node, []string, error) {
+	start := time.Now()
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(timeout))
+
+	send := func(command string, payload []byte) error {
+		return writeMessage(conn, network.Magic, command, payload)
+	}
+
+	remote, _ := conn.RemoteAddr().(*net.TCPAddr)
+	ours := &Version{Protocol: ProtocolVersion, UserAgent: Agent}
+	if err := send("version", encodeVersion(ours, remote, rand.Uint64())); err != nil {
+		return nil, nil, err
+	}
+
+	var node *Node
+	gotVerack, askedForPeers := false, false
+	peers := []string{}
+	for {
+		msg, err := readMessage(conn, network.Magic)
+		if err != nil {
+			// a node that finished the handshake but didn't answer getaddr in time still counts
+			if netErr, ok := err.(net.Error); ok && netErr.Timeout() && node != nil && gotVerack {
+				return node, peers, nil
+			}
+			return nil, nil, err
+		}
+
+		switch msg.command {
+		case "version":
+			version, err := decodeVersion(msg.payload)
+			if err != nil {
+				return nil, nil, err
+			}
+			node = &Node{Address: address, Version: *version}
+			if err := send("verack", nil); err != nil {
+				return nil, nil, err
+			}
+		case "verack":
+			gotVerack = true
+		case "ping":
+			if err := send("pong", msg.payload); err != nil {
+				return nil, nil, err
+			}
+		case "addr":
+			addresses, err := decodeAddr(msg.payload)
+			if err != nil {
+				return nil, nil, err
+			}
+			peers = append(peers, addresses...)
+
+			// nodes announce their own address on their own, the answer to getaddr has more
+			if len(addresses) > 1 {
+				return node, peers, nil
+			}
+		}
+
+		if node != nil && gotVerack && !askedForPeers {
+			askedForPeers = true
+			if err := send("getaddr", nil); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+// Crawler walks the network from a set of seeds.
+type Crawler struct {
+	Network Network
+
+	// time each node has to handshake and share its peers
+	Timeout time.Duration
+
+	// nodes visited at once
+	Concurrency int
+
+	// most addresses visited in one crawl
+	MaxNodes int
+
+	// also visit peers on loopback and private networks, for crawling a local test network.
+	// Seeds are always visited.
+	AllowPrivate bool
+}
+
+// Crawl is what a crawl found.
+type Crawl struct {
+	// nodes that answered the handshake, by address
+	Nodes []*Node
+
+	// addresses that couldn't be reached or didn't handshake
+	Unreachable int
+}
+
+// Crawl visits the seeds, then every peer they share and so on until there are no new
+// addresses or MaxNodes have been visited. A seed can be a host name, which is looked up
+// like a DNS seed, and the network's port is used if it doesn't have one.
+func (c *Crawler) Crawl(seeds []string) *Crawl {
+	result := &Crawl{Nodes: []*Node{}}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	seen := make(map[string]bool)
+	slots := make(chan bool, c.Concurrency)
+
+	var queue func(address string)
+	visit := func(address string) {
+		defer wg.Done()
+
+		slots <- true
+		node, peers, err := Visit(address, c.Network, c.Timeout)
+		<-slots
+
+		mutex.Lock()
+		if err != nil {
+			result.Unreachable++
+		} else {
+			result.Nodes = append(result.Nodes, node)
+		}
+		mutex.Unlock()
+
+		for _, peer := range peers {
+			if c.AllowPrivate || routable(peer) {
+				queue(peer)
+			}
+		}
+	}
+	queue = func(address string) {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		if seen[address] || len(seen) >= c.MaxNodes {
+			return
+		}
+		seen[address] = true
+
+		wg.Add(1)
+		go visit(address)
+	}
+
+	for _, seed := range seeds {
+		addresses, err := c.resolve(seed)
+		if err != nil {
+			mutex.Lock()
+			result.Unreachable++
+			mutex.Unlock()
+			continue
+		}
+
+		for _, address := range addresses {
+			queue(address)
+		}
+	}
+	wg.Wait()
+
+	sort.Slice(result.Nodes, func(i, j int) bool { return result.Nodes[i].Address < result.Nodes[j].Address })
+	return result
+}
+
+// unroutable are the networks a node on the internet can't be reached on. Peers can share
+// any address, so these are skipped to keep the crawler off the network it runs in.
+var unroutable = parseNetworks(
+	"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "127.0.0.0/8", "169.254.0.0/16",
+	"172.16.0.0/12", "192.168.0.0/16", "224.0.0.0/3",
+	"::/128", "::1/128", "fc00::/7", "fe80::/10", "ff00::/8",
+)
+
+// parseNetworks parses CIDR blocks that are known to be valid.
+func parseNetworks(cidrs ...string) []*net.IPNet {
+	networks := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, network, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		networks[i] = network
+	}
+	return networks
+}
+
+// routable reports if a peer's host:port is a public address that can be visited.
+func routable(address string) bool {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil || port == "0" {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range unroutable {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// resolve turns a seed into the addresses of its nodes.
+func (c *Crawler) resolve(seed string) ([]string, error) {
+	host, port, err := net.SplitHostPort(seed)
+	if err != nil {
+		host, port = seed, strconv.Itoa(c.Network.Port)
+	}
+
+	ips, err := net.LookupHost(host)
+	if err != nil {
+		return nil, err
+	}
+
+	addresses := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addresses = append(addresses, net.JoinHostPort(ip, port))
+	}
+
+	return addresses, nil
+}
+
+// Adoption is how many reachable nodes run a version of the node software.
+type Adoption struct {
+	UserAgent string
+	Protocol  int32
+	Count     int
+}
+
+// Adoption counts the nodes running each user agent and protocol version, most common
+// first.
+func (c *Crawl) Adoption() []Adoption {
+	counts := make(map[Adoption]int)
+	for _, node := range c.Nodes {
+		counts[Adoption{UserAgent: node.UserAgent, Protocol: node.Protocol}]++
+	}
+
+	agents := make([]Adoption, 0, len(counts))
+	for agent, count := range counts {
+		agent.Count = count
+		agents = append(agents, agent)
+	}
+
+	sort.Slice(agents, func(i, j int) bool {
+		if agents[i].Count != agents[j].Count {
+			return agents[i].Count > agents[j].Count
+		}
+		return agents[i].UserAgent < agents[j].UserAgent
+	})
+
+	return agents
+}
+
+// Heights returns the median and highest best block height reported by the nodes.
+func (c *Crawl) Heights() (median, highest int32) {
+	if len(c.Nodes) == 0 {
+		return 0, 0
+	}
+
+	heights := make([]int32, 0, len(c.Nodes))
+	for _, node := range c.Nodes {
+		heights = append(heights, node.Height)
+	}
+	sort.Slice(heights, func(i, j int) bool { return heights[i] < heights[j] })
+
+	return heights[len(heights)/2], heights[len(heights)-1]
+}
@@ -0,0 +1,307 @@
+package p2p
+
+import (
+	"bytes"
+	"encoding/binary"
+	. "launchpad.net/gocheck"
+	"net"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+// fakePeer is a local node that handshakes like the reference client and shares a
+// fixed list of peers.
+type fakePeer struct {
+	listener net.Listener
+	network  Network
+
+	agent  string
+	height int32
+	peers  []string
+
+	// answer the handshake with another network's magic
+	wrongMagic bool
+
+	// ping the crawler before sharing peers
+	ping bool
+}
+
+func newFakePeer(c *C, agent string, height int32) *fakePeer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	return &fakePeer{listener: listener, network: Vertcoin, agent: agent, height: height}
+}
+
+// serve answers connections once the peer is set up.
+func (p *fakePeer) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *fakePeer) handle(conn net.Conn) {
+	defer conn.Close()
+
+	magic := p.network.Magic
+	if p.wrongMagic {
+		magic = [4]byte{0xf9, 0xbe, 0xb4, 0xd9}
+	}
+
+	for {
+		msg, err := readMessage(conn, p.network.Magic)
+		if err != nil {
+			return
+		}
+
+		switch msg.command {
+		case "version":
+			version := &Version{Protocol: 70015, Services: 1, UserAgent: p.agent, Height: p.height}
+			writeMessage(conn, magic, "version", encodeVersion(version, nil, 1))
+			writeMessage(conn, magic, "verack", nil)
+		case "getaddr":
+			if p.ping {
+				writeMessage(conn, magic, "ping", []byte("12345678"))
+				if pong, err := readMessage(conn, p.network.Magic); err != nil || pong.command != "pong" {
+					return
+				}
+			}
+
+			// the reference client announces itself before answering getaddr
+			if len(p.peers) > 0 {
+				self, _ := encodeAddr([]string{p.address()})
+				writeMessage(conn, magic, "addr", self)
+
+				addr, _ := encodeAddr(append(p.peers, p.address()))
+				writeMessage(conn, magic, "addr", addr)
+			}
+		}
+	}
+}
+
+func (p *fakePeer) address() string {
+	return p.listener.Addr().String()
+}
+
+func (p *fakePeer) close() {
+	p.listener.Close()
+}
+
+// encodeAddr builds an addr message listing addresses, which must be ip:port.
+func encodeAddr(addresses []string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writeVarInt(buf, uint64(len(addresses)))
+
+	for _, address := range addresses {
+		addr, err := net.ResolveTCPAddr("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+
+		binary.Write(buf, binary.LittleEndian, uint32(time.Now().Unix()))
+		writeNetAddr(buf, 1, addr)
+	}
+
+	return buf.Bytes(), nil
+}
+
+// -------------
+// Wire protocol
+// -------------
+
+type wireSuite struct{}
+
+var _ = Suite(&wireSuite{})
+
+func (s *wireSuite) TestMessageRoundTrip(c *C) {
+	buf := &bytes.Buffer{}
+	c.Assert(writeMessage(buf, Vertcoin.Magic, "ping", []byte("nonce123")), IsNil)
+
+	msg, err := readMessage(buf, Vertcoin.Magic)
+	c.Assert(err, IsNil)
+	c.Check(msg.command, Equals, "ping")
+	c.Check(string(msg.payload), Equals, "nonce123")
+}
+
+func (s *wireSuite) TestBadMessages(c *C) {
+	buf := &bytes.Buffer{}
+	writeMessage(buf, Vertcoin.Magic, "ping", []byte("nonce123"))
+	_, err := readMessage(buf, [4]byte{0xf9, 0xbe, 0xb4, 0xd9})
+	c.Check(err, ErrorMatches, "wrong network magic fabfb5da")
+
+	buf.Reset()
+	writeMessage(buf, Vertcoin.Magic, "ping", []byte("nonce123"))
+	corrupted := buf.Bytes()
+	corrupted[len(corrupted)-1] = 'x'
+	_, err = readMessage(bytes.NewReader(corrupted), Vertcoin.Magic)
+	c.Check(err, ErrorMatches, "bad checksum")
+}
+
+func (s *wireSuite) TestVersionRoundTrip(c *C) {
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 5889}
+	sent := &Version{Protocol: 70015, Services: 1, UserAgent: "/Vertcoin:0.13.0/", Height: 1200000}
+
+	received, err := decodeVersion(encodeVersion(sent, remote, 42))
+	c.Assert(err, IsNil)
+	c.Check(*received, Equals, *sent)
+
+	_, err = decodeVersion([]byte{1, 2})
+	c.Check(err, NotNil)
+}
+
+func (s *wireSuite) TestAddr(c *C) {
+	payload, err := encodeAddr([]string{"10.0.0.1:5889", "[2001:db8::1]:5889"})
+	c.Assert(err, IsNil)
+
+	addresses, err := decodeAddr(payload)
+	c.Assert(err, IsNil)
+	c.Check(addresses, DeepEquals, []string{"10.0.0.1:5889", "[2001:db8::1]:5889"})
+
+	// claims more addresses than it has
+	_, err = decodeAddr([]byte{0xfd, 0xff, 0xff})
+	c.Check(err, NotNil)
+}
+
+func (s *wireSuite) TestParseMagic(c *C) {
+	magic, err := ParseMagic("fabfb5da")
+	c.Assert(err, IsNil)
+	c.Check(magic, Equals, Vertcoin.Magic)
+
+	_, err = ParseMagic("fabf")
+	c.Check(err, NotNil)
+}
+
+// --------
+// Crawling
+// --------
+
+type crawlSuite struct{}
+
+var _ = Suite(&crawlSuite{})
+
+func (s *crawlSuite) TestVisit(c *C) {
+	peer := newFakePeer(c, "/Vertcoin:0.13.0/", 1200000)
+	defer peer.close()
+	peer.peers = []string{"10.0.0.1:5889"}
+	peer.ping = true
+	go peer.serve()
+
+	node, peers, err := Visit(peer.address(), Vertcoin, time.Second)
+	c.Assert(err, IsNil)
+	c.Check(node.Address, Equals, peer.address())
+	c.Check(node.UserAgent, Equals, "/Vertcoin:0.13.0/")
+	c.Check(node.Protocol, Equals, int32(70015))
+	c.Check(node.Height, Equals, int32(1200000))
+	c.Check(peers, DeepEquals, []string{peer.address(), "10.0.0.1:5889", peer.address()})
+}
+
+func (s *crawlSuite) TestVisitWithoutPeers(c *C) {
+	peer := newFakePeer(c, "/Vertcoin:0.13.0/", 1200000)
+	defer peer.close()
+	go peer.serve()
+
+	// the node handshakes but never answers getaddr
+	node, peers, err := Visit(peer.address(), Vertcoin, time.Millisecond*200)
+	c.Assert(err, IsNil)
+	c.Check(node.UserAgent, Equals, "/Vertcoin:0.13.0/")
+	c.Check(peers, HasLen, 0)
+}
+
+func (s *crawlSuite) TestVisitWrongNetwork(c *C) {
+	peer := newFakePeer(c, "/Satoshi:0.21.0/", 700000)
+	defer peer.close()
+	peer.wrongMagic = true
+	go peer.serve()
+
+	_, _, err := Visit(peer.address(), Vertcoin, time.Second)
+	c.Check(err, ErrorMatches, "wrong network magic .*")
+}
+
+func (s *crawlSuite) TestCrawl(c *C) {
+	old := newFakePeer(c, "/Vertcoin:0.12.0/", 1199990)
+	defer old.close()
+	current := newFakePeer(c, "/Vertcoin:0.13.0/", 1200000)
+	defer current.close()
+	other := newFakePeer(c, "/Vertcoin:0.13.0/", 1200001)
+	defer other.close()
+
+	// an address that won't answer
+	gone, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+	gone.Close()
+
+	// the seed knows about the current nodes, which know about each other
+	old.peers = []string{current.address(), gone.Addr().String()}
+	current.peers = []string{other.address()}
+	other.peers = []string{current.address(), old.address()}
+	for _, peer := range []*fakePeer{old, current, other} {
+		go peer.serve()
+	}
+
+	crawler := &Crawler{Network: Vertcoin, Timeout: time.Second, Concurrency: 2, MaxNodes: 100, AllowPrivate: true}
+	crawl := crawler.Crawl([]string{old.address()})
+
+	c.Assert(crawl.Nodes, HasLen, 3)
+	c.Check(crawl.Unreachable, Equals, 1)
+
+	c.Check(crawl.Adoption(), DeepEquals, []Adoption{
+		{UserAgent: "/Vertcoin:0.13.0/", Protocol: 70015, Count: 2},
+		{UserAgent: "/Vertcoin:0.12.0/", Protocol: 70015, Count: 1},
+	})
+
+	median, highest := crawl.Heights()
+	c.Check(median, Equals, int32(1200000))
+	c.Check(highest, Equals, int32(1200001))
+}
+
+func (s *crawlSuite) TestCrawlLimit(c *C) {
+	seed := newFakePeer(c, "/Vertcoin:0.13.0/", 1200000)
+	defer seed.close()
+	seed.peers = []string{"127.0.0.1:1", "127.0.0.1:2", "127.0.0.1:3"}
+	go seed.serve()
+
+	crawler := &Crawler{Network: Vertcoin, Timeout: time.Second, Concurrency: 4, MaxNodes: 2, AllowPrivate: true}
+	crawl := crawler.Crawl([]string{seed.address()})
+
+	c.Check(len(crawl.Nodes)+crawl.Unreachable, Equals, 2)
+}
+
+func (s *crawlSuite) TestCrawlSkipsPrivatePeers(c *C) {
+	seed := newFakePeer(c, "/Vertcoin:0.13.0/", 1200000)
+	defer seed.close()
+	other := newFakePeer(c, "/Vertcoin:0.13.0/", 1200000)
+	defer other.close()
+	seed.peers = []string{other.address(), "10.0.0.1:5889", "192.168.1.2:5889"}
+	go seed.serve()
+	go other.serve()
+
+	// the seed is on loopback but is visited since it was asked for, its peers aren't
+	crawler := &Crawler{Network: Vertcoin, Timeout: time.Second, Concurrency: 4, MaxNodes: 100}
+	crawl := crawler.Crawl([]string{seed.address()})
+
+	c.Assert(crawl.Nodes, HasLen, 1)
+	c.Check(crawl.Nodes[0].Address, Equals, seed.address())
+	c.Check(crawl.Unreachable, Equals, 0)
+}
+
+func (s *crawlSuite) TestRoutable(c *C) {
+	for _, address := range []string{"203.0.113.9:5889", "8.8.8.8:5889", "[2001:db8::1]:5889"} {
+		c.Check(routable(address), Equals, true, Commentf(address))
+	}
+
+	for _, address := range []string{
+		"127.0.0.1:5889", "10.1.2.3:5889", "172.20.0.1:5889", "192.168.0.10:5889",
+		"169.254.1.1:5889", "0.0.0.0:5889", "100.64.0.1:5889", "224.0.0.1:5889",
+		"[::1]:5889", "[::]:5889", "[fe80::1]:5889", "[fd00::1]:5889",
+		"8.8.8.8:0", "seed.example:5889", "8.8.8.8",
+	} {
+		c.Check(routable(address), Equals, false, Commentf(address))
+	}
+}
@@ -0,0 +1,233 @@
+package p2p
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+)
+
+// maxPayload is the largest message the reference client accepts.
+const maxPayload = 32 * 1024 * 1024
+
+// message is a command and its payload. On the wire it's preceded by a header of the
+// network's magic, the command padded to 12 bytes, the payload's length and a checksum.
+type message struct {
+	command string
+	payload []byte
+}
+
+// checksum is the first 4 bytes of the payload's double sha256.
+func checksum(payload []byte) []byte {
+	first := sha256.Sum256(payload)
+	second := sha256.Sum256(first[:])
+	return second[:4]
+}
+
+// writeMessage sends a message to a node on the network.
+func writeMessage(w io.Writer, magic [4]byte, command string, payload []byte) error {
+	var header [24]byte
+	copy(header[0:4], magic[:])
+	copy(header[4:16], command)
+	binary.LittleEndian.PutUint32(header[16:20], uint32(len(payload)))
+	copy(header[20:24], checksum(payload))
+
+	_, err := w.Write(append(header[:], payload...))
+	return err
+}
+
+// readMessage reads the next message from a node, checking that it's on the right network
+// and arrived intact.
+func readMessage(r io.Reader, magic [4]byte) (*message, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[0:4], magic[:]) {
+		return nil, fmt.Errorf("wrong network magic %x", header[0:4])
+	}
+
+	length := binary.LittleEndian.Uint32(header[16:20])
+	if length > maxPayload {
+		return nil, fmt.Errorf("payload of %d bytes is too big", length)
+	}
+
+	payload := make([]byte, length)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, err
+	}
+
+	if !bytes.Equal(header[20:24], checksum(payload)) {
+		return nil, errors.New("bad checksum")
+	}
+
+	return &message{command: string(bytes.TrimRight(header[4:16], "\x00")), payload: payload}, nil
+}
+
+// writeVarInt writes an integer in the protocol's variable length encoding.
+func writeVarInt(buf *bytes.Buffer, n uint64) {
+	switch {
+	case n < 0xfd:
+		buf.WriteByte(byte(n))
+	case n <= 0xffff:
+		buf.WriteByte(0xfd)
+		binary.Write(buf, binary.LittleEndian, uint16(n))
+	case n <= 0xffffffff:
+		buf.WriteByte(0xfe)
+		binary.Write(buf, binary.LittleEndian, uint32(n))
+	default:
+		buf.WriteByte(0xff)
+		binary.Write(buf, binary.LittleEndian, n)
+	}
+}
+
+// readVarInt reads an integer in the variable length encoding.
+func readVarInt(r *bytes.Reader) (uint64, error) {
+	prefix, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+
+	switch prefix {
+	case 0xfd:
+		var n uint16
+		err = binary.Read(r, binary.LittleEndian, &n)
+		return uint64(n), err
+	case 0xfe:
+		var n uint32
+		err = binary.Read(r, binary.LittleEndian, &n)
+		return uint64(n), err
+	case 0xff:
+		var n uint64
+		err = binary.Read(r, binary.LittleEndian, &n)
+		return n, err
+	}
+
+	return uint64(prefix), nil
+}
+
+// writeNetAddr writes an address without the time it was last seen, as it appears in a
+// version message. IPv4 addresses are mapped into IPv6 and the port is big endian.
+func writeNetAddr(buf *bytes.Buffer, services uint64, addr *net.TCPAddr) {
+	binary.Write(buf, binary.LittleEndian, services)
+
+	ip := net.IPv6zero
+	port := 0
+	if addr != nil {
+		ip, port = addr.IP.To16(), addr.Port
+	}
+	buf.Write(ip)
+	binary.Write(buf, binary.BigEndian, uint16(port))
+}
+
+// readNetAddr reads an address written by writeNetAddr and returns it as host:port.
+func readNetAddr(r *bytes.Reader) (string, error) {
+	var raw struct {
+		Services uint64
+		IP       [16]byte
+	}
+	if err := binary.Read(r, binary.LittleEndian, &raw); err != nil {
+		return "", err
+	}
+
+	var port uint16
+	if err := binary.Read(r, binary.BigEndian, &port); err != nil {
+		return "", err
+	}
+
+	return net.JoinHostPort(net.IP(raw.IP[:]).String(), strconv.Itoa(int(port))), nil
+}
+
+// Version is what a node says about itself when connecting.
+type Version struct {
+	Protocol  int32
+	Services  uint64
+	UserAgent string
+
+	// the height of the node's best block
+	Height int32
+}
+
+// encodeVersion builds the payload of a version message sent to remote.
+func encodeVersion(v *Version, remote *net.TCPAddr, nonce uint64) []byte {
+	buf := &bytes.Buffer{}
+	binary.Write(buf, binary.LittleEndian, v.Protocol)
+	binary.Write(buf, binary.LittleEndian, v.Services)
+	binary.Write(buf, binary.LittleEndian, time.Now().Unix())
+	writeNetAddr(buf, 0, remote)
+	writeNetAddr(buf, v.Services, nil)
+	binary.Write(buf, binary.LittleEndian, nonce)
+	writeVarInt(buf, uint64(len(v.UserAgent)))
+	buf.WriteString(v.UserAgent)
+	binary.Write(buf, binary.LittleEndian, v.Height)
+
+	// don't relay transactions, the crawler doesn't want them
+	buf.WriteByte(0)
+
+	return buf.Bytes()
+}
+
+// decodeVersion reads the payload of a version message.
+func decodeVersion(payload []byte) (*Version, error) {
+	r := bytes.NewReader(payload)
+	v := &Version{}
+
+	var timestamp int64
+	var nonce uint64
+	if err := binary.Read(r, binary.LittleEndian, &v.Protocol); err != nil {
+		return nil, fmt.Errorf("bad version message: %s", err)
+	}
+	binary.Read(r, binary.LittleEndian, &v.Services)
+	binary.Read(r, binary.LittleEndian, &timestamp)
+	readNetAddr(r)
+	readNetAddr(r)
+	binary.Read(r, binary.LittleEndian, &nonce)
+
+	length, err := readVarInt(r)
+	if err != nil || length > uint64(r.Len()) {
+		return nil, errors.New("bad version message: truncated user agent")
+	}
+	agent := make([]byte, length)
+	r.Read(agent)
+	v.UserAgent = string(agent)
+
+	if err := binary.Read(r, binary.LittleEndian, &v.Height); err != nil {
+		return nil, fmt.Errorf("bad version message: %s", err)
+	}
+
+	return v, nil
+}
+
+// decodeAddr reads the addresses in an addr message as host:port.
+func decodeAddr(payload []byte) ([]string, error) {
+	r := bytes.NewReader(payload)
+	count, err := readVarInt(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// each address is 30 bytes, a count that doesn't fit is a bad message
+	if count > uint64(r.Len())/30 {
+		return nil, fmt.Errorf("addr message claims %d addresses but only has %d bytes", count, r.Len())
+	}
+
+	addresses := make([]string, 0, count)
+	for i := uint64(0); i < count; i++ {
+		var seen uint32
+		binary.Read(r, binary.LittleEndian, &seen)
+
+		address, err := readNetAddr(r)
+		if err != nil {
+			return nil, err
+		}
+		addresses = append(addresses, address)
+	}
+
+	return addresses, nil
+}
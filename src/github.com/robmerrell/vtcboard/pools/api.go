@@ -0,0 +1,271 @@
+package pools
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API is the stats api of a pool, in one of the Dialects.
+type API struct {
+	Dialect string
+
+	// where the api lives, without the fragment
+	URL string
+
+	// the coin's name in a NOMP portal that runs several coins, from the url's fragment
+	Coin string
+
+	// the pool's name, the host of the url unless it's given after it
+	Name string
+}
+
+// Stats is what a pool reports about itself. Anything the pool's dialect doesn't report
+// is left as zero.
+type Stats struct {
+	// hashes per second
+	Hashrate float64
+
+	Miners        int
+	Workers       int
+	LastBlock     int64
+	LastBlockTime time.Time
+}
+
+// fetcher reads stats from an api in one dialect.
+type fetcher func(client *http.Client, api *API) (*Stats, error)
+
+// Dialects are the pool software whose apis can be read.
+var Dialects = map[string]fetcher{
+	"nomp":   fetchNOMP,
+	"mpos":   fetchMPOS,
+	"p2pool": fetchP2Pool,
+}
+
+// now is replaced in tests.
+var now = time.Now
+
+// ParseAPI reads an api written as the dialect followed by its url and optionally the
+// pool's name, eg: "nomp http://pool.example/api#vertcoin Example Pool". NOMP urls point
+// at the api directory, MPOS urls at index.php with the api_key and P2Pool urls at the
+// node's web port. The name should match the pool's in pools.json so its stats are shown
+// with the blocks it found. Errors leave out the url's query since it can hold a key.
+func ParseAPI(spec string) (*API, error) {
+	fields := strings.Fields(spec)
+	if len(fields) < 2 {
+		return nil, fmt.Errorf("%q should be a dialect followed by a url", redactURL(spec))
+	}
+
+	if _, ok := Dialects[fields[0]]; !ok {
+		names := []string{}
+		for name := range Dialects {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("%s has an unknown dialect %q, use one of %s", redactURL(fields[1]), fields[0], strings.Join(names, ", "))
+	}
+
+	u, err := url.Parse(fields[1])
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%s isn't an http url", redactURL(fields[1]))
+	}
+
+	api := &API{Dialect: fields[0], Coin: u.Fragment, Name: strings.Join(fields[2:], " ")}
+	if api.Name == "" {
+		api.Name = u.Host
+	}
+	u.Fragment = ""
+	api.URL = u.String()
+	return api, nil
+}
+
+// Link returns the pool's site, leaving out the path and query since they can hold an
+// api key.
+func (a *API) Link() string {
+	u, _ := url.Parse(a.URL)
+	return u.Scheme + "://" + u.Host
+}
+
+// Fetch reads the pool's current stats.
+func (a *API) Fetch(client *http.Client) (*Stats, error) {
+	return Dialects[a.Dialect](client, a)
+}
+
+// redactURL leaves the query out of a url, errors are logged and MPOS keeps its api key
+// there.
+func redactURL(rawurl string) string {
+	if i := strings.IndexAny(rawurl, "?#"); i != -1 {
+		return rawurl[:i]
+	}
+	return rawurl
+}
+
+// getJSON decodes the response from an api endpoint.
+func getJSON(client *http.Client, endpoint string, result interface{}) error {
+	resp, err := client.Get(endpoint)
+	if err != nil {
+		if urlErr, ok := err.(*url.Error); ok {
+			urlErr.URL = redactURL(urlErr.URL)
+		}
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", redactURL(endpoint), resp.Status)
+	}
+
+	if err := json.NewDecoder(resp.Body).Decode(result); err != nil {
+		return fmt.Errorf("%s: %s", redactURL(endpoint), err)
+	}
+	return nil
+}
+
+// nompStats is the part of a NOMP portal's /stats that's needed.
+type nompStats struct {
+	Pools map[string]struct {
+		Hashrate    float64                `json:"hashrate"`
+		WorkerCount int                    `json:"workerCount"`
+		Workers     map[string]interface{} `json:"workers"`
+	} `json:"pools"`
+}
+
+// fetchNOMP reads /stats and /blocks from a NOMP portal. Workers are named address.worker
+// so the miners are the distinct addresses. Blocks are listed as hash:tx:height, without
+// a time.
+func fetchNOMP(client *http.Client, api *API) (*Stats, error) {
+	base := strings.TrimSuffix(api.URL, "/")
+
+	var stats nompStats
+	if err := getJSON(client, base+"/stats", &stats); err != nil {
+		return nil, err
+	}
+
+	coin := api.Coin
+	if coin == "" && len(stats.Pools) == 1 {
+		for name := range stats.Pools {
+			coin = name
+		}
+	}
+
+	pool, ok := stats.Pools[coin]
+	if !ok {
+		return nil, fmt.Errorf("%s: no pool for coin %q, add it as the url's #fragment", redactURL(api.URL), coin)
+	}
+
+	result := &Stats{Hashrate: pool.Hashrate, Workers: pool.WorkerCount}
+
+	miners := make(map[string]bool)
+	for worker := range pool.Workers {
+		miners[strings.SplitN(worker, ".", 2)[0]] = true
+	}
+	result.Miners = len(miners)
+
+	var blocks map[string]string
+	if err := getJSON(client, base+"/blocks", &blocks); err != nil {
+		return nil, err
+	}
+	for key, block := range blocks {
+		if !strings.HasPrefix(key, coin+"-") {
+			continue
+		}
+
+		parts := strings.Split(block, ":")
+		if len(parts) < 3 {
+			continue
+		}
+		if height, err := strconv.ParseInt(parts[2], 10, 64); err == nil && height > result.LastBlock {
+			result.LastBlock = height
+		}
+	}
+
+	return result, nil
+}
+
+// mposStatus is the part of MPOS's getpoolstatus that's needed.
+type mposStatus struct {
+	GetPoolStatus struct {
+		Data struct {
+			// kilohashes per second
+			Hashrate      float64 `json:"hashrate"`
+			Workers       int     `json:"workers"`
+			LastBlock     int64   `json:"lastblock"`
+			TimeSinceLast int64   `json:"timesincelast"`
+		} `json:"data"`
+	} `json:"getpoolstatus"`
+}
+
+// fetchMPOS reads the getpoolstatus action of an MPOS api. MPOS doesn't say how many
+// miners there are.
+func fetchMPOS(client *http.Client, api *API) (*Stats, error) {
+	u, err := url.Parse(api.URL)
+	if err != nil {
+		return nil, err
+	}
+	query := u.Query()
+	query.Set("page", "api")
+	query.Set("action", "getpoolstatus")
+	u.RawQuery = query.Encode()
+
+	var status mposStatus
+	if err := getJSON(client, u.String(), &status); err != nil {
+		return nil, err
+	}
+
+	data := status.GetPoolStatus.Data
+	result := &Stats{
+		Hashrate:  data.Hashrate * 1000,
+		Workers:   data.Workers,
+		LastBlock: data.LastBlock,
+	}
+	if data.LastBlock > 0 {
+		result.LastBlockTime = now().Add(-time.Duration(data.TimeSinceLast) * time.Second).UTC()
+	}
+
+	return result, nil
+}
+
+// p2poolBlock is an entry in a P2Pool node's /recent_blocks.
+type p2poolBlock struct {
+	Time   float64 `json:"ts"`
+	Height int64   `json:"number"`
+}
+
+// fetchP2Pool reads /global_stats, /current_payouts and /recent_blocks from a P2Pool node.
+// Every address in the next payout is counted as a miner, and P2Pool doesn't report
+// workers across the whole pool.
+func fetchP2Pool(client *http.Client, api *API) (*Stats, error) {
+	base := strings.TrimSuffix(api.URL, "/")
+
+	var global struct {
+		Hashrate float64 `json:"pool_hash_rate"`
+	}
+	if err := getJSON(client, base+"/global_stats", &global); err != nil {
+		return nil, err
+	}
+
+	var payouts map[string]float64
+	if err := getJSON(client, base+"/current_payouts", &payouts); err != nil {
+		return nil, err
+	}
+
+	var blocks []p2poolBlock
+	if err := getJSON(client, base+"/recent_blocks", &blocks); err != nil {
+		return nil, err
+	}
+
+	result := &Stats{Hashrate: global.Hashrate, Miners: len(payouts)}
+
+	sort.Slice(blocks, func(i, j int) bool { return blocks[i].Height > blocks[j].Height })
+	if len(blocks) > 0 {
+		result.LastBlock = blocks[0].Height
+		result.LastBlockTime = time.Unix(int64(blocks[0].Time), 0).UTC()
+	}
+
+	return result, nil
+}
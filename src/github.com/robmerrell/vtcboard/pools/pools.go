@@ -0,0 +1,68 @@
+// Package pools works out which mining pool found a block from its coinbase tag and
+// payout addresses.
+package pools
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"strings"
+)
+
+// Pool is a known mining pool.
+type Pool struct {
+	Name string `json:"name"`
+	Link string `json:"link,omitempty"`
+}
+
+// Table maps coinbase tags and payout addresses to the pools that use them. It's read
+// from JSON in the same layout as the pools.json files other block explorers use:
+//
+//	{"coinbase_tags": {"/P2Pool/": {"name": "P2Pool"}}, "payout_addresses": {"V...": {"name": "..."}}}
+type Table struct {
+	Tags      map[string]Pool `json:"coinbase_tags"`
+	Addresses map[string]Pool `json:"payout_addresses"`
+
+	// tags longest first, so the most specific one matches
+	tagOrder []string
+}
+
+// LoadTable reads a table of pools.
+func LoadTable(r io.Reader) (*Table, error) {
+	t := &Table{}
+	if err := json.NewDecoder(r).Decode(t); err != nil {
+		return nil, err
+	}
+
+	for tag := range t.Tags {
+		t.tagOrder = append(t.tagOrder, tag)
+	}
+	sort.Slice(t.tagOrder, func(i, j int) bool {
+		if len(t.tagOrder[i]) != len(t.tagOrder[j]) {
+			return len(t.tagOrder[i]) > len(t.tagOrder[j])
+		}
+		return t.tagOrder[i] < t.tagOrder[j]
+	})
+
+	return t, nil
+}
+
+// Identify returns the pool that mined a block. Payout addresses are checked first since
+// they can't be copied by another pool, then the coinbase tag is searched for any of the
+// known tags, ignoring case.
+func (t *Table) Identify(tag string, addresses []string) (Pool, bool) {
+	for _, address := range addresses {
+		if pool, ok := t.Addresses[address]; ok {
+			return pool, true
+		}
+	}
+
+	lowerTag := strings.ToLower(tag)
+	for _, known := range t.tagOrder {
+		if strings.Contains(lowerTag, strings.ToLower(known)) {
+			return t.Tags[known], true
+		}
+	}
+
+	return Pool{}, false
+}
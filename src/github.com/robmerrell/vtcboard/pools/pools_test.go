@@ -0,0 +1,257 @@
+package pools
+
+import (
+	. "launchpad.net/gocheck"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+var testTable = `{
+	"coinbase_tags": {
+		"/P2Pool/": {"name": "P2Pool", "link": "http://p2pool.in"},
+		"vtcpool": {"name": "VTC Pool"},
+		"vtcpool.example/eu": {"name": "VTC Pool EU"}
+	},
+	"payout_addresses": {
+		"VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3": {"name": "Address Pool"}
+	}
+}`
+
+// -----------------
+// Identifying pools
+// -----------------
+type identifySuite struct {
+	table *Table
+}
+
+var _ = Suite(&identifySuite{})
+
+func (s *identifySuite) SetUpSuite(c *C) {
+	var err error
+	s.table, err = LoadTable(strings.NewReader(testTable))
+	c.Assert(err, IsNil)
+}
+
+func (s *identifySuite) TestIdentifyByTag(c *C) {
+	pool, ok := s.table.Identify("/P2Pool/ mined by someone", nil)
+	c.Check(ok, Equals, true)
+	c.Check(pool.Name, Equals, "P2Pool")
+	c.Check(pool.Link, Equals, "http://p2pool.in")
+
+	pool, _ = s.table.Identify("Mined by VTCPOOL.example", nil)
+	c.Check(pool.Name, Equals, "VTC Pool")
+
+	// the most specific tag wins
+	pool, _ = s.table.Identify("vtcpool.example/eu", nil)
+	c.Check(pool.Name, Equals, "VTC Pool EU")
+}
+
+func (s *identifySuite) TestAddressesBeatTags(c *C) {
+	pool, ok := s.table.Identify("/P2Pool/", []string{"Vother", "VkXaPyWMzfDo6QK8DDC2HN7E6Bp7Qz4ho3"})
+	c.Check(ok, Equals, true)
+	c.Check(pool.Name, Equals, "Address Pool")
+}
+
+func (s *identifySuite) TestUnknownMiner(c *C) {
+	_, ok := s.table.Identify("/someone/", []string{"Vother"})
+	c.Check(ok, Equals, false)
+}
+
+func (s *identifySuite) TestBadTable(c *C) {
+	_, err := LoadTable(strings.NewReader("not json"))
+	c.Check(err, NotNil)
+}
+
+// ------------
+// Distribution
+// ------------
+type distributionSuite struct {
+	table *Table
+}
+
+var _ = Suite(&distributionSuite{})
+
+func (s *distributionSuite) SetUpSuite(c *C) {
+	s.table, _ = LoadTable(strings.NewReader(testTable))
+}
+
+func (s *distributionSuite) TestShares(c *C) {
+	d := s.table.Distribution([]Mined{
+		{Height: 1, Tag: "/P2Pool/"},
+		{Height: 2, Tag: "/P2Pool/"},
+		{Height: 3, Tag: "vtcpool"},
+		{Height: 4, Tag: "/solo/"},
+		{Height: 5, Tag: "/solo/"},
+		{Height: 6, Addresses: []string{"Vsomeone"}},
+		{Height: 7, Tag: "/P2Pool/"},
+		{Height: 8, Tag: "vtcpool"},
+	})
+
+	c.Check(d.Blocks, Equals, 8)
+	c.Assert(len(d.Pools), Equals, 2)
+	c.Check(d.Pools[0].Name, Equals, "P2Pool")
+	c.Check(d.Pools[0].Blocks, Equals, 3)
+	c.Check(d.Pools[0].Share, Equals, 0.375)
+	c.Check(d.Pools[1].Name, Equals, "VTC Pool")
+
+	c.Check(d.Unknown.Name, Equals, UnknownName)
+	c.Check(d.Unknown.Blocks, Equals, 3)
+	c.Check(d.UnknownMiners, DeepEquals, []Unknown{
+		{Tag: "/solo/", Blocks: 2, LastHeight: 5},
+		{Address: "Vsomeone", Blocks: 1, LastHeight: 6},
+	})
+}
+
+func (s *distributionSuite) TestNoBlocks(c *C) {
+	d := s.table.Distribution(nil)
+	c.Check(d.Blocks, Equals, 0)
+	c.Check(d.Unknown.Share, Equals, float64(0))
+
+	_, ok := d.Dominant(0.4)
+	c.Check(ok, Equals, false)
+}
+
+func (s *distributionSuite) TestDominantPool(c *C) {
+	d := s.table.Distribution([]Mined{{Tag: "/P2Pool/"}, {Tag: "/P2Pool/"}, {Tag: "vtcpool"}, {Tag: "/solo/"}})
+
+	share, ok := d.Dominant(0.4)
+	c.Check(ok, Equals, true)
+	c.Check(share.Name, Equals, "P2Pool")
+
+	_, ok = d.Dominant(0.5)
+	c.Check(ok, Equals, false)
+}
+
+// ---------
+// Pool apis
+// ---------
+type apiSuite struct {
+	server *httptest.Server
+}
+
+var _ = Suite(&apiSuite{})
+
+// apiFixtures are the recorded responses in testdata served for each path.
+var apiFixtures = map[string]string{
+	"/nomp/api/stats":         "nomp_stats.json",
+	"/nomp/api/blocks":        "nomp_blocks.json",
+	"/mpos/index.php":         "mpos_getpoolstatus.json",
+	"/p2pool/global_stats":    "p2pool_global_stats.json",
+	"/p2pool/current_payouts": "p2pool_current_payouts.json",
+	"/p2pool/recent_blocks":   "p2pool_recent_blocks.json",
+	"/broken/api/stats":       "not_a_fixture.json",
+}
+
+func (s *apiSuite) SetUpSuite(c *C) {
+	s.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/mpos/index.php" && (r.URL.Query().Get("action") != "getpoolstatus" || r.URL.Query().Get("api_key") != "key") {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+
+		fixture, ok := apiFixtures[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		http.ServeFile(w, r, filepath.Join("testdata", fixture))
+	}))
+
+	now = func() time.Time { return time.Unix(1400000000, 0) }
+}
+
+func (s *apiSuite) TearDownSuite(c *C) {
+	s.server.Close()
+	now = time.Now
+}
+
+func (s *apiSuite) fetch(c *C, spec string) (*Stats, error) {
+	api, err := ParseAPI(spec)
+	c.Assert(err, IsNil)
+	return api.Fetch(http.DefaultClient)
+}
+
+func (s *apiSuite) TestParseAPI(c *C) {
+	api, err := ParseAPI("nomp http://pool.example:8080/api#vertcoin")
+	c.Assert(err, IsNil)
+	c.Check(api.Dialect, Equals, "nomp")
+	c.Check(api.URL, Equals, "http://pool.example:8080/api")
+	c.Check(api.Coin, Equals, "vertcoin")
+	c.Check(api.Name, Equals, "pool.example:8080")
+
+	api, _ = ParseAPI("mpos https://pool.example/index.php?api_key=secret Example Pool")
+	c.Check(api.Link(), Equals, "https://pool.example")
+	c.Check(api.Name, Equals, "Example Pool")
+
+	for _, bad := range []string{"http://pool.example/api", "stratum http://pool.example", "nomp pool.example/api", "stratum+tcp://a http://b"} {
+		_, err := ParseAPI(bad)
+		c.Check(err, NotNil, Commentf(bad))
+	}
+}
+
+func (s *apiSuite) TestNOMP(c *C) {
+	stats, err := s.fetch(c, "nomp "+s.server.URL+"/nomp/api#vertcoin")
+	c.Assert(err, IsNil)
+
+	c.Check(stats.Hashrate, Equals, 1398101.33)
+	c.Check(stats.Workers, Equals, 3)
+	c.Check(stats.Miners, Equals, 2)
+	c.Check(stats.LastBlock, Equals, int64(123456))
+	c.Check(stats.LastBlockTime.IsZero(), Equals, true)
+}
+
+func (s *apiSuite) TestNOMPNeedsTheCoinWithSeveralPools(c *C) {
+	_, err := s.fetch(c, "nomp "+s.server.URL+"/nomp/api")
+	c.Check(err, ErrorMatches, ".*no pool for coin.*")
+}
+
+func (s *apiSuite) TestMPOS(c *C) {
+	stats, err := s.fetch(c, "mpos "+s.server.URL+"/mpos/index.php?page=api&api_key=key")
+	c.Assert(err, IsNil)
+
+	c.Check(stats.Hashrate, Equals, 2500500.0)
+	c.Check(stats.Workers, Equals, 17)
+	c.Check(stats.Miners, Equals, 0)
+	c.Check(stats.LastBlock, Equals, int64(123401))
+	c.Check(stats.LastBlockTime, Equals, time.Unix(1400000000-1800, 0).UTC())
+}
+
+func (s *apiSuite) TestP2Pool(c *C) {
+	stats, err := s.fetch(c, "p2pool "+s.server.URL+"/p2pool/")
+	c.Assert(err, IsNil)
+
+	c.Check(stats.Hashrate, Equals, 50123456.7)
+	c.Check(stats.Miners, Equals, 3)
+	c.Check(stats.Workers, Equals, 0)
+	c.Check(stats.LastBlock, Equals, int64(123470))
+	c.Check(stats.LastBlockTime, Equals, time.Unix(1400003600, 0).UTC())
+}
+
+func (s *apiSuite) TestErrorsLeaveOutTheKey(c *C) {
+	_, err := s.fetch(c, "mpos "+s.server.URL+"/mpos/index.php?api_key=wrong")
+	c.Assert(err, NotNil)
+	c.Check(strings.Contains(err.Error(), "wrong"), Equals, false)
+
+	_, err = s.fetch(c, "mpos http://127.0.0.1:1/index.php?api_key=wrong")
+	c.Assert(err, NotNil)
+	c.Check(strings.Contains(err.Error(), "wrong"), Equals, false)
+
+	_, err = ParseAPI("pps https://pool.example/index.php?api_key=wrong")
+	c.Assert(err, NotNil)
+	c.Check(strings.Contains(err.Error(), "wrong"), Equals, false)
+}
+
+func (s *apiSuite) TestUnreachableAPI(c *C) {
+	_, err := s.fetch(c, "nomp "+s.server.URL+"/broken/api")
+	c.Check(err, NotNil)
+
+	_, err = s.fetch(c, "p2pool "+s.server.URL+"/missing")
+	c.Check(err, NotNil)
+}
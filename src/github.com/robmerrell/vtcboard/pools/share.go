@@ -0,0 +1,116 @@
+package pools
+
+import (
+	"sort"
+)
+
+// Mined is what's needed from a block to tell who mined it.
+type Mined struct {
+	Height    int64
+	Tag       string
+	Addresses []string
+}
+
+// Share is the part of the blocks a pool found.
+type Share struct {
+	Pool
+	Blocks int     `json:"blocks"`
+	Share  float64 `json:"share"`
+}
+
+// Unknown is a miner that isn't in the table, identified by its coinbase tag or, for
+// blocks without one, its first payout address.
+type Unknown struct {
+	Tag        string `json:"tag,omitempty"`
+	Address    string `json:"address,omitempty"`
+	Blocks     int    `json:"blocks"`
+	LastHeight int64  `json:"lastHeight"`
+}
+
+// Distribution is how a set of blocks is split between pools.
+type Distribution struct {
+	Blocks int `json:"blocks"`
+
+	// known pools with the most blocks first
+	Pools []Share `json:"pools"`
+
+	// every block not found by a known pool, grouped together
+	Unknown Share `json:"unknown"`
+
+	// the miners behind the unknown blocks, with the most blocks first
+	UnknownMiners []Unknown `json:"unknownMiners"`
+}
+
+// UnknownName is the name the blocks of unknown miners are grouped under.
+const UnknownName = "Unknown"
+
+// Distribution works out the share of blocks each pool found.
+func (t *Table) Distribution(blocks []Mined) *Distribution {
+	d := &Distribution{Blocks: len(blocks), Pools: []Share{}, UnknownMiners: []Unknown{}}
+	d.Unknown.Name = UnknownName
+
+	known := make(map[string]*Share)
+	unknown := make(map[Unknown]*Unknown)
+
+	for _, block := range blocks {
+		if pool, ok := t.Identify(block.Tag, block.Addresses); ok {
+			if known[pool.Name] == nil {
+				known[pool.Name] = &Share{Pool: pool}
+			}
+			known[pool.Name].Blocks++
+			continue
+		}
+
+		d.Unknown.Blocks++
+
+		key := Unknown{Tag: block.Tag}
+		if key.Tag == "" && len(block.Addresses) > 0 {
+			key.Address = block.Addresses[0]
+		}
+		if unknown[key] == nil {
+			miner := key
+			unknown[key] = &miner
+		}
+		unknown[key].Blocks++
+		if block.Height > unknown[key].LastHeight {
+			unknown[key].LastHeight = block.Height
+		}
+	}
+
+	for _, share := range known {
+		share.Share = float64(share.Blocks) / float64(d.Blocks)
+		d.Pools = append(d.Pools, *share)
+	}
+	sort.Slice(d.Pools, func(i, j int) bool {
+		if d.Pools[i].Blocks != d.Pools[j].Blocks {
+			return d.Pools[i].Blocks > d.Pools[j].Blocks
+		}
+		return d.Pools[i].Name < d.Pools[j].Name
+	})
+
+	if d.Blocks > 0 {
+		d.Unknown.Share = float64(d.Unknown.Blocks) / float64(d.Blocks)
+	}
+
+	for _, miner := range unknown {
+		d.UnknownMiners = append(d.UnknownMiners, *miner)
+	}
+	sort.Slice(d.UnknownMiners, func(i, j int) bool {
+		if d.UnknownMiners[i].Blocks != d.UnknownMiners[j].Blocks {
+			return d.UnknownMiners[i].Blocks > d.UnknownMiners[j].Blocks
+		}
+		return d.UnknownMiners[i].LastHeight > d.UnknownMiners[j].LastHeight
+	})
+
+	return d
+}
+
+// Dominant returns the known pool with the largest share if it's over threshold, a
+// fraction between 0 and 1. Unknown miners aren't counted since they're rarely one pool.
+func (d *Distribution) Dominant(threshold float64) (Share, bool) {
+	if len(d.Pools) == 0 || d.Pools[0].Share <= threshold {
+		return Share{}, false
+	}
+
+	return d.Pools[0], true
+}
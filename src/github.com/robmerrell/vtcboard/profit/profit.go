@@ -0,0 +1,81 @@
+// Package profit works out what a miner can expect to earn.
+package profit
+
+// hashesPerDifficulty is how many hashes it takes on average to find a block at
+// difficulty 1.
+const hashesPerDifficulty = 1 << 32
+
+// Rig is a miner's setup.
+type Rig struct {
+	// hashes per second
+	Hashrate float64
+
+	// watts drawn while mining
+	Power float64
+
+	// price of a kilowatt hour
+	Cost float64
+
+	// part of the rewards kept by the pool, between 0 and 1
+	Fee float64
+}
+
+// Conditions are the state of the network and market at some point.
+type Conditions struct {
+	Difficulty float64 `json:"difficulty"`
+
+	// coins paid for each block
+	Reward float64 `json:"blockReward"`
+
+	// price of one coin
+	Price float64 `json:"price"`
+}
+
+// Estimate is what a rig earns in a day.
+type Estimate struct {
+	Coins     float64 `json:"coinsPerDay"`
+	Revenue   float64 `json:"revenuePerDay"`
+	PowerCost float64 `json:"powerCostPerDay"`
+	Profit    float64 `json:"profitPerDay"`
+}
+
+// Daily estimates a day of mining with a rig under the given conditions.
+func Daily(rig Rig, c Conditions) Estimate {
+	e := Estimate{PowerCost: rig.Power / 1000 * 24 * rig.Cost}
+
+	if c.Difficulty > 0 {
+		blocks := rig.Hashrate * 86400 / (c.Difficulty * hashesPerDifficulty)
+		e.Coins = blocks * c.Reward * (1 - rig.Fee)
+	}
+
+	e.Revenue = e.Coins * c.Price
+	e.Profit = e.Revenue - e.PowerCost
+	return e
+}
+
+// Revenue returns what one hash per second earns in a day under the given conditions,
+// before the pool's fee. A rig earns in proportion to its hashrate, so this is enough to
+// work out the profit of any rig.
+func Revenue(c Conditions) float64 {
+	if c.Difficulty <= 0 {
+		return 0
+	}
+
+	return 86400 / (c.Difficulty * hashesPerDifficulty) * c.Reward * c.Price
+}
+
+// Profit returns a rig's profit for a day given the Revenue of a hash per second.
+func Profit(rig Rig, revenue float64) float64 {
+	return rig.Hashrate*(1-rig.Fee)*revenue - rig.Power/1000*24*rig.Cost
+}
+
+// BreakEvenPrice returns the coin price at which a rig's revenue covers its power, or 0
+// if it doesn't mine anything.
+func BreakEvenPrice(rig Rig, c Conditions) float64 {
+	e := Daily(rig, c)
+	if e.Coins == 0 {
+		return 0
+	}
+
+	return e.PowerCost / e.Coins
+}
@@ -0,0 +1,53 @@
+package profit
+
+import (
+	. "launchpad.net/gocheck"
+	"math"
+	"testing"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type profitSuite struct{}
+
+var _ = Suite(&profitSuite{})
+
+// oneBlockADay finds a block a day at difficulty 1.
+var oneBlockADay = float64(hashesPerDifficulty) / 86400
+
+func (s *profitSuite) TestDaily(c *C) {
+	e := Daily(Rig{Hashrate: oneBlockADay, Power: 1000, Cost: 0.1}, Conditions{Difficulty: 1, Reward: 50, Price: 0.5})
+
+	c.Check(e.Coins, Equals, float64(50))
+	c.Check(e.Revenue, Equals, float64(25))
+	c.Check(math.Abs(e.PowerCost-2.4) < 1e-9, Equals, true)
+	c.Check(math.Abs(e.Profit-22.6) < 1e-9, Equals, true)
+}
+
+func (s *profitSuite) TestDifficultyAndFee(c *C) {
+	e := Daily(Rig{Hashrate: oneBlockADay, Fee: 0.02}, Conditions{Difficulty: 4, Reward: 50, Price: 1})
+	c.Check(e.Coins, Equals, 12.5*0.98)
+
+	// no difficulty yet means no estimate rather than dividing by zero
+	e = Daily(Rig{Hashrate: oneBlockADay, Power: 100, Cost: 1}, Conditions{Reward: 50, Price: 1})
+	c.Check(e.Coins, Equals, float64(0))
+	c.Check(e.Profit, Equals, -e.PowerCost)
+}
+
+func (s *profitSuite) TestBreakEvenPrice(c *C) {
+	rig := Rig{Hashrate: oneBlockADay, Power: 1000, Cost: 0.1}
+	price := BreakEvenPrice(rig, Conditions{Difficulty: 1, Reward: 50})
+	c.Check(math.Abs(price-0.048) < 1e-9, Equals, true)
+
+	c.Check(BreakEvenPrice(Rig{Power: 1000, Cost: 0.1}, Conditions{Difficulty: 1, Reward: 50}), Equals, float64(0))
+}
+
+func (s *profitSuite) TestRevenueAndProfit(c *C) {
+	rig := Rig{Hashrate: oneBlockADay * 2, Power: 1000, Cost: 0.1, Fee: 0.02}
+	conditions := Conditions{Difficulty: 4, Reward: 50, Price: 0.5}
+
+	c.Check(Revenue(conditions)*oneBlockADay, Equals, 6.25)
+	c.Check(math.Abs(Profit(rig, Revenue(conditions))-Daily(rig, conditions).Profit) < 1e-9, Equals, true)
+	c.Check(Revenue(Conditions{Reward: 50, Price: 1}), Equals, float64(0))
+}
@@ -0,0 +1,47 @@
+// Keeps the dashboard up to date with server-sent events from /events.
+$(function() {
+  if (!window.EventSource) {
+    return;
+  }
+
+  var maxPosts = 8;
+  var events = new EventSource("/events");
+
+  events.addEventListener("price", function(e) {
+    var price = JSON.parse(e.data);
+
+    $("#usd").text(price.usd);
+    $("#btc").text(price.btc);
+    $("#change").text(price.change);
+    $("#changeBox")
+      .removeClass("percent-change-stat-up percent-change-stat-down")
+      .addClass(price.changeStyle);
+    if (price.marketCap) {
+      $("#marketCap").text(price.marketCap);
+    }
+
+    if (window.addChartPoint) {
+      window.addChartPoint(price.time, price.usdValue, price.btcValue);
+    }
+  });
+
+  events.addEventListener("network", function(e) {
+    var network = JSON.parse(e.data);
+
+    $("#hashRate").text(network.hashRate);
+    $("#difficulty").text(network.difficulty);
+    $("#mined").text(network.mined);
+    $("#remaining").text(network.remaining);
+  });
+
+  events.addEventListener("posts", function(e) {
+    var post = JSON.parse(e.data);
+    var list = $("ul.news-body").filter(function() {
+      return $(this).data("source") == post.source;
+    });
+
+    var link = $("<a>").attr("href", post.url).text(post.title);
+    list.prepend($("<li>").append(link));
+    list.children("li").slice(maxPosts).remove();
+  });
+});
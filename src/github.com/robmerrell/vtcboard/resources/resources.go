@@ -0,0 +1,38 @@
+// Package resources embeds the templates, static assets and default configs into the
+// binary so that deploying is a single file copy.
+package resources
+
+import (
+	"embed"
+	"io/fs"
+	"os"
+)
+
+//go:embed configs public views pools.json
+var embedded embed.FS
+
+// FS returns the embedded resources. If overrideDir is set, files in it are used
+// instead of their embedded counterparts, which allows customizing templates without
+// rebuilding. For example overrideDir/views/main.html.mustache replaces the main view.
+func FS(overrideDir string) fs.FS {
+	if overrideDir == "" {
+		return embedded
+	}
+
+	return &overlayFS{override: os.DirFS(overrideDir), base: embedded}
+}
+
+// overlayFS opens files from override if they exist there and from base otherwise.
+type overlayFS struct {
+	override fs.FS
+	base     fs.FS
+}
+
+func (o *overlayFS) Open(name string) (fs.File, error) {
+	file, err := o.override.Open(name)
+	if err == nil {
+		return file, nil
+	}
+
+	return o.base.Open(name)
+}
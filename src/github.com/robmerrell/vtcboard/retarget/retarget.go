@@ -0,0 +1,299 @@
+// Package retarget models how the difficulty changes from block to block, and sums up
+// how quickly recent blocks have been found.
+package retarget
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+// Block is what the retarget algorithms look at in a block.
+type Block struct {
+	Height     int64
+	Time       time.Time
+	Difficulty float64
+}
+
+// Algorithm works out the difficulty of the block after the ones given.
+type Algorithm interface {
+	// Next is given blocks oldest first. With too few of them it returns the
+	// difficulty of the newest.
+	Next(blocks []Block) float64
+
+	// Window is how many of the latest blocks Next can look at.
+	Window() int
+
+	// Spacing is the time the algorithm aims for between blocks.
+	Spacing() time.Duration
+}
+
+// Algorithms are the retarget rules that can be picked in the config. Forks with their own
+// rules can be modeled by adding them here.
+var Algorithms = map[string]Algorithm{
+	"kgw": &KimotoGravityWell{
+		BlockTime: time.Second * 150,
+		MinSpan:   time.Hour * 6,
+		MaxSpan:   time.Hour * 24 * 7,
+	},
+	"dgw": &DarkGravityWave{
+		BlockTime: time.Second * 150,
+		Blocks:    24,
+	},
+}
+
+// Find looks up an algorithm by name.
+func Find(name string) (Algorithm, error) {
+	algorithm, ok := Algorithms[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown retarget algorithm %q", name)
+	}
+
+	return algorithm, nil
+}
+
+// KimotoGravityWell is the retarget vertcoin launched with. It averages the difficulty
+// over more blocks the closer their rate is to the target, stopping as soon as the rate
+// moves outside an "event horizon" that narrows as blocks are added.
+type KimotoGravityWell struct {
+	BlockTime time.Duration
+
+	// the fewest and most blocks averaged, given as the time they'd take at BlockTime
+	MinSpan time.Duration
+	MaxSpan time.Duration
+}
+
+func (k *KimotoGravityWell) Window() int {
+	return int(k.MaxSpan / k.BlockTime)
+}
+
+func (k *KimotoGravityWell) Spacing() time.Duration {
+	return k.BlockTime
+}
+
+// Next follows the reference client, except it works with difficulties rather than
+// targets. A target is the inverse of a difficulty so targets are averaged by averaging
+// the inverses. The target time counts blocks rather than the intervals between them
+// like the reference client does.
+func (k *KimotoGravityWell) Next(blocks []Block) float64 {
+	if len(blocks) == 0 {
+		return 0
+	}
+
+	last := blocks[len(blocks)-1]
+	minBlocks := float64(k.MinSpan / k.BlockTime)
+	if float64(len(blocks)) < minBlocks {
+		return last.Difficulty
+	}
+
+	var mass, averageTarget, actual, target float64
+	for i := 1; i <= k.Window() && i <= len(blocks); i++ {
+		reading := blocks[len(blocks)-i]
+		if reading.Difficulty <= 0 {
+			return last.Difficulty
+		}
+
+		mass++
+		averageTarget += (1/reading.Difficulty - averageTarget) / mass
+
+		actual = math.Max(last.Time.Sub(reading.Time).Seconds(), 0)
+		target = k.BlockTime.Seconds() * mass
+
+		ratio := 1.0
+		if actual != 0 {
+			ratio = target / actual
+		}
+
+		horizon := 1 + 0.7084*math.Pow(mass/28.2, -1.228)
+		if mass >= minBlocks && (ratio <= 1/horizon || ratio >= horizon) {
+			break
+		}
+	}
+
+	if actual == 0 {
+		return 1 / averageTarget
+	}
+
+	return 1 / (averageTarget * actual / target)
+}
+
+// DarkGravityWave averages the difficulty of a fixed number of blocks and scales it by how
+// long they took, limited to a third or three times the target. As in KimotoGravityWell
+// the target time counts blocks rather than intervals.
+type DarkGravityWave struct {
+	BlockTime time.Duration
+	Blocks    int
+}
+
+func (d *DarkGravityWave) Window() int {
+	return d.Blocks
+}
+
+func (d *DarkGravityWave) Spacing() time.Duration {
+	return d.BlockTime
+}
+
+func (d *DarkGravityWave) Next(blocks []Block) float64 {
+	if len(blocks) == 0 {
+		return 0
+	}
+
+	last := blocks[len(blocks)-1]
+	if len(blocks) < d.Blocks {
+		return last.Difficulty
+	}
+
+	recent := blocks[len(blocks)-d.Blocks:]
+	averageTarget := 0.0
+	for _, block := range recent {
+		if block.Difficulty <= 0 {
+			return last.Difficulty
+		}
+		averageTarget += 1 / block.Difficulty
+	}
+	averageTarget /= float64(len(recent))
+
+	target := d.BlockTime.Seconds() * float64(d.Blocks)
+	actual := last.Time.Sub(recent[0].Time).Seconds()
+	actual = math.Min(math.Max(actual, target/3), target*3)
+
+	return 1 / (averageTarget * actual / target)
+}
+
+// Intervals are stats about the time between blocks.
+type Intervals struct {
+	Count  int
+	Mean   time.Duration
+	Median time.Duration
+	StdDev time.Duration
+	Min    time.Duration
+	Max    time.Duration
+}
+
+// Stats works out the intervals between blocks given oldest first. Miners' clocks
+// disagree so a block can be older than the one before it, which counts as no time.
+func Stats(blocks []Block) Intervals {
+	if len(blocks) < 2 {
+		return Intervals{}
+	}
+
+	intervals := make([]time.Duration, 0, len(blocks)-1)
+	var total time.Duration
+	for i := 1; i < len(blocks); i++ {
+		interval := blocks[i].Time.Sub(blocks[i-1].Time)
+		if interval < 0 {
+			interval = 0
+		}
+		intervals = append(intervals, interval)
+		total += interval
+	}
+
+	sort.Slice(intervals, func(i, j int) bool { return intervals[i] < intervals[j] })
+
+	stats := Intervals{
+		Count: len(intervals),
+		Mean:  total / time.Duration(len(intervals)),
+		Min:   intervals[0],
+		Max:   intervals[len(intervals)-1],
+	}
+
+	middle := len(intervals) / 2
+	stats.Median = intervals[middle]
+	if len(intervals)%2 == 0 {
+		stats.Median = (intervals[middle-1] + intervals[middle]) / 2
+	}
+
+	variance := 0.0
+	for _, interval := range intervals {
+		d := (interval - stats.Mean).Seconds()
+		variance += d * d
+	}
+	stats.StdDev = time.Duration(math.Sqrt(variance/float64(len(intervals))) * float64(time.Second))
+
+	return stats
+}
+
+// Thresholds decide when a run of blocks is unusual.
+type Thresholds struct {
+	// blocks in the run
+	Run int
+
+	// the run is fast when its mean interval is below this part of the spacing, and
+	// slow when it's above Slow
+	Fast float64
+	Slow float64
+}
+
+// Anomaly kinds.
+const (
+	Fast = "fast"
+	Slow = "slow"
+)
+
+// Analysis sums up the latest blocks.
+type Analysis struct {
+	Algorithm string
+	Spacing   time.Duration
+	Height    int64
+
+	Current float64
+	Next    float64
+
+	// fraction the difficulty is expected to move by on the next block
+	Change float64
+
+	Intervals Intervals
+
+	// the mean interval of the latest run of blocks, and Fast or Slow if it's unusual
+	RunMean time.Duration
+	Anomaly string
+}
+
+// Analyze estimates the next difficulty with the named algorithm and looks for runs of
+// unusually fast or slow blocks. Blocks are oldest first, stats are worked out over the
+// latest window of them.
+func Analyze(name string, blocks []Block, window int, thresholds Thresholds) (*Analysis, error) {
+	algorithm, err := Find(name)
+	if err != nil {
+		return nil, err
+	}
+
+	a := &Analysis{Algorithm: name, Spacing: algorithm.Spacing()}
+	if len(blocks) == 0 {
+		return a, nil
+	}
+
+	last := blocks[len(blocks)-1]
+	a.Height = last.Height
+	a.Current = last.Difficulty
+	a.Next = algorithm.Next(blocks)
+	if a.Current > 0 {
+		a.Change = a.Next/a.Current - 1
+	}
+
+	a.Intervals = Stats(latest(blocks, window+1))
+
+	// a run of n blocks has n intervals
+	if len(blocks) > thresholds.Run && thresholds.Run > 0 {
+		a.RunMean = Stats(latest(blocks, thresholds.Run+1)).Mean
+
+		switch ratio := float64(a.RunMean) / float64(a.Spacing); {
+		case ratio < thresholds.Fast:
+			a.Anomaly = Fast
+		case ratio > thresholds.Slow:
+			a.Anomaly = Slow
+		}
+	}
+
+	return a, nil
+}
+
+// latest returns the last n blocks.
+func latest(blocks []Block, n int) []Block {
+	if n >= len(blocks) {
+		return blocks
+	}
+
+	return blocks[len(blocks)-n:]
+}
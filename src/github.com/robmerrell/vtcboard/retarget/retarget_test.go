@@ -0,0 +1,127 @@
+package retarget
+
+import (
+	. "launchpad.net/gocheck"
+	"math"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+type retargetSuite struct{}
+
+var _ = Suite(&retargetSuite{})
+
+// steadyBlocks makes count blocks at a difficulty found every interval.
+func steadyBlocks(count int, interval time.Duration, difficulty float64) []Block {
+	start := time.Date(2014, 3, 1, 0, 0, 0, 0, time.UTC)
+	blocks := make([]Block, 0, count)
+	for i := 0; i < count; i++ {
+		blocks = append(blocks, Block{Height: int64(i + 1), Time: start.Add(interval * time.Duration(i)), Difficulty: difficulty})
+	}
+
+	return blocks
+}
+
+// near checks that two difficulties are within a millionth of each other.
+func near(a, b float64) bool {
+	return math.Abs(a-b) <= math.Abs(b)*1e-6
+}
+
+func (s *retargetSuite) TestFind(c *C) {
+	algorithm, err := Find("kgw")
+	c.Assert(err, IsNil)
+	c.Check(algorithm.Spacing(), Equals, time.Second*150)
+	c.Check(algorithm.Window(), Equals, 4032)
+
+	_, err = Find("sha256")
+	c.Check(err, ErrorMatches, `unknown retarget algorithm "sha256"`)
+}
+
+func (s *retargetSuite) TestKimotoGravityWellOnTarget(c *C) {
+	kgw := Algorithms["kgw"]
+	blocks := steadyBlocks(500, time.Second*150, 10)
+
+	// like the reference client the target time counts blocks rather than the intervals
+	// between them, so blocks on target nudge the difficulty up slightly
+	c.Check(near(kgw.Next(blocks), 10*500.0/499), Equals, true)
+}
+
+func (s *retargetSuite) TestKimotoGravityWellFastBlocks(c *C) {
+	kgw := Algorithms["kgw"]
+	blocks := steadyBlocks(500, time.Second*75, 10)
+
+	// blocks twice as fast as the target leave the event horizon as soon as the fewest
+	// blocks have been averaged, and double the difficulty
+	c.Check(near(kgw.Next(blocks), 20*144.0/143), Equals, true)
+}
+
+func (s *retargetSuite) TestKimotoGravityWellTooFewBlocks(c *C) {
+	kgw := Algorithms["kgw"]
+	blocks := steadyBlocks(100, time.Second*75, 10)
+
+	c.Check(kgw.Next(blocks), Equals, float64(10))
+	c.Check(kgw.Next(nil), Equals, float64(0))
+}
+
+func (s *retargetSuite) TestDarkGravityWave(c *C) {
+	dgw := Algorithms["dgw"]
+
+	c.Check(near(dgw.Next(steadyBlocks(30, time.Second*150, 10)), 10*24.0/23), Equals, true)
+	c.Check(near(dgw.Next(steadyBlocks(30, time.Second*300, 10)), 5*24.0/23), Equals, true)
+
+	// the timespan is limited to three times the target
+	c.Check(near(dgw.Next(steadyBlocks(30, time.Hour, 10)), 10.0/3), Equals, true)
+
+	c.Check(dgw.Next(steadyBlocks(10, time.Second*300, 10)), Equals, float64(10))
+}
+
+func (s *retargetSuite) TestStats(c *C) {
+	blocks := steadyBlocks(5, time.Minute, 1)
+	blocks[2].Time = blocks[1].Time.Add(time.Minute * 3)
+
+	// intervals of 1m, 3m, 0 (the next block is older) and 1m
+	stats := Stats(blocks)
+	c.Check(stats.Count, Equals, 4)
+	c.Check(stats.Mean, Equals, time.Second*75)
+	c.Check(stats.Median, Equals, time.Minute)
+	c.Check(stats.Min, Equals, time.Duration(0))
+	c.Check(stats.Max, Equals, time.Minute*3)
+	c.Check(stats.StdDev.Seconds() > 60 && stats.StdDev.Seconds() < 70, Equals, true)
+
+	c.Check(Stats(blocks[:1]), Equals, Intervals{})
+}
+
+func (s *retargetSuite) TestAnalyze(c *C) {
+	thresholds := Thresholds{Run: 12, Fast: 0.5, Slow: 2}
+
+	// on target for a while, then a run of fast blocks
+	blocks := steadyBlocks(500, time.Second*150, 10)
+	last := blocks[len(blocks)-1]
+	for i := 1; i <= 12; i++ {
+		blocks = append(blocks, Block{Height: last.Height + int64(i), Time: last.Time.Add(time.Second * 30 * time.Duration(i)), Difficulty: 10})
+	}
+
+	a, err := Analyze("kgw", blocks, 120, thresholds)
+	c.Assert(err, IsNil)
+	c.Check(a.Height, Equals, int64(512))
+	c.Check(a.Current, Equals, float64(10))
+	c.Check(a.Next > 10, Equals, true)
+	c.Check(a.Change > 0, Equals, true)
+	c.Check(a.Intervals.Count, Equals, 120)
+	c.Check(a.RunMean, Equals, time.Second*30)
+	c.Check(a.Anomaly, Equals, Fast)
+
+	a, err = Analyze("kgw", steadyBlocks(500, time.Second*400, 10), 120, thresholds)
+	c.Assert(err, IsNil)
+	c.Check(a.Anomaly, Equals, Slow)
+
+	a, err = Analyze("kgw", steadyBlocks(500, time.Second*150, 10), 120, thresholds)
+	c.Assert(err, IsNil)
+	c.Check(a.Anomaly, Equals, "")
+
+	_, err = Analyze("sha256", blocks, 120, thresholds)
+	c.Check(err, NotNil)
+}
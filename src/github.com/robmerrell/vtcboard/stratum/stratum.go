@@ -0,0 +1,144 @@
+// Package stratum checks that a mining pool accepts miners by connecting to it the same
+// way a miner would.
+package stratum
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Status is the outcome of probing a pool.
+type Status struct {
+	// the pool subscribed and authorized the probe worker, then sent it a job
+	Up bool
+
+	// how long the pool took to answer mining.subscribe
+	Latency time.Duration
+
+	// from connecting until the first job arrived
+	FirstJob time.Duration
+
+	// why the pool is down
+	Err error
+}
+
+// Agent is the miner name sent when subscribing.
+var Agent = "vtcboard-probe/1.0"
+
+// ParseEndpoint returns the host:port of a stratum+tcp:// url.
+func ParseEndpoint(endpoint string) (string, error) {
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Scheme != "stratum+tcp" || u.Host == "" || u.Port() == "" {
+		return "", fmt.Errorf("%q should look like stratum+tcp://host:port", endpoint)
+	}
+
+	return u.Host, nil
+}
+
+// message is a stratum request, response or notification. Stratum is JSON-RPC with one
+// message per line.
+type message struct {
+	ID     interface{}     `json:"id"`
+	Method string          `json:"method,omitempty"`
+	Params interface{}     `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  interface{}     `json:"error,omitempty"`
+}
+
+// ids of the probe's requests
+const (
+	subscribeID = 1
+	authorizeID = 2
+)
+
+// Probe connects to the pool at address, subscribes, authorizes worker and waits for the
+// first job. The whole probe has to finish within timeout.
+func Probe(address, worker, password string, timeout time.Duration) *Status {
+	status := &Status{}
+	start := time.Now()
+
+	conn, err := net.DialTimeout("tcp", address, timeout)
+	if err != nil {
+		status.Err = err
+		return status
+	}
+	defer conn.Close()
+	conn.SetDeadline(start.Add(timeout))
+
+	encoder := json.NewEncoder(conn)
+	lines := bufio.NewScanner(conn)
+
+	send := func(id int, method string, params ...interface{}) error {
+		return encoder.Encode(message{ID: id, Method: method, Params: params})
+	}
+
+	subscribeSent := time.Now()
+	if status.Err = send(subscribeID, "mining.subscribe", Agent); status.Err != nil {
+		return status
+	}
+
+	subscribed, authorized, gotJob := false, false, false
+	for !(subscribed && authorized && gotJob) {
+		if !lines.Scan() {
+			switch err := lines.Err(); {
+			case errors.Is(err, os.ErrDeadlineExceeded):
+				status.Err = fmt.Errorf("timed out after %s", timeout)
+			case err != nil:
+				status.Err = err
+			default:
+				status.Err = errors.New("connection closed by the pool")
+			}
+			return status
+		}
+
+		var msg message
+		if err := json.Unmarshal(lines.Bytes(), &msg); err != nil {
+			status.Err = fmt.Errorf("bad message from the pool: %s", err)
+			return status
+		}
+
+		if msg.Method == "mining.notify" {
+			if !gotJob {
+				status.FirstJob = time.Since(start)
+			}
+			gotJob = true
+			continue
+		}
+
+		// other notifications, like mining.set_difficulty, don't matter here
+		if msg.Method != "" {
+			continue
+		}
+
+		id, _ := msg.ID.(float64)
+		switch {
+		case id == subscribeID:
+			if msg.Error != nil || len(msg.Result) == 0 || string(msg.Result) == "null" {
+				status.Err = fmt.Errorf("subscribe failed: %v", msg.Error)
+				return status
+			}
+			status.Latency = time.Since(subscribeSent)
+			subscribed = true
+
+			if status.Err = send(authorizeID, "mining.authorize", worker, password); status.Err != nil {
+				return status
+			}
+		case id == authorizeID:
+			if msg.Error != nil || strings.TrimSpace(string(msg.Result)) != "true" {
+				status.Err = fmt.Errorf("worker %s wasn't authorized", worker)
+				return status
+			}
+			authorized = true
+		}
+	}
+
+	status.Up = true
+	return status
+}
@@ -0,0 +1,145 @@
+package stratum
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	. "launchpad.net/gocheck"
+	"net"
+	"testing"
+	"time"
+)
+
+// Hook up gocheck into the "go test" runner.
+func Test(t *testing.T) { TestingT(t) }
+
+// fakePool is a local stratum server. It answers the way pools usually do unless told
+// to misbehave.
+type fakePool struct {
+	listener net.Listener
+
+	rejectWorkers bool
+	withholdJobs  bool
+	jobFirst      bool
+}
+
+func newFakePool(c *C) *fakePool {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	c.Assert(err, IsNil)
+
+	pool := &fakePool{listener: listener}
+	go pool.serve()
+	return pool
+}
+
+func (p *fakePool) serve() {
+	for {
+		conn, err := p.listener.Accept()
+		if err != nil {
+			return
+		}
+		go p.handle(conn)
+	}
+}
+
+func (p *fakePool) handle(conn net.Conn) {
+	defer conn.Close()
+
+	notify := `{"id": null, "method": "mining.notify", "params": ["job1", "prevhash", "cb1", "cb2", [], "00000002", "1b0404cb", "52a7b7d3", true]}`
+	lines := bufio.NewScanner(conn)
+	for lines.Scan() {
+		var request struct {
+			ID     int           `json:"id"`
+			Method string        `json:"method"`
+			Params []interface{} `json:"params"`
+		}
+		json.Unmarshal(lines.Bytes(), &request)
+
+		switch request.Method {
+		case "mining.subscribe":
+			fmt.Fprintf(conn, `{"id": %d, "result": [[["mining.notify", "ae6812eb4cd7735a302a8a9dd95cf71f"]], "08000002", 4], "error": null}`+"\n", request.ID)
+		case "mining.authorize":
+			if p.jobFirst && !p.withholdJobs {
+				fmt.Fprintln(conn, notify)
+			}
+			fmt.Fprintf(conn, `{"id": %d, "result": %t, "error": null}`+"\n", request.ID, !p.rejectWorkers)
+			fmt.Fprintln(conn, `{"id": null, "method": "mining.set_difficulty", "params": [0.5]}`)
+			if !p.jobFirst && !p.withholdJobs && !p.rejectWorkers {
+				fmt.Fprintln(conn, notify)
+			}
+		}
+	}
+}
+
+func (p *fakePool) address() string {
+	return p.listener.Addr().String()
+}
+
+// -------------
+// Probing pools
+// -------------
+type probeSuite struct{}
+
+var _ = Suite(&probeSuite{})
+
+func (s *probeSuite) TestHealthyPool(c *C) {
+	pool := newFakePool(c)
+	defer pool.listener.Close()
+
+	result := Probe(pool.address(), "Vworker", "x", time.Second)
+	c.Assert(result.Err, IsNil)
+	c.Check(result.Up, Equals, true)
+	c.Check(result.Latency > 0, Equals, true)
+	c.Check(result.FirstJob >= result.Latency, Equals, true)
+}
+
+func (s *probeSuite) TestJobBeforeAuthorizing(c *C) {
+	pool := newFakePool(c)
+	pool.jobFirst = true
+	defer pool.listener.Close()
+
+	result := Probe(pool.address(), "Vworker", "x", time.Second)
+	c.Check(result.Err, IsNil)
+	c.Check(result.Up, Equals, true)
+}
+
+func (s *probeSuite) TestRejectedWorker(c *C) {
+	pool := newFakePool(c)
+	pool.rejectWorkers = true
+	defer pool.listener.Close()
+
+	result := Probe(pool.address(), "Vworker", "x", time.Second)
+	c.Check(result.Up, Equals, false)
+	c.Check(result.Err, ErrorMatches, "worker Vworker wasn't authorized")
+}
+
+func (s *probeSuite) TestNoJobs(c *C) {
+	pool := newFakePool(c)
+	pool.withholdJobs = true
+	defer pool.listener.Close()
+
+	result := Probe(pool.address(), "Vworker", "x", time.Millisecond*200)
+	c.Check(result.Up, Equals, false)
+	c.Check(result.Err, ErrorMatches, "timed out after 200ms")
+}
+
+func (s *probeSuite) TestClosedPort(c *C) {
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	result := Probe(address, "Vworker", "x", time.Second)
+	c.Check(result.Up, Equals, false)
+	c.Check(result.Err, NotNil)
+}
+
+func (s *probeSuite) TestParseEndpoint(c *C) {
+	address, err := ParseEndpoint("stratum+tcp://pool.example:3333")
+	c.Assert(err, IsNil)
+	c.Check(address, Equals, "pool.example:3333")
+
+	for _, bad := range []string{"pool.example:3333", "http://pool.example:3333", "stratum+tcp://pool.example"} {
+		_, err := ParseEndpoint(bad)
+		c.Check(err, NotNil, Commentf(bad))
+	}
+}
@@ -0,0 +1,160 @@
+package updaters
+
+import (
+	"fmt"
+	"github.com/robmerrell/vtcboard/chain"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"labix.org/v2/mgo"
+	"log"
+	"time"
+)
+
+// Blocks ingests new blocks from a chain backend, rewinding any stored blocks that a
+// reorg has orphaned.
+type Blocks struct {
+	// defaults to the backend in the [chain] section of the config
+	Backend chain.Backend
+}
+
+// Update stores every block between the last stored block and the tip of the best chain,
+// up to blocks.per_run of them.
+func (b *Blocks) Update() error {
+	return b.UpdateUntil(nil)
+}
+
+// UpdateUntil is Update, stopping between blocks once stop is closed. The blocks stored
+// until then are kept and the next run carries on from them.
+func (b *Blocks) UpdateUntil(stop <-chan bool) error {
+	backend := b.Backend
+	if backend == nil {
+		var err error
+		if backend, err = chain.NewBackend(config.Get().Chain); err != nil {
+			return err
+		}
+	}
+
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	settings := config.Get().Blocks
+
+	tip, err := backend.BlockCount()
+	if err != nil {
+		return err
+	}
+
+	ancestor, err := commonAncestor(conn, backend, settings.MaxReorgDepth)
+	if err != nil {
+		return err
+	}
+
+	// start with a backfill when nothing is stored
+	next, prevHash := tip-int64(settings.Backfill), ""
+	if next < 0 {
+		next = 0
+	}
+	if ancestor != nil {
+		next, prevHash = ancestor.Height+1, ancestor.Hash
+	}
+
+	for height := next; height <= tip && height < next+int64(settings.PerRun); height++ {
+		select {
+		case <-stop:
+			log.Printf("stopping at block %d", height)
+			return nil
+		default:
+		}
+
+		hash, err := backend.BlockHash(height)
+		if err != nil {
+			return err
+		}
+
+		block, err := backend.Block(hash)
+		if err != nil {
+			return err
+		}
+
+		// the chain moved under us, the next run rewinds it
+		if prevHash != "" && block.PrevHash != prevHash {
+			log.Printf("block %d doesn't build on the stored chain, stopping until the next run", height)
+			return nil
+		}
+
+		if err := saveBlock(conn, block); err != nil {
+			return err
+		}
+		prevHash = block.Hash
+	}
+
+	return nil
+}
+
+// commonAncestor walks back from the last stored block until it finds one that is still
+// on the best chain, removing everything above it. It returns nil if no blocks are stored
+// and an error if the stored chain forks deeper than maxDepth.
+func commonAncestor(conn *models.MgoConnection, backend chain.Backend, maxDepth int) (*models.Block, error) {
+	latest, err := models.GetLatestBlock(conn)
+	if err == mgo.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	stored := latest
+	for depth := 0; ; depth++ {
+		if depth > maxDepth {
+			return nil, fmt.Errorf("reorg at block %d is deeper than %d blocks", latest.Height, maxDepth)
+		}
+
+		hash, err := backend.BlockHash(stored.Height)
+		if err != nil && err != chain.ErrNotFound {
+			return nil, err
+		}
+		if hash == stored.Hash {
+			break
+		}
+
+		stored, err = models.GetBlock(conn, stored.Height-1)
+		if err == mgo.ErrNotFound {
+			stored = nil
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if stored == latest {
+		return stored, nil
+	}
+
+	from := int64(0)
+	if stored != nil {
+		from = stored.Height + 1
+	}
+
+	log.Printf("rewinding orphaned blocks %d to %d", from, latest.Height)
+	return stored, models.RemoveBlocksFrom(conn, from)
+}
+
+// saveBlock stores a block read from the chain.
+func saveBlock(conn *models.MgoConnection, block *chain.Block) error {
+	stored := &models.Block{
+		Height:          block.Height,
+		Hash:            block.Hash,
+		PrevHash:        block.PrevHash,
+		Time:            block.Time,
+		Difficulty:      block.Difficulty,
+		TxCount:         block.TxCount,
+		Size:            block.Size,
+		CoinbaseValue:   block.CoinbaseValue,
+		MinerTag:        chain.CoinbaseTag(block.CoinbaseScript),
+		PayoutAddresses: block.PayoutAddresses,
+		IngestedAt:      time.Now().UTC(),
+	}
+
+	return stored.Save(conn)
+}
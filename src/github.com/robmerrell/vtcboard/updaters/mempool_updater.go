@@ -0,0 +1,62 @@
+package updaters
+
+import (
+	"fmt"
+	"github.com/robmerrell/vtcboard/chain"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/fees"
+	"github.com/robmerrell/vtcboard/models"
+	"math"
+	"time"
+)
+
+// Mempool snapshots the mempool of the node in the [chain] section of the config.
+type Mempool struct{}
+
+// Update stores the size of the mempool, a histogram of its fee rates and fee estimates,
+// and drops snapshots older than mempool.history.
+func (m *Mempool) Update() error {
+	chainSettings := config.Get().Chain
+	if chainSettings.RPCURL == "" {
+		return fmt.Errorf("chain.rpc_url must be set to read the mempool")
+	}
+
+	mempool, err := chain.NewRPC(chainSettings.RPCURL, chainSettings.RPCUser, chainSettings.RPCPassword).Mempool()
+	if err != nil {
+		return err
+	}
+
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	settings := config.Get().Mempool
+
+	// the node reports its minimum in coins per kilobyte
+	minRate := mempool.MinFee * 100000000 / 1000
+
+	snapshot := &models.MempoolSnapshot{
+		Count:      mempool.Count,
+		Bytes:      mempool.Bytes,
+		MinFeeRate: minRate,
+		TakenAt:    time.Now().UTC(),
+	}
+	for _, bucket := range fees.Histogram(mempool.Txs, fees.Buckets) {
+		// the last bucket has no upper bound, stored as 0
+		if math.IsInf(bucket.Max, 1) {
+			bucket.Max = 0
+		}
+		snapshot.Buckets = append(snapshot.Buckets, models.FeeBucket{Min: bucket.Min, Max: bucket.Max, Count: bucket.Count, Bytes: bucket.Bytes})
+	}
+	for _, blocks := range fees.Targets {
+		snapshot.Estimates = append(snapshot.Estimates, models.FeeEstimate{
+			Blocks:  blocks,
+			FeeRate: fees.Estimate(mempool.Txs, settings.BlockBytes, blocks, minRate),
+		})
+	}
+
+	if err := snapshot.Insert(conn); err != nil {
+		return err
+	}
+
+	return models.RemoveMempoolSnapshotsBefore(conn, time.Now().UTC().AddDate(0, 0, -settings.History))
+}
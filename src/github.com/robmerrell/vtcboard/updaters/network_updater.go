@@ -2,53 +2,167 @@ package updaters
 
 import (
 	"fmt"
+	"github.com/robmerrell/vtcboard/chain"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/emission"
 	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/retarget"
 	"io/ioutil"
+	"log"
+	"math"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// Network snapshots the network's stats from the first usable backend in network.backends.
 type Network struct{}
 
+// supplyTolerance is how far a backend's mined coins can be from the emission schedule,
+// as a fraction, before it's logged.
+const supplyTolerance = 0.01
+
 var networkBaseUrl = "http://explorer.vertcoin.org/chain/Vertcoin/q"
 
 // var networkBaseUrl = "http://cryptexplorer.com/chain/VertCoin/q"
 
-// Update retrieves VTC netork information from a blockchain api.
+// Update retrieves VTC netork information from the configured backends, failing over to
+// the next one when a backend errors or is behind the others.
 func (n *Network) Update() error {
-	hashRate, err := getHashRate()
+	settings := config.Get().Network
+
+	backends, err := networkBackends(settings.Backends)
 	if err != nil {
 		return err
 	}
 
+	stats, errs := chain.Failover(backends, int64(settings.MaxLag))
+	for i, err := range errs {
+		if err != nil {
+			log.Printf("%s: %s", settings.Backends[i], err)
+		}
+	}
+	if stats == nil {
+		return fmt.Errorf("none of the %d network backends could be used", len(backends))
+	}
+
+	// explorers that don't report the hashrate get it worked out from the difficulty. The
+	// supply is left empty rather than taken from the emission schedule, since the
+	// dashboard checks the reported supply against the schedule.
+	if stats.HashRate == 0 {
+		algorithm, err := retarget.Find(config.Get().Difficulty.Algorithm)
+		if err != nil {
+			return err
+		}
+		stats.HashRate = stats.Difficulty * math.Pow(2, 32) / algorithm.Spacing().Seconds()
+	}
+
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	network := &models.Network{
+		HashRate:    fmt.Sprintf("%.2f", stats.HashRate/1000000),
+		Difficulty:  strconv.FormatFloat(stats.Difficulty, 'f', -1, 64),
+		BlockCount:  strconv.FormatInt(stats.Height, 10),
+		GeneratedAt: time.Now().UTC(),
+	}
+	if stats.Supply > 0 {
+		network.Mined = fmt.Sprintf("%.0f", stats.Supply)
+		checkSupply(stats)
+	}
+	return network.Insert(conn)
+}
+
+// checkSupply logs when a backend's count of mined coins doesn't match the emission
+// schedule. It's checked once per snapshot, not every time the dashboard is drawn.
+func checkSupply(stats *chain.Stats) {
+	discrepancy := emission.Vertcoin.Discrepancy(stats.Height, stats.Supply)
+	if math.Abs(discrepancy) > supplyTolerance {
+		log.Printf("reported supply of %.0f at block %d is %.2f%% off the expected %.0f",
+			stats.Supply, stats.Height, discrepancy*100, emission.Vertcoin.SupplyAt(stats.Height))
+	}
+}
+
+// networkBackends creates the backends listed in network.backends.
+func networkBackends(entries []string) ([]chain.StatsBackend, error) {
+	backends := make([]chain.StatsBackend, 0, len(entries))
+	for _, entry := range entries {
+		fields := strings.Fields(entry)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty network backend")
+		}
+
+		needsURL, known := config.NetworkDialects[fields[0]]
+		if !known {
+			return nil, fmt.Errorf("unknown network backend %q", entry)
+		}
+		if (len(fields) == 2) != needsURL || len(fields) > 2 {
+			if needsURL {
+				return nil, fmt.Errorf("%s backend needs a url, got %q", fields[0], entry)
+			}
+			return nil, fmt.Errorf("%s backend doesn't take a url, got %q", fields[0], entry)
+		}
+
+		switch fields[0] {
+		case "abe":
+			backends = append(backends, &abe{})
+		case "rpc":
+			settings := config.Get().Chain
+			backends = append(backends, chain.NewRPC(settings.RPCURL, settings.RPCUser, settings.RPCPassword))
+		case "insight":
+			backends = append(backends, chain.NewInsight(fields[1]))
+		case "esplora":
+			backends = append(backends, chain.NewEsplora(fields[1]))
+		default:
+			return nil, fmt.Errorf("%s backend isn't supported by update_network", fields[0])
+		}
+	}
+
+	return backends, nil
+}
+
+// abe reads network stats from the Abe explorer at networkBaseUrl.
+type abe struct{}
+
+// Stats returns the explorer's hashrate, difficulty, supply and block count.
+func (a *abe) Stats() (*chain.Stats, error) {
+	hashRate, err := getHashRate()
+	if err != nil {
+		return nil, err
+	}
+
 	diff, err := getDifficulty()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	mined, err := getMined()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	blockCount, err := getBlockCount()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	conn := models.CloneConnection()
-	defer conn.Close()
-
-	network := &models.Network{
-		HashRate:    hashRate,
-		Difficulty:  diff,
-		Mined:       mined,
-		BlockCount:  blockCount,
-		GeneratedAt: time.Now().UTC(),
+	stats := &chain.Stats{}
+	if stats.HashRate, err = strconv.ParseFloat(hashRate, 64); err != nil {
+		return nil, err
 	}
-	return network.Insert(conn)
+	stats.HashRate *= 1000000
+	if stats.Difficulty, err = strconv.ParseFloat(diff, 64); err != nil {
+		return nil, err
+	}
+	if stats.Supply, err = strconv.ParseFloat(mined, 64); err != nil {
+		return nil, err
+	}
+	if stats.Height, err = strconv.ParseInt(blockCount, 10, 64); err != nil {
+		return nil, err
+	}
+
+	return stats, nil
 }
 
 // networkQuery queryies the network api at the given url.
@@ -0,0 +1,59 @@
+package updaters
+
+import (
+	"fmt"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/p2p"
+	"time"
+)
+
+// Nodes crawls the p2p network from the seeds in the config.
+type Nodes struct{}
+
+// Update crawls the network and stores how many nodes were reachable and the versions
+// they run.
+func (n *Nodes) Update() error {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	settings := config.Get().Nodes
+	if len(settings.Seeds) == 0 {
+		return fmt.Errorf("there are no nodes.seeds to start crawling from")
+	}
+
+	magic, err := p2p.ParseMagic(settings.Magic)
+	if err != nil {
+		return err
+	}
+
+	crawler := &p2p.Crawler{
+		Network:      p2p.Network{Magic: magic, Port: settings.Port},
+		Timeout:      time.Duration(settings.Timeout) * time.Second,
+		Concurrency:  settings.Concurrency,
+		MaxNodes:     settings.MaxNodes,
+		AllowPrivate: settings.AllowPrivate,
+	}
+	crawl := crawler.Crawl(settings.Seeds)
+	if len(crawl.Nodes) == 0 {
+		return fmt.Errorf("none of the %d nodes tried could be reached", crawl.Unreachable)
+	}
+
+	median, highest := crawl.Heights()
+	snapshot := &models.NodeSnapshot{
+		Reachable:    len(crawl.Nodes),
+		Unreachable:  crawl.Unreachable,
+		MedianHeight: int64(median),
+		MaxHeight:    int64(highest),
+		CrawledAt:    time.Now().UTC(),
+	}
+	for _, adoption := range crawl.Adoption() {
+		snapshot.Versions = append(snapshot.Versions, models.NodeVersion{
+			UserAgent: adoption.UserAgent,
+			Protocol:  adoption.Protocol,
+			Count:     adoption.Count,
+		})
+	}
+
+	return snapshot.Insert(conn)
+}
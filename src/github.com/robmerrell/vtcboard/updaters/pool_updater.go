@@ -0,0 +1,77 @@
+package updaters
+
+import (
+	"fmt"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/pools"
+	"log"
+	"net/http"
+	"time"
+)
+
+// Pools polls the stats apis of the pools in the config.
+type Pools struct{}
+
+// Update stores the latest stats of every pool. A pool that can't be reached keeps the
+// stats it had, and an error is only returned if none of them could be read.
+func (p *Pools) Update() error {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	specs := config.Get().Pools.APIs
+	names := []string{}
+	failed := 0
+
+	for _, spec := range specs {
+		api, err := pools.ParseAPI(spec)
+		if err != nil {
+			return err
+		}
+		names = append(names, api.Name)
+
+		stats, err := api.Fetch(http.DefaultClient)
+		if err != nil {
+			log.Printf("%s: %s", api.Name, err)
+			failed++
+			continue
+		}
+
+		if err := savePool(conn, api, stats); err != nil {
+			return err
+		}
+	}
+
+	if err := models.RemovePoolsExcept(conn, names); err != nil {
+		return err
+	}
+
+	if failed > 0 && failed == len(specs) {
+		return fmt.Errorf("none of the %d pool apis could be read", failed)
+	}
+	return nil
+}
+
+// savePool stores a pool's stats. When the pool doesn't say when it found its last block
+// the time is taken from the block if it has been ingested.
+func savePool(conn *models.MgoConnection, api *pools.API, stats *pools.Stats) error {
+	pool := &models.Pool{
+		Name:          api.Name,
+		Dialect:       api.Dialect,
+		Link:          api.Link(),
+		Hashrate:      stats.Hashrate,
+		Miners:        stats.Miners,
+		Workers:       stats.Workers,
+		LastBlock:     stats.LastBlock,
+		LastBlockTime: stats.LastBlockTime,
+		UpdatedAt:     time.Now().UTC(),
+	}
+
+	if pool.LastBlock > 0 && pool.LastBlockTime.IsZero() {
+		if block, err := models.GetBlock(conn, pool.LastBlock); err == nil {
+			pool.LastBlockTime = block.Time
+		}
+	}
+
+	return pool.Save(conn)
+}
@@ -2,40 +2,31 @@ package updaters
 
 import (
 	"github.com/SlyMarbo/rss"
+	"github.com/robmerrell/vtcboard/config"
 	"github.com/robmerrell/vtcboard/models"
 )
 
 type Reddit struct{}
 
-// Update retrieves any new stores on the vertcoin subreddit.
+var redditBaseUrl = "http://www.reddit.com"
+
+// Update retrieves any new stories from the subreddits in the config.
 func (r *Reddit) Update() error {
 	conn := models.CloneConnection()
 	defer conn.Close()
 
-	vertcoinPosts, err := getNewRedditPosts("http://www.reddit.com/r/vertcoin/.rss", "/r/vertcoin")
-	if err != nil {
-		return err
-	}
-
-	if err := savePosts(vertcoinPosts, conn); err != nil {
-		return err
-	}
-
-	vertcoinMiningPosts, err := getNewRedditPosts("http://www.reddit.com/r/vertcoinmining/.rss", "/r/vertcoinmining")
-	if err != nil {
-		return err
-	}
-
-	if err := savePosts(vertcoinMiningPosts, conn); err != nil {
-		return err
-	}
+	for _, source := range config.Get().Posts.Sources {
+		posts, err := getNewRedditPosts(redditBaseUrl+source+"/.rss", source)
+		if err != nil {
+			return err
+		}
 
-	vertmarketPosts, err := getNewRedditPosts("http://www.reddit.com/r/vertmarket/.rss", "/r/vertmarket")
-	if err != nil {
-		return err
+		if err := savePosts(posts, conn); err != nil {
+			return err
+		}
 	}
 
-	return savePosts(vertmarketPosts, conn)
+	return nil
 }
 
 func savePosts(posts []*models.Post, conn *models.MgoConnection) error {
@@ -0,0 +1,87 @@
+package updaters
+
+import (
+	"fmt"
+	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/models"
+	"github.com/robmerrell/vtcboard/stratum"
+	"log"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probeHistory is how long probes are kept for.
+const probeHistory = time.Hour * 24 * 7
+
+// Stratum checks that the stratum endpoints in the config accept miners.
+type Stratum struct{}
+
+// Update probes every endpoint at once and records whether it's up. Pools going down or
+// coming back up are logged.
+func (s *Stratum) Update() error {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	settings := config.Get().Pools
+	timeout := time.Duration(settings.ProbeTimeout) * time.Second
+
+	previous := make(map[string]bool)
+	latest, err := models.GetLatestProbes(conn)
+	if err != nil {
+		return err
+	}
+	for _, probe := range latest {
+		previous[probe.Endpoint] = probe.Up
+	}
+
+	// every endpoint is parsed before any are probed, so a bad one doesn't leave probes
+	// running after Update has returned
+	probes := make([]*models.Probe, len(settings.Stratum))
+	addresses := make([]string, len(settings.Stratum))
+	for i, entry := range settings.Stratum {
+		fields := strings.Fields(entry)
+		if len(fields) < 2 {
+			return fmt.Errorf("%q should be a pool name followed by a stratum+tcp:// url", entry)
+		}
+		probes[i] = &models.Probe{Pool: strings.Join(fields[:len(fields)-1], " "), Endpoint: fields[len(fields)-1]}
+
+		if addresses[i], err = stratum.ParseEndpoint(probes[i].Endpoint); err != nil {
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for i, probe := range probes {
+		wg.Add(1)
+		go func(probe *models.Probe, address string) {
+			defer wg.Done()
+
+			status := stratum.Probe(address, settings.ProbeWorker, settings.ProbePassword, timeout)
+			probe.Up = status.Up
+			probe.Latency = status.Latency.Seconds() * 1000
+			probe.FirstJob = status.FirstJob.Seconds() * 1000
+			if status.Err != nil {
+				probe.Error = status.Err.Error()
+			}
+			probe.CheckedAt = time.Now().UTC()
+		}(probe, addresses[i])
+	}
+	wg.Wait()
+
+	for _, probe := range probes {
+		if wasUp, seen := previous[probe.Endpoint]; seen && wasUp != probe.Up {
+			if probe.Up {
+				log.Printf("%s (%s) is back up", probe.Pool, probe.Endpoint)
+			} else {
+				log.Printf("%s (%s) is down: %s", probe.Pool, probe.Endpoint, probe.Error)
+			}
+		}
+
+		if err := probe.Insert(conn); err != nil {
+			return err
+		}
+	}
+
+	return models.RemoveProbesBefore(conn, time.Now().UTC().Add(-probeHistory))
+}
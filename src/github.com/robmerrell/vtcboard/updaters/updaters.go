@@ -4,3 +4,9 @@ package updaters
 type Updater interface {
 	Update() error
 }
+
+// Stoppable updaters can stop partway through an update when stop is closed, eg: when
+// another host has taken over.
+type Stoppable interface {
+	UpdateUntil(stop <-chan bool) error
+}
@@ -1,13 +1,19 @@
 package updaters
 
 import (
+	"bytes"
 	"fmt"
+	"github.com/robmerrell/vtcboard/chain"
 	"github.com/robmerrell/vtcboard/config"
+	"github.com/robmerrell/vtcboard/emission"
 	"github.com/robmerrell/vtcboard/models"
 	"labix.org/v2/mgo/bson"
 	. "launchpad.net/gocheck"
+	"log"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"testing"
 	"time"
 )
@@ -46,7 +52,7 @@ func (s *coinPriceSuite) SetUpSuite(c *C) {
 
 func (s *coinPriceSuite) SetUpTest(c *C) {
 	config.LoadConfig("test")
-	models.ConnectToDB(config.String("database.host"), config.String("database.db"))
+	models.ConnectToDB(config.Get().Database)
 	models.DropCollections()
 }
 
@@ -62,7 +68,7 @@ func replaceUrl(newUrl string, val *string, testFunc func()) {
 
 	testFunc()
 
-	val = &oldUrl
+	*val = oldUrl
 }
 
 func (s *coinPriceSuite) TestTradePrices(c *C) {
@@ -149,7 +155,7 @@ func (s *networkSuite) SetUpSuite(c *C) {
 
 func (s *networkSuite) SetUpTest(c *C) {
 	config.LoadConfig("test")
-	models.ConnectToDB(config.String("database.host"), config.String("database.db"))
+	models.ConnectToDB(config.Get().Database)
 	models.DropCollections()
 }
 
@@ -182,6 +188,282 @@ func (s *networkSuite) TestNetworkCalls(c *C) {
 	})
 }
 
+// ------------------------------------
+// Tests for creating network backends
+// ------------------------------------
+type networkBackendSuite struct{}
+
+var _ = Suite(&networkBackendSuite{})
+
+func (s *networkBackendSuite) SetUpTest(c *C) {
+	config.LoadConfig("test")
+}
+
+func (s *networkBackendSuite) TestEveryDialectHasABackend(c *C) {
+	for dialect, needsURL := range config.NetworkDialects {
+		entry := dialect
+		if needsURL {
+			entry += " http://explorer.example/api"
+		}
+
+		backends, err := networkBackends([]string{entry})
+		c.Check(err, IsNil, Commentf(entry))
+		c.Check(backends, HasLen, 1, Commentf(entry))
+	}
+}
+
+func (s *networkBackendSuite) TestInvalidBackends(c *C) {
+	for _, entry := range []string{"blockchair", "esplora", "abe http://explorer.example", "insight http://a http://b"} {
+		_, err := networkBackends([]string{entry})
+		c.Check(err, NotNil, Commentf(entry))
+	}
+}
+
+func (s *networkBackendSuite) TestCheckingTheSupply(c *C) {
+	var logged bytes.Buffer
+	log.SetOutput(&logged)
+	defer log.SetOutput(os.Stderr)
+
+	expected := emission.Vertcoin.SupplyAt(100000)
+	checkSupply(&chain.Stats{Height: 100000, Supply: expected})
+	c.Check(logged.String(), Equals, "")
+
+	checkSupply(&chain.Stats{Height: 100000, Supply: expected * 0.9})
+	c.Check(logged.String(), Matches, "(?s).*reported supply of .* at block 100000 is -10.00% off.*")
+}
+
+// ---------------------------
+// Tests for ingesting blocks
+// ---------------------------
+
+// fakeChain is an in memory chain backend. Each block's hash is its height followed by
+// the branch it was mined on.
+type fakeChain struct {
+	blocks []*chain.Block
+}
+
+func newFakeChain(length int) *fakeChain {
+	f := &fakeChain{}
+	f.extend(length, "a")
+	return f
+}
+
+// extend mines count blocks on top of the tip.
+func (f *fakeChain) extend(count int, branch string) {
+	for i := 0; i < count; i++ {
+		block := &chain.Block{Height: int64(len(f.blocks)), Time: time.Now().UTC()}
+		block.Hash = fmt.Sprintf("%d%s", block.Height, branch)
+		block.CoinbaseScript = []byte("\x03/" + branch + "pool/")
+		if block.Height > 0 {
+			block.PrevHash = f.blocks[block.Height-1].Hash
+		}
+		f.blocks = append(f.blocks, block)
+	}
+}
+
+// fork replaces every block from height up with count blocks on a new branch.
+func (f *fakeChain) fork(height int64, count int, branch string) {
+	f.blocks = f.blocks[:height]
+	f.extend(count, branch)
+}
+
+func (f *fakeChain) BlockCount() (int64, error) {
+	return int64(len(f.blocks) - 1), nil
+}
+
+func (f *fakeChain) BlockHash(height int64) (string, error) {
+	if height >= int64(len(f.blocks)) {
+		return "", chain.ErrNotFound
+	}
+	return f.blocks[height].Hash, nil
+}
+
+func (f *fakeChain) Block(hash string) (*chain.Block, error) {
+	for _, block := range f.blocks {
+		if block.Hash == hash {
+			return block, nil
+		}
+	}
+	return nil, chain.ErrNotFound
+}
+
+type blockSuite struct{}
+
+var _ = Suite(&blockSuite{})
+
+func (s *blockSuite) SetUpTest(c *C) {
+	config.LoadConfig("test")
+	models.ConnectToDB(config.Get().Database)
+	models.DropCollections()
+}
+
+func storedHashes(c *C) []string {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	blocks, err := models.GetBlocksAbove(conn, -1)
+	c.Assert(err, IsNil)
+
+	hashes := []string{}
+	for _, block := range blocks {
+		hashes = append(hashes, block.Hash)
+	}
+	return hashes
+}
+
+func (s *blockSuite) TestStoppingPartway(c *C) {
+	stop := make(chan bool)
+	close(stop)
+
+	c.Assert((&Blocks{Backend: newFakeChain(200)}).UpdateUntil(stop), IsNil)
+	c.Check(storedHashes(c), HasLen, 0)
+}
+
+func (s *blockSuite) TestBackfillAndFollowTheTip(c *C) {
+	backend := newFakeChain(200)
+	updater := &Blocks{Backend: backend}
+
+	c.Assert(updater.Update(), IsNil)
+	hashes := storedHashes(c)
+	c.Check(len(hashes), Equals, config.Get().Blocks.Backfill+1)
+	c.Check(hashes[len(hashes)-1], Equals, "199a")
+
+	backend.extend(2, "a")
+	c.Assert(updater.Update(), IsNil)
+	hashes = storedHashes(c)
+	c.Check(hashes[len(hashes)-1], Equals, "201a")
+
+	conn := models.CloneConnection()
+	defer conn.Close()
+	block, _ := models.GetBlock(conn, 201)
+	c.Check(block.MinerTag, Equals, "/apool/")
+}
+
+func (s *blockSuite) TestRewindingAReorg(c *C) {
+	backend := newFakeChain(200)
+	updater := &Blocks{Backend: backend}
+	c.Assert(updater.Update(), IsNil)
+
+	backend.fork(197, 5, "b")
+	c.Assert(updater.Update(), IsNil)
+
+	hashes := storedHashes(c)
+	c.Check(hashes[len(hashes)-6:], DeepEquals, []string{"196a", "197b", "198b", "199b", "200b", "201b"})
+}
+
+func (s *blockSuite) TestReorgsDeeperThanTheLimitStopIngestion(c *C) {
+	settings := *config.Get()
+	settings.Blocks.MaxReorgDepth = 10
+	config.Use(&settings)
+
+	backend := newFakeChain(200)
+	updater := &Blocks{Backend: backend}
+	c.Assert(updater.Update(), IsNil)
+
+	backend.fork(188, 20, "b")
+	c.Check(updater.Update(), NotNil)
+
+	hashes := storedHashes(c)
+	c.Check(hashes[len(hashes)-1], Equals, "199a")
+}
+
+// ----------------------------
+// Tests for polling pool apis
+// ----------------------------
+type poolSuite struct {
+	p2poolServer *httptest.Server
+}
+
+var _ = Suite(&poolSuite{})
+
+func (s *poolSuite) SetUpSuite(c *C) {
+	responses := map[string]string{
+		"/global_stats":    `{"pool_hash_rate": 50000000}`,
+		"/current_payouts": `{"Vaddress1": 1.5, "Vaddress2": 2.5}`,
+		"/recent_blocks":   `[{"ts": 1400000000, "hash": "abc", "number": 1000}]`,
+	}
+
+	s.p2poolServer = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, responses[r.URL.Path])
+	}))
+}
+
+func (s *poolSuite) SetUpTest(c *C) {
+	config.LoadConfig("test")
+	models.ConnectToDB(config.Get().Database)
+	models.DropCollections()
+}
+
+func (s *poolSuite) TearDownSuite(c *C) {
+	s.p2poolServer.Close()
+}
+
+// usePools replaces the pool apis in the config.
+func usePools(apis ...string) {
+	settings := *config.Get()
+	settings.Pools.APIs = apis
+	config.Use(&settings)
+}
+
+func (s *poolSuite) TestUpdatingPools(c *C) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	(&models.Pool{Name: "removed.example"}).Save(conn)
+	usePools("p2pool "+s.p2poolServer.URL, "nomp http://127.0.0.1:1/api")
+
+	c.Assert((&Pools{}).Update(), IsNil)
+
+	pools, _ := models.GetPools(conn)
+	c.Assert(len(pools), Equals, 1)
+	c.Check(pools[0].Dialect, Equals, "p2pool")
+	c.Check(pools[0].Hashrate, Equals, float64(50000000))
+	c.Check(pools[0].Miners, Equals, 2)
+	c.Check(pools[0].LastBlock, Equals, int64(1000))
+}
+
+func (s *poolSuite) TestEveryPoolFailing(c *C) {
+	usePools("nomp http://127.0.0.1:1/api")
+	c.Check((&Pools{}).Update(), NotNil)
+}
+
+func (s *poolSuite) TestProbingStratum(c *C) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	listener, _ := net.Listen("tcp", "127.0.0.1:0")
+	address := listener.Addr().String()
+	listener.Close()
+
+	settings := *config.Get()
+	settings.Pools.Stratum = []string{"closed.example stratum+tcp://" + address}
+	settings.Pools.ProbeWorker = "Vworker"
+	config.Use(&settings)
+
+	c.Assert((&Stratum{}).Update(), IsNil)
+
+	probes, _ := models.GetLatestProbes(conn)
+	c.Assert(len(probes), Equals, 1)
+	c.Check(probes[0].Pool, Equals, "closed.example")
+	c.Check(probes[0].Up, Equals, false)
+	c.Check(probes[0].Error, Not(Equals), "")
+}
+
+func (s *poolSuite) TestBadStratumEndpointProbesNothing(c *C) {
+	conn := models.CloneConnection()
+	defer conn.Close()
+
+	settings := *config.Get()
+	settings.Pools.Stratum = []string{"first.example stratum+tcp://127.0.0.1:3333", "second.example http://127.0.0.1:3333"}
+	settings.Pools.ProbeWorker = "Vworker"
+	config.Use(&settings)
+
+	c.Check((&Stratum{}).Update(), NotNil)
+
+	probes, _ := models.GetLatestProbes(conn)
+	c.Check(probes, HasLen, 0)
+}
+
 // --------------------------
 // Tests for retrieving posts
 // --------------------------
@@ -252,7 +534,7 @@ func (s *postSuite) SetUpSuite(c *C) {
 
 func (s *postSuite) SetUpTest(c *C) {
 	config.LoadConfig("test")
-	models.ConnectToDB(config.String("database.host"), config.String("database.db"))
+	models.ConnectToDB(config.Get().Database)
 	models.DropCollections()
 }
 
@@ -267,22 +549,21 @@ func (s *postSuite) TestGettingReditPosts(c *C) {
 	conn := models.CloneConnection()
 	defer conn.Close()
 
-	replaceUrl(s.redditServer1.URL, &subredditUrl, func() {
-		p1 := &models.Post{Title: "test title", Url: "test url", Source: "reddit", UniqueId: "http://www.reddit.com/r/worldcoin/comments/1uj486/whats_a_better_name_than_scharmbeck/"}
-		p1.Insert(conn)
+	p1 := &models.Post{Title: "test title", Url: "test url", Source: "reddit", UniqueId: "http://www.reddit.com/r/worldcoin/comments/1uj486/whats_a_better_name_than_scharmbeck/"}
+	p1.Insert(conn)
 
-		posts, _ := getNewRedditPosts()
+	posts, _ := getNewRedditPosts(s.redditServer1.URL, "/r/vertcoin")
 
-		c.Check(len(posts), Equals, 1)
-		c.Check(posts[0].Title, Equals, "two worldcoins?")
-	})
+	c.Check(len(posts), Equals, 1)
+	c.Check(posts[0].Title, Equals, "two worldcoins?")
+	c.Check(posts[0].Source, Equals, "/r/vertcoin")
 }
 
 func (s *postSuite) TestUpdatingReddit(c *C) {
 	conn := models.CloneConnection()
 	defer conn.Close()
 
-	replaceUrl(s.redditServer2.URL, &subredditUrl, func() {
+	replaceUrl(s.redditServer2.URL, &redditBaseUrl, func() {
 		r := &Reddit{}
 		r.Update()
 